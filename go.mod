@@ -1,13 +1,16 @@
 module github.com/istreamlabs/go-metrics
 
-go 1.12
+go 1.23.0
 
 require (
-	github.com/DataDog/datadog-go v3.7.1+incompatible
-	github.com/mattn/go-colorable v0.1.6 // indirect
+	github.com/DataDog/datadog-go/v5 v5.9.1
 	github.com/mattn/go-isatty v0.0.12
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b
-	github.com/stretchr/testify v1.5.1 // indirect
-	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527 // indirect
-	gopkg.in/go-playground/assert.v1 v1.2.1
+)
+
+require (
+	github.com/Microsoft/go-winio v0.5.0 // indirect
+	github.com/mattn/go-colorable v0.1.6 // indirect
+	github.com/stretchr/testify v1.12.1 // indirect
+	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 )
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// Batch accumulates metric calls which are then sent together by `Send`,
+// e.g. when reporting a computed snapshot as dozens of related metrics:
+//
+//   batch := client.Batch()
+//   batch.Gauge("pool.size", float64(stats.Size))
+//   batch.Gauge("pool.idle", float64(stats.Idle))
+//   batch.Count("pool.created", stats.Created)
+//   batch.Send()
+//
+// Calls use the tags, rate, and prefix of the client the batch was created
+// from. Clients which can emit a batch as a unit do so, e.g. the
+// `LoggerClient` logs all of its lines without interleaving lines from other
+// goroutines. Other clients send each call in order. A batch is not safe for
+// concurrent use.
+type Batch struct {
+	client Client
+	calls  []func(Client)
+}
+
+// batchSender is implemented by clients which can send the calls of a batch
+// as a unit.
+type batchSender interface {
+	sendBatch(calls []func(Client))
+}
+
+// NewBatch creates an empty batch which sends to the given client, which is
+// how clients implement their `Batch` method.
+func NewBatch(client Client) *Batch {
+	return newBatch(client)
+}
+
+// newBatch creates an empty batch which sends to the given client.
+func newBatch(client Client) *Batch {
+	return &Batch{client: client}
+}
+
+// add appends a call to the batch.
+func (b *Batch) add(call func(Client)) {
+	b.calls = append(b.calls, call)
+}
+
+// Len returns the number of calls waiting to be sent.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Send emits all of the accumulated calls and empties the batch, so that it
+// can be reused.
+func (b *Batch) Send() {
+	calls := b.calls
+	b.calls = nil
+	if len(calls) == 0 {
+		return
+	}
+
+	if sender, ok := b.client.(batchSender); ok {
+		sender.sendBatch(calls)
+		return
+	}
+	replay(b.client, calls)
+}
+
+// replay sends each call to the client in order.
+func replay(client Client, calls []func(Client)) {
+	for _, call := range calls {
+		call(client)
+	}
+}
+
+// Count adds some integer value to a metric.
+func (b *Batch) Count(name string, value int64) {
+	b.add(func(c Client) { c.Count(name, value) })
+}
+
+// Incr adds one to a metric.
+func (b *Batch) Incr(name string) {
+	b.add(func(c Client) { c.Incr(name) })
+}
+
+// Decr subtracts one from a metric.
+func (b *Batch) Decr(name string) {
+	b.add(func(c Client) { c.Decr(name) })
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (b *Batch) CountWithRate(name string, value int64, rate float64) {
+	b.add(func(c Client) { c.CountWithRate(name, value, rate) })
+}
+
+// CountFloat adds a fractional value to a metric.
+func (b *Batch) CountFloat(name string, value float64) {
+	b.add(func(c Client) { c.CountFloat(name, value) })
+}
+
+// Gauge sets a numeric value.
+func (b *Batch) Gauge(name string, value float64) {
+	b.add(func(c Client) { c.Gauge(name, value) })
+}
+
+// GaugeInt sets a numeric integer value.
+func (b *Batch) GaugeInt(name string, value int64) {
+	b.add(func(c Client) { c.GaugeInt(name, value) })
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time.
+func (b *Batch) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	b.add(func(c Client) { c.GaugeWithTimestamp(name, value, timestamp) })
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (b *Batch) GaugeDelta(name string, delta float64) {
+	b.add(func(c Client) { c.GaugeDelta(name, delta) })
+}
+
+// Set counts the number of unique string values for a metric.
+func (b *Batch) Set(name string, value string) {
+	b.add(func(c Client) { c.Set(name, value) })
+}
+
+// Event creates a new event.
+func (b *Batch) Event(e *statsd.Event) {
+	b.add(func(c Client) { c.Event(e) })
+}
+
+// ServiceCheck reports the status of a service.
+func (b *Batch) ServiceCheck(sc *statsd.ServiceCheck) {
+	b.add(func(c Client) { c.ServiceCheck(sc) })
+}
+
+// Timing tracks a duration.
+func (b *Batch) Timing(name string, value time.Duration) {
+	b.add(func(c Client) { c.Timing(name, value) })
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (b *Batch) TimingMs(name string, ms float64) {
+	b.add(func(c Client) { c.TimingMs(name, ms) })
+}
+
+// Histogram tracks the statistical distribution of a value.
+func (b *Batch) Histogram(name string, value float64) {
+	b.add(func(c Client) { c.Histogram(name, value) })
+}
+
+// Distribution tracks the statistical distribution of a value.
+func (b *Batch) Distribution(name string, value float64) {
+	b.add(func(c Client) { c.Distribution(name, value) })
+}
@@ -0,0 +1,122 @@
+package metrics_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleBatch() {
+	client := metrics.NewLoggerClient(nil)
+
+	batch := client.WithTag("pool", "db").Batch()
+	batch.GaugeInt("pool.size", 10)
+	batch.GaugeInt("pool.idle", 4)
+	batch.Count("pool.created", 2)
+	batch.Send()
+	// Output: Gauge pool.size:10 [pool=db]
+	// Gauge pool.idle:4 [pool=db]
+	// Count pool.created:2 [pool=db]
+}
+
+func TestBatchLoggerContiguous(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			batch := client.Batch()
+			for j := 0; j < 20; j++ {
+				batch.GaugeInt(fmt.Sprintf("batch%d.item%d", i, j), int64(j))
+			}
+			batch.Send()
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				client.Incr("other")
+			}
+		}()
+	}
+	wg.Wait()
+
+	ExpectEqual(t, 400, len(recorder.messages))
+	batches := 0
+	for i, message := range recorder.messages {
+		if !strings.HasSuffix(message, ".item0:0 []") {
+			continue
+		}
+		batches++
+		batch := strings.TrimPrefix(strings.TrimSuffix(message, ".item0:0 []"), "Gauge ")
+		for j := 0; j < 20; j++ {
+			ExpectEqual(t, fmt.Sprintf("Gauge %s.item%d:%d []", batch, j, j), recorder.messages[i+j])
+		}
+	}
+	ExpectEqual(t, 10, batches)
+}
+
+func TestBatchRecorder(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	batch := recorder.WithPrefix("app.").WithTag("tag", "value").Batch()
+	batch.Incr("one")
+	batch.Timing("two", 2*time.Second)
+	batch.Set("three", "user")
+	ExpectEqual(t, 3, batch.Len())
+	ExpectEqual(t, 0, recorder.Length())
+
+	batch.Send()
+	ExpectEqual(t, 0, batch.Len())
+	recorder.Expect("app.one").Value(1).Tag("tag", "value")
+	recorder.Expect("app.two").Tag("tag", "value")
+	recorder.Expect("app.three").Tag("tag", "value")
+
+	// Sending again is a no-op until more calls are added.
+	batch.Send()
+	batch.Decr("one")
+	batch.Send()
+	ExpectEqual(t, 4, recorder.Length())
+}
+
+func TestBatchDataDog(t *testing.T) {
+	fake := &fakeStatsd{}
+	client := metrics.NewDataDogClientWithStatsd(fake)
+
+	batch := client.WithTag("tag", "value").Batch()
+	batch.Incr("one")
+	batch.Gauge("two", 2)
+	ExpectEqual(t, 0, len(fake.calls))
+
+	batch.Send()
+	ExpectEqual(t, []string{
+		"Count one:1 [tag:value] 1",
+		"Gauge two:2 [tag:value] 1",
+	}, fake.calls)
+	ExpectEqual(t, 1, fake.flushes)
+	ExpectEqual(t, uint64(2), client.Stats().Queued)
+}
+
+func TestBatchMulti(t *testing.T) {
+	recorder := &LogRecorder{}
+	memory := metrics.NewRecorderClient().WithTest(t)
+	client := metrics.NewMultiClient(metrics.NewLoggerClient(recorder), memory)
+
+	batch := client.Batch()
+	batch.Incr("one")
+	batch.GaugeInt("two", 2)
+	batch.Send()
+
+	ExpectEqual(t, []string{
+		"Count one:1 []",
+		"Gauge two:2 []",
+	}, recorder.messages)
+	memory.Expect("one").Value(1)
+	memory.Expect("two").Value(2)
+}
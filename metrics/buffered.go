@@ -0,0 +1,400 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// BufferPolicy describes what a `BufferedClient` does when its buffer is full.
+type BufferPolicy int
+
+const (
+	// BufferBlock blocks the caller until there is room in the buffer.
+	BufferBlock BufferPolicy = iota
+
+	// BufferDropOldest drops the oldest buffered call to make room. Pending
+	// flushes are never dropped, so while one is waiting a call may block
+	// until the background goroutine has emitted the next call.
+	BufferDropOldest
+
+	// BufferDropNewest drops the new call.
+	BufferDropNewest
+)
+
+// bufferedCall is a single buffered call. Flush markers have no call and
+// instead signal the flushing goroutine once everything before them has been
+// emitted.
+type bufferedCall struct {
+	call  func()
+	flush chan struct{}
+}
+
+// bufferedQueue is shared by a buffered client and all of its clones.
+type bufferedQueue struct {
+	mutex   sync.RWMutex
+	calls   chan bufferedCall
+	policy  BufferPolicy
+	dropped uint64
+	closed  bool
+	done    chan struct{}
+}
+
+// run executes buffered calls until the queue is closed and drained.
+func (q *bufferedQueue) run() {
+	for item := range q.calls {
+		if item.flush != nil {
+			close(item.flush)
+			continue
+		}
+		item.call()
+	}
+	close(q.done)
+}
+
+// enqueue adds a call to the queue according to the drop policy. Calls made
+// after the queue is closed are dropped.
+func (q *bufferedQueue) enqueue(item bufferedCall) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if q.closed {
+		if item.flush != nil {
+			close(item.flush)
+		} else {
+			atomic.AddUint64(&q.dropped, 1)
+		}
+		return
+	}
+
+	policy := q.policy
+	if item.flush != nil {
+		// Flush markers are never dropped on the way in.
+		policy = BufferBlock
+	}
+
+	switch policy {
+	case BufferBlock:
+		q.calls <- item
+	case BufferDropNewest:
+		select {
+		case q.calls <- item:
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+		}
+	case BufferDropOldest:
+		var markers []bufferedCall
+		for {
+			select {
+			case q.calls <- item:
+				// Flush markers are never evicted, since the call before
+				// them may still be running, so they go back in behind the
+				// new call like any other marker.
+				for _, marker := range markers {
+					q.calls <- marker
+				}
+				return
+			default:
+			}
+			select {
+			case oldest := <-q.calls:
+				if oldest.flush != nil {
+					markers = append(markers, oldest)
+				} else {
+					atomic.AddUint64(&q.dropped, 1)
+				}
+			default:
+			}
+		}
+	}
+}
+
+// BufferedClient wraps another client and emits metrics asynchronously from a
+// background goroutine, which keeps slow log writes or network sends off the
+// hot path. Calls are buffered up to a fixed size, after which the
+// `BufferPolicy` decides whether to block or drop calls:
+//
+//   client := metrics.NewBufferedClient(
+//     metrics.NewDataDogClient("127.0.0.1:8125", "myprefix"),
+//     1024, metrics.BufferDropOldest,
+//   )
+//   defer client.Close()
+//
+// The number of dropped calls is available via `Dropped` so that buffer
+// saturation can be monitored. Clones share the same buffer.
+type BufferedClient struct {
+	client Client
+	queue  *bufferedQueue
+}
+
+// NewBufferedClient creates a new buffered client wrapping `client` with room
+// for `size` calls. A size less than one causes a panic.
+func NewBufferedClient(client Client, size int, policy BufferPolicy) *BufferedClient {
+	if size < 1 {
+		log.Panic("buffer size must be positive")
+	}
+
+	q := &bufferedQueue{
+		calls:  make(chan bufferedCall, size),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	go q.run()
+
+	return &BufferedClient{
+		client: client,
+		queue:  q,
+	}
+}
+
+// wrap returns a new buffered client sharing this client's buffer.
+func (c *BufferedClient) wrap(client Client) *BufferedClient {
+	return &BufferedClient{
+		client: client,
+		queue:  c.queue,
+	}
+}
+
+// enqueue buffers a call using the configured drop policy.
+func (c *BufferedClient) enqueue(call func()) {
+	c.queue.enqueue(bufferedCall{call: call})
+}
+
+// Dropped returns the number of calls dropped because the buffer was full or
+// the client was already closed.
+func (c *BufferedClient) Dropped() uint64 {
+	return atomic.LoadUint64(&c.queue.dropped)
+}
+
+// WithTags clones this client with additional tags applied to the wrapped
+// client.
+func (c *BufferedClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	return c.wrap(c.client.WithTags(tags))
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *BufferedClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *BufferedClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *BufferedClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *BufferedClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags of the wrapped client.
+func (c *BufferedClient) Tags() map[string]string {
+	return c.client.Tags()
+}
+
+// Rate returns the sample rate of the wrapped client.
+func (c *BufferedClient) Rate() float64 {
+	return c.client.Rate()
+}
+
+// WithoutTags clones this client with the given tags removed from the
+// wrapped client.
+func (c *BufferedClient) WithoutTags(keys ...string) Client {
+	return c.wrap(c.client.WithoutTags(keys...))
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *BufferedClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions on the wrapped client.
+func (c *BufferedClient) WithTimestamp(timestamp time.Time) Client {
+	return c.wrap(c.client.WithTimestamp(timestamp))
+}
+
+// WithRate clones this client with a new sample rate applied to the wrapped
+// client.
+func (c *BufferedClient) WithRate(rate float64) Client {
+	return c.wrap(c.client.WithRate(rate))
+}
+
+// WithAdditionalRate clones this client with the wrapped client's sample
+// rate multiplied by `factor`.
+func (c *BufferedClient) WithAdditionalRate(factor float64) Client {
+	return c.wrap(c.client.WithAdditionalRate(factor))
+}
+
+// Always clones this client with the wrapped client always emitting, so that
+// critical metrics are never sampled out.
+func (c *BufferedClient) Always() Client {
+	return c.wrap(c.client.Always())
+}
+
+// WithPrefix clones this client with an additional metric name prefix
+// applied to the wrapped client.
+func (c *BufferedClient) WithPrefix(prefix string) Client {
+	return c.wrap(c.client.WithPrefix(prefix))
+}
+
+// Clone returns an independent copy of this client by cloning the wrapped
+// client. The clone shares the buffer of the original.
+func (c *BufferedClient) Clone() Client {
+	return c.wrap(c.client.Clone())
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *BufferedClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// Flush waits for all calls buffered so far to be emitted and then flushes
+// the wrapped client.
+func (c *BufferedClient) Flush() error {
+	done := make(chan struct{})
+	c.queue.enqueue(bufferedCall{flush: done})
+	<-done
+
+	return c.client.Flush()
+}
+
+// Close stops accepting new calls, waits for all buffered calls to be
+// emitted, and then closes the wrapped client. Calling it more than once is
+// a no-op.
+func (c *BufferedClient) Close() error {
+	c.queue.mutex.Lock()
+	if c.queue.closed {
+		c.queue.mutex.Unlock()
+		return nil
+	}
+	c.queue.closed = true
+	close(c.queue.calls)
+	c.queue.mutex.Unlock()
+
+	<-c.queue.done
+	return c.client.Close()
+}
+
+// Count adds some value to a metric.
+func (c *BufferedClient) Count(name string, value int64) {
+	c.enqueue(func() { c.client.Count(name, value) })
+}
+
+// Incr adds one to a metric.
+func (c *BufferedClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *BufferedClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *BufferedClient) CountWithRate(name string, value int64, rate float64) {
+	c.enqueue(func() { c.client.CountWithRate(name, value, rate) })
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *BufferedClient) CountFloat(name string, value float64) {
+	c.enqueue(func() { c.client.CountFloat(name, value) })
+}
+
+// Gauge sets a numeric value.
+func (c *BufferedClient) Gauge(name string, value float64) {
+	c.enqueue(func() { c.client.Gauge(name, value) })
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *BufferedClient) GaugeInt(name string, value int64) {
+	c.enqueue(func() { c.client.GaugeInt(name, value) })
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time.
+func (c *BufferedClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.enqueue(func() { c.client.GaugeWithTimestamp(name, value, timestamp) })
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *BufferedClient) GaugeDelta(name string, delta float64) {
+	c.enqueue(func() { c.client.GaugeDelta(name, delta) })
+}
+
+// Set counts the number of unique values for a metric.
+func (c *BufferedClient) Set(name string, value string) {
+	c.enqueue(func() { c.client.Set(name, value) })
+}
+
+// Event tracks an event that may be relevant to other metrics. The event is
+// copied, since the caller may reuse it before it is emitted.
+func (c *BufferedClient) Event(e *statsd.Event) {
+	copied := *e
+	copied.Tags = append([]string(nil), e.Tags...)
+	c.enqueue(func() { c.client.Event(&copied) })
+}
+
+// ServiceCheck reports the status of a service. The service check is copied,
+// since the caller may reuse it before it is emitted.
+func (c *BufferedClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	copied := *sc
+	copied.Tags = append([]string(nil), sc.Tags...)
+	c.enqueue(func() { c.client.ServiceCheck(&copied) })
+}
+
+// Timing tracks a duration.
+func (c *BufferedClient) Timing(name string, value time.Duration) {
+	c.enqueue(func() { c.client.Timing(name, value) })
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *BufferedClient) TimingMs(name string, ms float64) {
+	c.enqueue(func() { c.client.TimingMs(name, ms) })
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *BufferedClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *BufferedClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *BufferedClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock of the wrapped client.
+func (c *BufferedClient) clock() func() time.Time {
+	return clockFor(c.client)
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *BufferedClient) Histogram(name string, value float64) {
+	c.enqueue(func() { c.client.Histogram(name, value) })
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *BufferedClient) Distribution(name string, value float64) {
+	c.enqueue(func() { c.client.Distribution(name, value) })
+}
@@ -0,0 +1,202 @@
+package metrics_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// blockingClient blocks every count until released, which lets tests fill up
+// a buffer. It signals `started` once a count is blocked.
+type blockingClient struct {
+	metrics.Client
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingClient(client metrics.Client) *blockingClient {
+	return &blockingClient{
+		Client:  client,
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (c *blockingClient) Count(name string, value int64) {
+	c.started <- struct{}{}
+	<-c.release
+	c.Client.Count(name, value)
+}
+
+func ExampleBufferedClient() {
+	client := metrics.NewBufferedClient(metrics.NewLoggerClient(nil), 1024, metrics.BufferDropNewest)
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("requests.count")
+	client.Close()
+	// Output: Count requests.count:1 [tag1=value1]
+}
+
+func TestBufferedClient(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	var client metrics.Client
+	client = metrics.NewBufferedClient(recorder, 100, metrics.BufferBlock)
+
+	client.Incr("one")
+	client.WithTag("tag1", "value1").WithRate(0.5).Gauge("memory", 1024)
+	client.GaugeInt("connections", 3)
+	client.GaugeDelta("connections", 1)
+	client.Set("users", "alice")
+	client.Timing("timing", time.Second)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed. Found '%v'", err)
+	}
+
+	ExpectEqual(t, 10, recorder.Length())
+	recorder.Expect("memory").Value(1024).Tag("tag1", "value1").Rate(0.5)
+
+	client.Incr("two")
+	client.Close()
+	recorder.Expect("two")
+
+	// Calls after closing are dropped, and closing twice is a no-op.
+	client.Incr("three")
+	client.Flush()
+	client.Close()
+	recorder.If("three").Reject()
+	ExpectEqual(t, uint64(1), client.(*metrics.BufferedClient).Dropped())
+}
+
+func TestBufferedClientDropNewest(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	blocking := newBlockingClient(recorder)
+	client := metrics.NewBufferedClient(blocking, 2, metrics.BufferDropNewest)
+
+	// The first call blocks the background goroutine, so the next two fill
+	// up the buffer and the last one is dropped.
+	client.Count("first", 1)
+	<-blocking.started
+	client.GaugeInt("second", 2)
+	client.GaugeInt("third", 3)
+	client.GaugeInt("dropped", 4)
+	ExpectEqual(t, uint64(1), client.Dropped())
+
+	close(blocking.release)
+	client.Close()
+	ExpectEqual(t, 3, recorder.Length())
+	recorder.Expect("first")
+	recorder.Expect("second")
+	recorder.Expect("third")
+	recorder.If("dropped").Reject()
+}
+
+func TestBufferedClientDropOldest(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	blocking := newBlockingClient(recorder)
+	client := metrics.NewBufferedClient(blocking, 2, metrics.BufferDropOldest)
+
+	client.Count("first", 1)
+	<-blocking.started
+	client.GaugeInt("dropped", 2)
+	client.GaugeInt("second", 3)
+	client.GaugeInt("third", 4)
+	ExpectEqual(t, uint64(1), client.Dropped())
+
+	close(blocking.release)
+	client.Close()
+	ExpectEqual(t, 3, recorder.Length())
+	recorder.Expect("first")
+	recorder.Expect("second")
+	recorder.Expect("third")
+	recorder.If("dropped").Reject()
+}
+
+func TestBufferedClientDropOldestFlush(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	blocking := newBlockingClient(recorder)
+	client := metrics.NewBufferedClient(blocking, 2, metrics.BufferDropOldest)
+
+	client.Count("first", 1)
+	<-blocking.started
+	flushed := make(chan struct{})
+	go func() {
+		client.Flush()
+		close(flushed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Making room for the third call takes the flush marker out of the
+	// buffer, but the flush must still wait for the blocked call.
+	client.GaugeInt("second", 2)
+	go client.GaugeInt("third", 3)
+	select {
+	case <-flushed:
+		t.Fatal("Expected the flush to wait for the blocked call")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(blocking.release)
+	<-flushed
+	recorder.Expect("first")
+	client.Close()
+	ExpectEqual(t, uint64(0), client.Dropped())
+}
+
+func TestBufferedClientEventCopies(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	blocking := newBlockingClient(recorder)
+	client := metrics.NewBufferedClient(blocking, 10, metrics.BufferBlock)
+
+	client.Count("first", 1)
+	<-blocking.started
+
+	// The caller may reuse the event and check while they are buffered.
+	e := statsd.NewEvent("title", "desc")
+	e.Tags = []string{"tag:value"}
+	client.Event(e)
+	sc := statsd.NewServiceCheck("check", statsd.Ok)
+	sc.Tags = []string{"tag:value"}
+	client.ServiceCheck(sc)
+	e.Title = "changed"
+	e.Tags[0] = "tag:changed"
+	sc.Name = "changed"
+	sc.Tags[0] = "tag:changed"
+
+	close(blocking.release)
+	client.Close()
+	calls := recorder.GetCalls()
+	ExpectEqual(t, "title", calls[1].(*metrics.EventCall).Event.Title)
+	ExpectEqual(t, []string{"tag:value"}, calls[1].(*metrics.EventCall).Event.Tags)
+	ExpectEqual(t, "check", calls[2].(*metrics.ServiceCheckCall).Check.Name)
+	ExpectEqual(t, []string{"tag:value"}, calls[2].(*metrics.ServiceCheckCall).Check.Tags)
+}
+
+func TestBufferedClientConcurrency(t *testing.T) {
+	memory := metrics.NewMemoryClient()
+	client := metrics.NewBufferedClient(memory, 10, metrics.BufferBlock)
+
+	wg := sync.WaitGroup{}
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				client.Incr("concurrent")
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	client.Flush()
+
+	ExpectEqual(t, 1000.0, memory.Snapshot()["concurrent[]"].Value)
+	ExpectEqual(t, uint64(0), client.Dropped())
+}
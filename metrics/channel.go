@@ -0,0 +1,336 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// channelSink is shared by a channel client and all of its clones.
+type channelSink struct {
+	metrics chan Metric
+	policy  BufferPolicy
+	dropped uint64
+}
+
+// send pushes a metric onto the channel according to the drop policy.
+func (s *channelSink) send(m Metric) {
+	switch s.policy {
+	case BufferBlock:
+		s.metrics <- m
+	case BufferDropNewest:
+		select {
+		case s.metrics <- m:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	case BufferDropOldest:
+		for {
+			select {
+			case s.metrics <- m:
+				return
+			default:
+			}
+			select {
+			case <-s.metrics:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	}
+}
+
+// ChannelClient sends each metric call as a `Metric` value on a channel, so
+// that custom sinks can be built in a separate goroutine without having to
+// implement the whole `Client` interface:
+//
+//   metrics := make(chan metrics.Metric, 1024)
+//   client := metrics.NewChannelClient(metrics, metrics.BufferDropNewest)
+//
+//   go func() {
+//     for m := range metrics {
+//       fmt.Println(metrics.FormatMetric(m))
+//     }
+//   }()
+//
+// When the channel is full, the `BufferPolicy` decides whether to block or
+// drop calls, and the number of dropped calls is available via `Dropped`.
+// The client's rate is passed along with each metric but is not applied,
+// except that a rate of zero drops everything. Events and service checks are
+// ignored. The channel is owned by the caller and is never closed.
+type ChannelClient struct {
+	sink      *channelSink
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewChannelClient creates a new channel client which sends metrics on
+// `metrics` using the given policy when it is full.
+func NewChannelClient(metrics chan Metric, policy BufferPolicy) *ChannelClient {
+	if metrics == nil {
+		log.Panic("metrics channel must not be nil")
+	}
+
+	return &ChannelClient{
+		sink: &channelSink{
+			metrics: metrics,
+			policy:  policy,
+		},
+		rate: 1.0,
+	}
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *ChannelClient) clone() *ChannelClient {
+	clone := *c
+	return &clone
+}
+
+// Dropped returns the number of calls dropped because the channel was full.
+func (c *ChannelClient) Dropped() uint64 {
+	return atomic.LoadUint64(&c.sink.dropped)
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *ChannelClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	clone.tagMap = combine(c.tagMap, tags)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *ChannelClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *ChannelClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *ChannelClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *ChannelClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *ChannelClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *ChannelClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *ChannelClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *ChannelClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions, which is sent as the metric's timestamp.
+func (c *ChannelClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// at returns the timestamp set via `WithTimestamp`, or the current time.
+func (c *ChannelClient) at() time.Time {
+	if c.timestamp.IsZero() {
+		return time.Now()
+	}
+	return c.timestamp
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *ChannelClient) WithRate(rate float64) Client {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *ChannelClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *ChannelClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *ChannelClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client, which sends to the same
+// channel as the original.
+func (c *ChannelClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *ChannelClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// send pushes a metric with the client's name prefix, tags, and rate.
+func (c *ChannelClient) send(t Kind, name string, value float64, text string, timestamp time.Time) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.sink.send(Metric{
+		Type:      t,
+		Name:      c.prefix + name,
+		Value:     value,
+		Text:      text,
+		Tags:      combine(nil, c.tagMap),
+		Rate:      c.rate,
+		Timestamp: timestamp,
+	})
+}
+
+// Flush on the ChannelClient is a no-op
+func (c *ChannelClient) Flush() error {
+	return nil
+}
+
+// Close on the ChannelClient is a no-op, since the channel is owned by the
+// caller.
+func (c *ChannelClient) Close() error {
+	return nil
+}
+
+// Count adds some integer value to a metric.
+func (c *ChannelClient) Count(name string, value int64) {
+	c.send(KindCount, name, float64(value), "", c.at())
+}
+
+// Incr adds one to a metric.
+func (c *ChannelClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *ChannelClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *ChannelClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *ChannelClient) CountFloat(name string, value float64) {
+	c.send(KindCount, name, value, "", c.at())
+}
+
+// Gauge sets a numeric value.
+func (c *ChannelClient) Gauge(name string, value float64) {
+	c.send(KindGauge, name, value, "", c.at())
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *ChannelClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time, which is sent as
+// the metric's timestamp.
+func (c *ChannelClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.send(KindGauge, name, value, "", timestamp)
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *ChannelClient) GaugeDelta(name string, delta float64) {
+	c.send(KindGaugeDelta, name, delta, "", time.Now())
+}
+
+// Set counts the number of unique values for a metric. The value is sent as
+// the metric's text.
+func (c *ChannelClient) Set(name string, value string) {
+	c.send(KindSet, name, 0, value, time.Now())
+}
+
+// Event on the ChannelClient is a no-op
+func (c *ChannelClient) Event(e *statsd.Event) {
+}
+
+// ServiceCheck on the ChannelClient is a no-op
+func (c *ChannelClient) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
+// Timing tracks a duration in milliseconds.
+func (c *ChannelClient) Timing(name string, value time.Duration) {
+	c.send(KindTiming, name, float64(value)/float64(time.Millisecond), "", time.Now())
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *ChannelClient) TimingMs(name string, ms float64) {
+	c.send(KindTiming, name, ms, "", time.Now())
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *ChannelClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *ChannelClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *ChannelClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *ChannelClient) Histogram(name string, value float64) {
+	c.send(KindHistogram, name, value, "", time.Now())
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *ChannelClient) Distribution(name string, value float64) {
+	c.send(KindDistribution, name, value, "", c.at())
+}
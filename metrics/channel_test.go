@@ -0,0 +1,132 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleChannelClient() {
+	ch := make(chan metrics.Metric, 1024)
+	client := metrics.NewChannelClient(ch, metrics.BufferDropNewest)
+
+	go func() {
+		for m := range ch {
+			_ = m
+		}
+	}()
+
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("requests.count")
+}
+
+func TestChannelClient(t *testing.T) {
+	ch := make(chan metrics.Metric, 100)
+
+	var client metrics.Client
+	client = metrics.NewChannelClient(ch, metrics.BufferBlock).
+		WithPrefix("testing.").
+		WithTag("tag1", "value1")
+
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	client.Incr("one")
+	client.Decr("one")
+	client.Count("two", 2)
+	client.CountFloat("work", 0.25)
+	client.Gauge("gauge", 1.5)
+	client.GaugeInt("depth", 3)
+	client.GaugeWithTimestamp("backfill", 5, timestamp)
+	client.GaugeDelta("delta", -2)
+	client.Set("unique", "user1")
+	client.Timing("timing", 1500*time.Millisecond)
+	client.TimingMs("timingms", 2.5)
+	client.Histogram("histo", 10)
+	client.Distribution("dist", 20)
+	client.WithRate(0.5).Incr("sampled")
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.WithRate(0).Incr("never")
+
+	expected := []metrics.Metric{
+		{Type: metrics.KindCount, Name: "testing.one", Value: 1, Rate: 1},
+		{Type: metrics.KindCount, Name: "testing.one", Value: -1, Rate: 1},
+		{Type: metrics.KindCount, Name: "testing.two", Value: 2, Rate: 1},
+		{Type: metrics.KindCount, Name: "testing.work", Value: 0.25, Rate: 1},
+		{Type: metrics.KindGauge, Name: "testing.gauge", Value: 1.5, Rate: 1},
+		{Type: metrics.KindGauge, Name: "testing.depth", Value: 3, Rate: 1},
+		{Type: metrics.KindGauge, Name: "testing.backfill", Value: 5, Rate: 1, Timestamp: timestamp},
+		{Type: metrics.KindGaugeDelta, Name: "testing.delta", Value: -2, Rate: 1},
+		{Type: metrics.KindSet, Name: "testing.unique", Text: "user1", Rate: 1},
+		{Type: metrics.KindTiming, Name: "testing.timing", Value: 1500, Rate: 1},
+		{Type: metrics.KindTiming, Name: "testing.timingms", Value: 2.5, Rate: 1},
+		{Type: metrics.KindHistogram, Name: "testing.histo", Value: 10, Rate: 1},
+		{Type: metrics.KindDistribution, Name: "testing.dist", Value: 20, Rate: 1},
+		{Type: metrics.KindCount, Name: "testing.sampled", Value: 1, Rate: 0.5},
+	}
+
+	ExpectEqual(t, len(expected), len(ch))
+
+	for _, e := range expected {
+		m := <-ch
+		if e.Timestamp.IsZero() {
+			if time.Since(m.Timestamp) > time.Minute {
+				t.Fatalf("Expected a recent timestamp. Found '%v'", m.Timestamp)
+			}
+			m.Timestamp = time.Time{}
+		}
+		ExpectEqual(t, map[string]string{"tag1": "value1"}, m.Tags)
+		m.Tags = nil
+		ExpectEqual(t, e, m)
+	}
+}
+
+func TestChannelClientTagsAreCopied(t *testing.T) {
+	ch := make(chan metrics.Metric, 10)
+	client := metrics.NewChannelClient(ch, metrics.BufferBlock).WithTag("tag1", "value1")
+
+	client.Incr("one")
+	m := <-ch
+	m.Tags["tag1"] = "changed"
+
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, client.Tags())
+}
+
+func TestChannelClientDropNewest(t *testing.T) {
+	ch := make(chan metrics.Metric, 2)
+	client := metrics.NewChannelClient(ch, metrics.BufferDropNewest)
+
+	client.Gauge("one", 1)
+	client.Gauge("two", 2)
+	client.Gauge("three", 3)
+
+	ExpectEqual(t, uint64(1), client.Dropped())
+	ExpectEqual(t, "one", (<-ch).Name)
+	ExpectEqual(t, "two", (<-ch).Name)
+}
+
+func TestChannelClientDropOldest(t *testing.T) {
+	ch := make(chan metrics.Metric, 2)
+	client := metrics.NewChannelClient(ch, metrics.BufferDropOldest)
+
+	client.Gauge("one", 1)
+	client.WithTag("tag", "value").Gauge("two", 2)
+	client.Gauge("three", 3)
+
+	// Clones share the dropped count with the original.
+	ExpectEqual(t, uint64(1), client.Dropped())
+	ExpectEqual(t, "two", (<-ch).Name)
+	ExpectEqual(t, "three", (<-ch).Name)
+}
+
+func TestChannelClientNilChannel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for a nil channel")
+		}
+	}()
+	metrics.NewChannelClient(nil, metrics.BufferBlock)
+}
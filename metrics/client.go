@@ -42,40 +42,187 @@
 package metrics
 
 import (
+	"context"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
 // Client provides a generic interface to log metrics and events
 type Client interface {
-	// WithTags returns a new client with the given tags.
+	// WithTags returns a new client with the given tags. Clients are never
+	// modified once created, so a nil or empty map returns the receiver
+	// itself without allocating.
 	WithTags(tags map[string]string) Client
 
-	// WithRate returns a new client with the given sample rate.
+	// WithTagsIf returns a new client with the given tags when `cond` is
+	// true, and otherwise returns the receiver unchanged, e.g. to tag failures:
+	//
+	//   client.WithTagsIf(err != nil, map[string]string{"error": "true"}).Incr("jobs")
+	WithTagsIf(cond bool, tags map[string]string) Client
+
+	// WithTag returns a new client with a single additional tag. It is
+	// equivalent to calling `WithTags` with a one-element map.
+	WithTag(key, value string) Client
+
+	// WithTagValues returns a new client with multiple values for a single
+	// tag, e.g. several `team` tags. The values are joined by commas, so
+	// `Tags` returns `{"team": "a,b"}` and most clients send that as a single
+	// value. Clients which support multiple values per key, like the
+	// `DataDogClient`, send each value as a separate `key:value` pair. Only
+	// values set this way are split, never a single value containing a
+	// comma. Like any tag, a later `WithTags` or `WithTag` with the same key
+	// replaces all of the values, so include the existing values to add one.
+	// No values removes the tag.
+	WithTagValues(key string, values ...string) Client
+
+	// WithTagsFromStruct returns a new client with additional tags from the
+	// fields of a struct tagged with `metric:"key"`, e.g. a config struct. It
+	// is equivalent to calling `WithTags` with the result of `TagsFromStruct`.
+	WithTagsFromStruct(v interface{}) Client
+
+	// Tags returns a copy of the tags currently attached to this client. It
+	// is never nil.
+	Tags() map[string]string
+
+	// Rate returns the sample rate of this client as set via `WithRate`,
+	// e.g. so that wrappers can replicate its configuration.
+	Rate() float64
+
+	// WithoutTags returns a new client with the given tags removed, e.g. to
+	// drop an inherited high-cardinality tag for a specific metric. Keys which
+	// are not present are ignored.
+	WithoutTags(keys ...string) Client
+
+	// WithContext returns a new client with the tags stored in the context
+	// via `ContextWithTags`. They are added just like calling `WithTags`, so
+	// they override existing tags and are overridden by later `WithTags`.
+	WithContext(ctx context.Context) Client
+
+	// WithTimestamp returns a new client which attributes subsequent counts,
+	// gauges, and distributions to the given time instead of the current
+	// time, e.g. for batch jobs which compute counts for historical windows:
+	//
+	//   client.WithTimestamp(windowStart).Count("jobs.processed", n)
+	//
+	// Clients which can send a timestamp, i.e. the `LoggerClient`,
+	// `SlogClient`, `ChannelClient`, `GraphiteClient`, `InfluxClient`, and
+	// `RecorderClient`, include it with each of those calls. The
+	// `DataDogClient` sends counts and gauges via the dogstatsd timestamp API
+	// but cannot send timestamped distributions. Other clients drop those
+	// calls while a timestamp is set, just like `GaugeWithTimestamp`, rather
+	// than record the values at the current time, and log the first dropped
+	// call of each kind. Other kinds of calls are unaffected. A zero time
+	// clears the timestamp.
+	WithTimestamp(timestamp time.Time) Client
+
+	// WithRate returns a new client with the given sample rate. The rate is
+	// clamped to the range [0.0, 1.0] and a rate of zero emits no metrics.
+	// Metrics are sampled exactly once, client-side, and clients which send
+	// to a server also send the rate so the full value can be extrapolated.
+	// The rate is absolute and replaces any inherited rate, so
+	// `WithRate(0.5).WithRate(0.5)` samples at 0.5.
 	WithRate(rate float64) Client
 
-	// Count/Incr/Decr set a numeric integer value.
+	// WithAdditionalRate returns a new client whose sample rate is the
+	// inherited rate multiplied by `factor`, so that sampling can be layered,
+	// e.g. by a library given an already-sampled client:
+	//
+	//   client.WithRate(0.5).WithAdditionalRate(0.5) // samples at 0.25
+	//
+	// The factor is clamped to the range [0.0, 1.0]. Per-metric rates set via
+	// `WithMetricRate` are not affected.
+	WithAdditionalRate(factor float64) Client
+
+	// Always returns a new client which is never sampled, regardless of the
+	// rate it inherited, while keeping its tags and prefix. Use it to emit
+	// critical metrics like errors from an otherwise sampled client.
+	Always() Client
+
+	// WithPrefix returns a new client which prepends the given prefix to all
+	// metric names. Prefixes are concatenated when chained.
+	WithPrefix(prefix string) Client
+
+	// Clone returns an independent copy of this client with the same tags,
+	// rate, and prefix, which can then diverge from the original.
+	Clone() Client
+
+	// Batch returns a new batch which accumulates metric calls until `Send`
+	// emits them together, e.g. without interleaving calls from other
+	// goroutines for clients which support it. See `Batch` for details.
+	Batch() *Batch
+
+	// Count/Incr/Decr set a numeric integer value. Incr and Decr are counts
+	// of 1 and -1, so they are sampled at the client's rate and scaled by it
+	// just like any other count.
 	Count(name string, value int64)
 	Incr(name string)
 	Decr(name string)
 
+	// CountWithRate adds some value to a metric using the given sample rate
+	// for just this call, regardless of the client's rate.
+	CountWithRate(name string, value int64, rate float64)
+
+	// CountFloat adds a fractional value to a counter, e.g. partial work
+	// units. Prefer `Count` for whole values.
+	CountFloat(name string, value float64)
+
 	// Gauge sets a numeric floating point value.
 	Gauge(name string, value float64)
 
+	// GaugeInt sets a numeric integer value, e.g. a queue depth.
+	GaugeInt(name string, value int64)
+
+	// GaugeWithTimestamp sets a numeric value at a given time, e.g. to
+	// backfill batch-computed metrics at their original time. Clients which
+	// cannot send a timestamp drop the call rather than record the value at
+	// the current time.
+	GaugeWithTimestamp(name string, value float64, timestamp time.Time)
+
+	// GaugeDelta adjusts a gauge by a signed amount relative to its current
+	// value rather than setting it. Deltas are never sampled, since a dropped
+	// delta would leave the gauge wrong, so they are sent at a rate of 1.0
+	// unless the client's rate is zero.
+	GaugeDelta(name string, delta float64)
+
+	// Set counts the number of unique string values for a metric.
+	Set(name string, value string)
+
 	// Event creates a new event, which allows additional information to be
 	// included when something worth calling out happens.
 	Event(e *statsd.Event)
 
+	// ServiceCheck reports the status of a service, e.g. for health checks.
+	ServiceCheck(sc *statsd.ServiceCheck)
+
 	// Timing creates a histogram of a duration.
 	Timing(name string, value time.Duration)
 
+	// TimingMs is like `Timing` but takes a duration in milliseconds, for
+	// code which already has a millisecond value.
+	TimingMs(name string, ms float64)
+
+	// NewTimer starts a timer which sends the elapsed duration via `Timing`
+	// when stopped, using this client's tags and sample rate.
+	NewTimer(name string) *Timer
+
+	// TimeFunc runs `fn` and sends its duration via `Timing`. The timing is
+	// sent even if `fn` panics.
+	TimeFunc(name string, fn func())
+
+	// TimingSince sends the duration since `start` via `Timing`, e.g. for
+	// a `start := time.Now()` taken earlier in the same function.
+	TimingSince(name string, start time.Time)
+
 	// Historgram creates a numeric floating point metric with min/max/avg/p95/etc.
 	Histogram(name string, value float64)
 
 	// Distribution tracks the statistical distribution of a set of values.
 	Distribution(name string, value float64)
 
+	// Flush sends any buffered data without closing client connections.
+	Flush() error
+
 	// Close closes all client connections and flushes any buffered data.
 	Close() error
 }
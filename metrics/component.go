@@ -0,0 +1,47 @@
+package metrics
+
+// Conventional tag keys set by `WithComponent`, so every subsystem uses the
+// same spelling.
+const (
+	ComponentTagKey = "component"
+	TeamTagKey      = "team"
+	TierTagKey      = "tier"
+)
+
+// Component describes the subsystem emitting metrics, which is reported via
+// the conventional `component`, `team` and `tier` tags.
+type Component struct {
+	Name string
+	Team string
+	Tier string
+}
+
+// Tags returns the conventional tags for the component. Empty fields are
+// skipped. The result is never nil.
+func (c Component) Tags() map[string]string {
+	tags := make(map[string]string, 3)
+	if c.Name != "" {
+		tags[ComponentTagKey] = c.Name
+	}
+	if c.Team != "" {
+		tags[TeamTagKey] = c.Team
+	}
+	if c.Tier != "" {
+		tags[TierTagKey] = c.Tier
+	}
+	return tags
+}
+
+// WithComponent clones the client with the conventional tags for a
+// component, overwriting any existing values:
+//
+//   client = metrics.WithComponent(client, metrics.Component{
+//     Name: "api",
+//     Team: "core",
+//     Tier: "prod",
+//   })
+//
+// It is equivalent to calling `WithTags` with `component.Tags()`.
+func WithComponent(client Client, component Component) Client {
+	return client.WithTags(component.Tags())
+}
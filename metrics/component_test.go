@@ -0,0 +1,40 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleWithComponent() {
+	client := metrics.NewLoggerClient(nil)
+	api := metrics.WithComponent(client, metrics.Component{Name: "api", Team: "core", Tier: "prod"})
+	api.Incr("requests.count")
+	// Output: Count requests.count:1 [component=api team=core tier=prod]
+}
+
+func TestComponentTags(t *testing.T) {
+	ExpectEqual(t, map[string]string{
+		"component": "api",
+		"team":      "core",
+		"tier":      "prod",
+	}, metrics.Component{Name: "api", Team: "core", Tier: "prod"}.Tags())
+
+	// Empty fields are skipped rather than sent as empty tag values.
+	ExpectEqual(t, map[string]string{"component": "worker"}, metrics.Component{Name: "worker"}.Tags())
+	ExpectEqual(t, map[string]string{}, metrics.Component{}.Tags())
+}
+
+func TestWithComponent(t *testing.T) {
+	client := metrics.NewRecorderClient().WithTag("team", "infra").WithTag("region", "us")
+	component := metrics.WithComponent(client, metrics.Component{Name: "api", Team: "core"})
+
+	ExpectEqual(t, map[string]string{
+		"component": "api",
+		"team":      "core",
+		"region":    "us",
+	}, component.Tags())
+
+	// An empty component leaves the client unchanged.
+	ExpectEqual(t, client, metrics.WithComponent(client, metrics.Component{}))
+}
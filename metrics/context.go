@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextKey is the type of the context key used to store tags, which
+// prevents collisions with keys from other packages.
+type contextKey struct{}
+
+// ContextWithTags returns a copy of `ctx` carrying the given tags, e.g. to
+// let middleware attach request-scoped tags like a tenant once for all
+// metrics emitted downstream via `WithContext`. Tags already in the context
+// are kept, with duplicate tags overwritten by the new value.
+func ContextWithTags(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, contextKey{}, combine(TagsFromContext(ctx), tags))
+}
+
+// TagsFromContext returns a copy of the tags stored in `ctx` via
+// `ContextWithTags`. It is never nil.
+func TagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(contextKey{}).(map[string]string)
+	return combine(nil, tags)
+}
+
+// TagsFromHeader returns tags built from HTTP request headers, e.g. in a
+// middleware, where `mapping` maps a header name to a tag key:
+//
+//   tags := metrics.TagsFromHeader(r.Header, map[string]string{
+//     "X-Tenant-ID": "tenant",
+//   })
+//   ctx := metrics.ContextWithTags(r.Context(), tags)
+//
+// Header names are case-insensitive. Missing and empty headers are skipped,
+// and only the first value of a repeated header is used. It is never nil.
+func TagsFromHeader(h http.Header, mapping map[string]string) map[string]string {
+	tags := make(map[string]string, len(mapping))
+	for header, key := range mapping {
+		if value := h.Get(header); value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// withContext returns a client with the context tags added, or the client
+// itself if the context has no tags.
+func withContext(client Client, ctx context.Context) Client {
+	tags := TagsFromContext(ctx)
+	if len(tags) == 0 {
+		return client
+	}
+	return client.WithTags(tags)
+}
@@ -0,0 +1,76 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleContextWithTags() {
+	client := metrics.NewLoggerClient(nil)
+
+	// Usually done once in a middleware.
+	ctx := metrics.ContextWithTags(context.Background(), map[string]string{
+		"tenant": "acme",
+	})
+
+	client.WithContext(ctx).Incr("requests.count")
+	// Output: Count requests.count:1 [tenant=acme]
+}
+
+func TestContextTags(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	client := recorder.WithTag("tag1", "value1")
+
+	ctx := metrics.ContextWithTags(context.Background(), map[string]string{
+		"tenant": "acme",
+		"tag1":   "context",
+	})
+	child := metrics.ContextWithTags(ctx, map[string]string{
+		"trace": "abc",
+	})
+	unrelated := context.Background()
+
+	client.WithContext(ctx).Incr("ctx")
+	client.WithContext(child).WithTag("tenant", "override").Incr("child")
+	client.WithContext(unrelated).Incr("unrelated")
+
+	ExpectEqual(t, "ctx:1[tag1:context tenant:acme]", recorder.GetCalls()[0].String())
+	ExpectEqual(t, "child:1[tag1:context tenant:override trace:abc]", recorder.GetCalls()[1].String())
+	ExpectEqual(t, "unrelated:1[tag1:value1]", recorder.GetCalls()[2].String())
+
+	// The parent context is not modified by deriving a child.
+	ExpectEqual(t, map[string]string{"tenant": "acme", "tag1": "context"}, metrics.TagsFromContext(ctx))
+	ExpectEqual(t, map[string]string{}, metrics.TagsFromContext(unrelated))
+}
+
+func TestContextTagsNullClient(t *testing.T) {
+	client := metrics.NewNullClient()
+	ctx := metrics.ContextWithTags(context.Background(), map[string]string{"tenant": "acme"})
+
+	if client.WithContext(ctx) != client {
+		t.Fatalf("Expected null client to return itself")
+	}
+}
+
+func TestTagsFromHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Tenant-ID", "acme")
+	h.Add("X-Region", "us-west-2")
+	h.Add("X-Region", "us-east-1")
+	h.Set("X-Empty", "")
+
+	ExpectEqual(t, map[string]string{
+		"tenant": "acme",
+		"region": "us-west-2",
+	}, metrics.TagsFromHeader(h, map[string]string{
+		"x-tenant-id": "tenant",
+		"X-Region":    "region",
+		"X-Empty":     "empty",
+		"X-Missing":   "missing",
+	}))
+
+	ExpectEqual(t, map[string]string{}, metrics.TagsFromHeader(nil, map[string]string{"X-Tenant-ID": "tenant"}))
+}
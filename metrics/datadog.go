@@ -1,28 +1,244 @@
 package metrics
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
+// statsdClient is the subset of the dogstatsd client used by the DataDog
+// client. It is satisfied by `*statsd.Client` and allows a fake to be used
+// in tests to assert the exact calls forwarded.
+type statsdClient interface {
+	Count(name string, value int64, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+	GaugeWithTimestamp(name string, value float64, tags []string, rate float64, timestamp time.Time) error
+	CountWithTimestamp(name string, value int64, tags []string, rate float64, timestamp time.Time) error
+	Set(name string, value string, tags []string, rate float64) error
+	Histogram(name string, value float64, tags []string, rate float64) error
+	Distribution(name string, value float64, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+	TimeInMilliseconds(name string, value float64, tags []string, rate float64) error
+	Event(e *statsd.Event) error
+	ServiceCheck(sc *statsd.ServiceCheck) error
+	Flush() error
+	Close() error
+}
+
+// statsdTelemetry is implemented by dogstatsd clients which count what
+// happens to calls after they have been accepted.
+type statsdTelemetry interface {
+	GetTelemetry() statsd.Telemetry
+}
+
+// errTimestampUnsupported is reported when a timestamped distribution cannot
+// be sent by the dogstatsd client.
+var errTimestampUnsupported = errors.New("metrics: the dogstatsd client does not support timestamped distributions")
+
+// errDeltaUnsupported is reported when a relative gauge update cannot be sent
+// by the dogstatsd client.
+var errDeltaUnsupported = errors.New("metrics: the dogstatsd client does not support gauge deltas")
+
 // DataDogClient is a dogstatsd metrics client implementation.
+//
+// The client's sample rate is passed through with every metric. Sampling is
+// done once, client-side, by the underlying dogstatsd client, which also
+// sends the rate along (e.g. `|@0.5`) so that the DataDog agent can
+// extrapolate the full value. Events have no sample rate in the protocol and
+// are sampled by this client instead.
 type DataDogClient struct {
-	client *statsd.Client
-	rate   float64
-	tags   []string
+	client    statsdClient
+	rate      float64
+	tagMap    map[string]string
+	tags      []string    // cached `key:value` form of tagMap sent with each call
+	multi     tagValueMap // individual values of keys set via `WithTagValues`
+	prefix    string
+	rates     map[string]float64
+	minRates  map[string]float64
+	redact    func(key, value string) string
+	clashes   bool
+	names     nameMode
+	stats     *dataDogStats
+	onError   func(error)
+	limiter   *cardinalityLimiter
+	reserved  reservedMode
+	negative  bool
+	warnings  *warnThrottle
+	typeTags  map[string]map[string]string
+	now       func() time.Time
+	batches   *sync.Mutex
+	timestamp time.Time
+	events    *eventThrottle
+	gauges    *observedGauges
+	fractions *countFractions
+}
+
+// countFractions holds the fractional part of `CountFloat` values which has
+// not been sent yet, per series. It is shared by a DataDog client and all of
+// its clones.
+type countFractions struct {
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+// add adds a value to the series and returns the whole units which are ready
+// to send, keeping the rest for later calls. Negative values are rounded
+// toward zero the same way, so e.g. -0.5 twice sends -1.
+func (f *countFractions) add(key string, value float64) int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	total := f.values[key] + value
+	whole := math.Trunc(total)
+	if remainder := total - whole; remainder != 0 {
+		f.values[key] = remainder
+	} else {
+		delete(f.values, key)
+	}
+	return int64(whole)
+}
+
+// eventThrottle drops events with the same title within a window. It is
+// shared by a DataDog client and all of its clones.
+type eventThrottle struct {
+	mutex  sync.Mutex
+	window time.Duration
+	titles map[string]*eventWindow
+}
+
+// eventWindow tracks when an event title was last sent and how many
+// duplicates have been dropped since.
+type eventWindow struct {
+	sent       time.Time
+	suppressed int
+}
+
+// newEventThrottle returns a throttle for the given window, or nil if the
+// window is zero.
+func newEventThrottle(window time.Duration) *eventThrottle {
+	if window <= 0 {
+		return nil
+	}
+	return &eventThrottle{
+		window: window,
+		titles: map[string]*eventWindow{},
+	}
+}
+
+// allow returns whether an event with the given title may be sent at the
+// given time and, if so, how many duplicates were dropped before it. A nil
+// throttle allows every event.
+func (t *eventThrottle) allow(title string, now time.Time) (int, bool) {
+	if t == nil {
+		return 0, true
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if w, ok := t.titles[title]; ok && now.Sub(w.sent) < t.window {
+		w.suppressed++
+		return 0, false
+	}
+
+	suppressed := 0
+	if w, ok := t.titles[title]; ok {
+		suppressed = w.suppressed
+	}
+	t.titles[title] = &eventWindow{sent: now}
+
+	if len(t.titles) > maxThrottledWarnings {
+		for title, w := range t.titles {
+			if now.Sub(w.sent) >= t.window {
+				delete(t.titles, title)
+			}
+		}
+	}
+	return suppressed, true
 }
 
-// Options contains the configuration options for a client.
+// ClientStats contains counts of what happened to the metrics, events, and
+// service checks handed to the underlying client since it was created.
+//
+// Queued counts calls accepted by the dogstatsd client, before its
+// client-side sampling and aggregation. Sent counts the payloads (packets)
+// it has written to the connection, each of which holds many calls.
+// Dropped adds up calls which were rejected (e.g. because a metric is too
+// large to fit into a payload) or dropped from a full channel, and payloads
+// which were dropped because the sender queue was full or the write failed,
+// so any increase means metrics were lost.
+//
+// Counts after a call has been queued come from the dogstatsd client's own
+// telemetry, which it only keeps while telemetry is turned on. Packets lost
+// on the network after being written to a UDP socket cannot be observed by
+// the client, so consider a Unix domain socket address for high-volume
+// services.
+type ClientStats struct {
+	Queued  uint64
+	Sent    uint64
+	Dropped uint64
+}
+
+// dataDogStats is shared by a DataDog client and all of its clones.
+type dataDogStats struct {
+	queued  uint64
+	dropped uint64
+}
+
+// Options contains the configuration options for a client. Options which do
+// not apply to a given client are ignored.
 type Options struct {
-	WithoutTelemetry bool
+	WithoutTelemetry      bool
+	Tags                  map[string]string
+	Rate                  float64
+	Prefix                string
+	Random                func() float64
+	JSON                  bool
+	MetricRates           map[string]float64
+	MinRates              map[string]float64
+	TagRedactor           func(key, value string) string
+	TagCollisions         bool
+	Names                 nameMode
+	OnError               func(error)
+	TagLimit              int
+	TagOverflow           string
+	Reserved              reservedMode
+	MaxBytesPerPayload    int
+	MaxMessagesPerPayload int
+	FlushInterval         time.Duration
+	GaugeInterval         time.Duration
+	Summaries             bool
+	SummaryInterval       time.Duration
+	Aggregation           bool
+	AggregationInterval   time.Duration
+	NegativeChecks        bool
+	WarningInterval       time.Duration
+	TypeTags              map[string]map[string]string
+	TypeLabels            map[string]string
+	RequireUnixSocket     bool
+	EventWindow           time.Duration
+	HistogramBuckets      map[string][]float64
+	HashSampling          bool
+	Clock                 func() time.Time
 }
 
 // Option is a client option. Can return an error if validation fails.
 type Option func(*Options) error
 
-// WithoutTelemetry turns off senting DataDog telemetry metrics.
+// WithoutTelemetry turns off senting DataDog telemetry metrics. The
+// dogstatsd client then stops counting payloads, so `Stats` only reports
+// calls queued and rejected.
 func WithoutTelemetry() Option {
 	return func(o *Options) error {
 		o.WithoutTelemetry = true
@@ -30,9 +246,536 @@ func WithoutTelemetry() Option {
 	}
 }
 
+// WithInitialTags sets default tags on the newly created client, e.g. host,
+// region, or environment tags that should be on every metric. This is
+// equivalent to calling `WithTags` on it, so the defaults have the lowest
+// priority and can be overridden by later calls to `WithTags`.
+func WithInitialTags(tags map[string]string) Option {
+	return func(o *Options) error {
+		o.Tags = combine(o.Tags, tags)
+		return nil
+	}
+}
+
+// WithEnvTag adds a default tag whose value is read from an environment
+// variable when the client is created, e.g. to tag every metric with the
+// pod it came from when running many instances:
+//
+//   metrics.WithEnvTag("pod", "POD_NAME")
+//
+// It behaves just like `WithInitialTags`, except that the tag is skipped when
+// the variable is unset or empty.
+func WithEnvTag(key string, env string) Option {
+	return func(o *Options) error {
+		if key == "" || env == "" {
+			return errors.New("env tag key and variable must not be empty")
+		}
+		if value := os.Getenv(env); value != "" {
+			o.Tags = combine(o.Tags, map[string]string{key: value})
+		}
+		return nil
+	}
+}
+
+// WithInitialRate sets the sample rate of the newly created client,
+// equivalent to calling `WithRate` on it.
+func WithInitialRate(rate float64) Option {
+	return func(o *Options) error {
+		o.Rate = clampRate(rate)
+		return nil
+	}
+}
+
+// WithPrefix sets a prefix that is prepended to all metric names emitted by
+// the newly created client, equivalent to calling `WithPrefix` on it.
+func WithPrefix(prefix string) Option {
+	return func(o *Options) error {
+		o.Prefix = prefix
+		return nil
+	}
+}
+
+// WithRandSource sets the source of random numbers in the range [0.0, 1.0)
+// used to decide whether a sampled metric is emitted. It defaults to
+// `rand.Float64` and is useful for deterministic tests of sampled metrics:
+//
+//   r := rand.New(rand.NewSource(1))
+//   metrics.NewLoggerClient(nil, metrics.WithRandSource(r.Float64))
+//
+// Currently only supported by the `LoggerClient` and `SlogClient`.
+func WithRandSource(random func() float64) Option {
+	return func(o *Options) error {
+		if random == nil {
+			return errors.New("rand source must not be nil")
+		}
+		o.Random = random
+		return nil
+	}
+}
+
+// WithHashSampling sets the sample rate of the newly created client, like
+// `WithInitialRate`, but decides whether to send each metric based on a
+// hash of its name and tags instead of a random number. The same series is
+// then always either sent or dropped, rather than flickering, which keeps
+// sparse signals correlated and makes downsampling cardinality-stable. It
+// also applies to rates set later via `WithRate` or `WithMetricRate`.
+// Events are still sampled randomly. Currently only supported by the
+// `LoggerClient` and `SlogClient`.
+func WithHashSampling(rate float64) Option {
+	return func(o *Options) error {
+		o.Rate = clampRate(rate)
+		o.HashSampling = true
+		return nil
+	}
+}
+
+// WithClock sets the clock used by `NewTimer`, `TimeFunc`, and `TimingSince`
+// instead of `time.Now`, so that tests can advance time deterministically
+// and assert exact durations:
+//
+//   now := time.Now()
+//   client := metrics.NewLoggerClient(nil, metrics.WithClock(func() time.Time {
+//     return now
+//   }))
+//
+//   timer := client.NewTimer("latency")
+//   now = now.Add(time.Second)
+//   timer.Stop() // Sends exactly 1s
+//
+// Currently only supported by the `DataDogClient`, `LoggerClient`,
+// `SlogClient`, `MemoryClient`, and `RecorderClient`. The `BufferedClient`,
+// `FileClient`, `FilterClient`, and `MultiClient` use the clock of the client
+// they wrap.
+func WithClock(now func() time.Time) Option {
+	return func(o *Options) error {
+		if now == nil {
+			return errors.New("clock must not be nil")
+		}
+		o.Clock = now
+		return nil
+	}
+}
+
+// WithMetricRate sets the sample rate for a single metric name, which takes
+// precedence over the client's sample rate. The name does not include any
+// prefix set via `WithPrefix`. This option can be passed multiple times:
+//
+//   metrics.NewDataDogClient("127.0.0.1:8125", "myapp",
+//     metrics.WithMetricRate("request.bytes", 0.01),
+//     metrics.WithMetricRate("error.count", 1.0),
+//   )
+//
+// Currently only supported by the `DataDogClient`, `LoggerClient`, and
+// `SlogClient`.
+func WithMetricRate(name string, rate float64) Option {
+	return func(o *Options) error {
+		rates := make(map[string]float64, len(o.MetricRates)+1)
+		for k, v := range o.MetricRates {
+			rates[k] = v
+		}
+		rates[name] = clampRate(rate)
+		o.MetricRates = rates
+		return nil
+	}
+}
+
+// WithHistogramBuckets sets the upper bounds of the histogram buckets for a
+// single metric name, in place of the Prometheus defaults which rarely fit a
+// particular latency distribution. The name does not include any prefix set
+// via `WithPrefix`, and bounds use the unit exposed to Prometheus, so they
+// are in seconds for timings. This option can be passed multiple times:
+//
+//   client := prometheus.NewClient(
+//     metrics.WithHistogramBuckets("request.latency", []float64{0.01, 0.05, 0.1, 0.5}),
+//   )
+//
+// Bounds must be sorted in increasing order. Currently only supported by the
+// `MemoryClient` and the `prometheus.Client` subpackage, since statsd
+// servers choose their own buckets.
+func WithHistogramBuckets(name string, bounds []float64) Option {
+	return func(o *Options) error {
+		if len(bounds) == 0 {
+			return fmt.Errorf("histogram buckets for %q must not be empty", name)
+		}
+		for i, bound := range bounds {
+			if math.IsNaN(bound) || (i > 0 && bound <= bounds[i-1]) {
+				return fmt.Errorf("histogram buckets for %q must be sorted in increasing order", name)
+			}
+		}
+		buckets := make(map[string][]float64, len(o.HistogramBuckets)+1)
+		for k, v := range o.HistogramBuckets {
+			buckets[k] = v
+		}
+		buckets[name] = append([]float64(nil), bounds...)
+		o.HistogramBuckets = buckets
+		return nil
+	}
+}
+
+// WithMinRate sets a minimum sample rate for a single metric name, so that a
+// critical metric is emitted at least that often even when a library samples
+// aggressively via `WithRate`. It raises both the inherited client rate and
+// any rate set via `WithMetricRate`, but never lowers them. The name does not
+// include any prefix set via `WithPrefix`, and the rate is clamped to the
+// range [0.0, 1.0]. This option can be passed multiple times. Currently only
+// supported by the `DataDogClient`, `LoggerClient`, and `SlogClient`.
+func WithMinRate(name string, rate float64) Option {
+	return func(o *Options) error {
+		floors := make(map[string]float64, len(o.MinRates)+1)
+		for k, v := range o.MinRates {
+			floors[k] = v
+		}
+		floors[name] = clampRate(rate)
+		o.MinRates = floors
+		return nil
+	}
+}
+
+// WithTypeTags sets default tags which are only added to metrics of the
+// given type, which is one of `count`, `gauge`, `gaugedelta`, `set`,
+// `timing`, `histogram`, or `distribution`. For example, to tag all timings
+// with their unit:
+//
+//   client := metrics.NewDataDogClient("127.0.0.1:8125", "myprefix",
+//     metrics.WithTypeTags("timing", map[string]string{"unit": "ms"}),
+//     metrics.WithTypeTags("count", map[string]string{"kind": "counter"}),
+//   )
+//
+// Like `WithInitialTags`, they have the lowest priority and are overridden
+// by the client's tags. Events and service checks are not affected.
+// Currently only supported by the `DataDogClient`, `LoggerClient`, and
+// `SlogClient`.
+func WithTypeTags(metricType string, tags map[string]string) Option {
+	return func(o *Options) error {
+		if _, ok := metricTypeNames[Kind(metricType)]; !ok {
+			return fmt.Errorf("unknown metric type %q", metricType)
+		}
+		typeTags := make(map[string]map[string]string, len(o.TypeTags)+1)
+		for k, v := range o.TypeTags {
+			typeTags[k] = v
+		}
+		typeTags[metricType] = combine(o.TypeTags[metricType], tags)
+		o.TypeTags = typeTags
+		return nil
+	}
+}
+
+// WithTypeLabels sets the label logged for each metric type in place of the
+// default `Count`, `Gauge`, etc., e.g. to distinguish types at a glance when
+// scanning local logs:
+//
+//   client := metrics.NewLoggerClient(nil,
+//     metrics.WithTypeLabels(map[string]string{
+//       "count": "[COUNT]",
+//       "gauge": "[GAUGE]",
+//     }),
+//   )
+//
+// Keys are metric types, i.e. `count`, `gauge`, `gaugedelta`, `set`,
+// `timing`, `histogram`, or `distribution`, and types without a label keep
+// the default. Labels are used as-is, so they may include ANSI color codes.
+// Events, service checks, and JSON output are not affected. Currently only
+// supported by the `LoggerClient`.
+func WithTypeLabels(labels map[string]string) Option {
+	return func(o *Options) error {
+		for metricType := range labels {
+			if _, ok := metricTypeNames[Kind(metricType)]; !ok {
+				return fmt.Errorf("unknown metric type %q", metricType)
+			}
+		}
+		o.TypeLabels = combine(o.TypeLabels, labels)
+		return nil
+	}
+}
+
+// WithTagRedactor passes every tag value through `redact` before it is
+// stored, as a last line of defense against sensitive values like emails or
+// tokens slipping into tags, e.g. to hash emails:
+//
+//   metrics.WithTagRedactor(func(key, value string) string {
+//     if key != "email" {
+//       return value
+//     }
+//     sum := sha256.Sum256([]byte(value))
+//     return hex.EncodeToString(sum[:8])
+//   })
+//
+// It applies to initial tags and tags added via `WithTags`, `WithTag`,
+// `WithTagValues`, `WithContext`, etc., before names are sanitized or
+// checked. Tags on events and service checks themselves are not redacted.
+// By default values are unchanged. Currently only supported by the
+// `DataDogClient`, `LoggerClient`, and `SlogClient`.
+func WithTagRedactor(redact func(key, value string) string) Option {
+	return func(o *Options) error {
+		if redact == nil {
+			return errors.New("tag redactor must not be nil")
+		}
+		o.TagRedactor = redact
+		return nil
+	}
+}
+
+// WithSanitizedNames replaces characters which are invalid for statsd, i.e.
+// `:`, `|`, `@` and whitespace, with an underscore in metric names, tag keys,
+// and tag values. Currently only supported by the `DataDogClient`,
+// `LoggerClient`, and `SlogClient`.
+func WithSanitizedNames() Option {
+	return func(o *Options) error {
+		o.Names = nameSanitize
+		return nil
+	}
+}
+
+// WithStrictNames drops any metric whose name, tag keys, or tag values
+// contain characters which are invalid for statsd and logs a warning instead.
+// Currently only supported by the `DataDogClient`, `LoggerClient`, and
+// `SlogClient`.
+func WithStrictNames() Option {
+	return func(o *Options) error {
+		o.Names = nameStrict
+		return nil
+	}
+}
+
+// WithJSON logs each metric as a single line of JSON, e.g.
+// `{"type":"count","name":"requests.count","value":1,"tags":{},"rate":1}`.
+// Timings are logged in milliseconds. Currently only supported by the
+// `LoggerClient`.
+func WithJSON() Option {
+	return func(o *Options) error {
+		o.JSON = true
+		return nil
+	}
+}
+
+// WithErrorHandler sets a callback which is invoked whenever the underlying
+// client fails to send a metric, event, or service check, e.g. to log or
+// count emission failures. By default failures are silently dropped. The
+// handler may be called concurrently from multiple goroutines. Currently only
+// supported by the `DataDogClient`.
+func WithErrorHandler(handler func(error)) Option {
+	return func(o *Options) error {
+		o.OnError = handler
+		return nil
+	}
+}
+
+// WithNegativeValueChecks drops any negative value passed to `Timing`,
+// `TimingMs`, `Histogram`, or `Distribution`, which is almost always a bug,
+// e.g. a clock going backwards, and would silently distort percentiles. The
+// `DataDogClient` passes the dropped call to its error handler and counts
+// it as dropped, while the `LoggerClient` and `SlogClient` log a warning.
+// Gauges are not affected since negative values are legitimate there.
+func WithNegativeValueChecks() Option {
+	return func(o *Options) error {
+		o.NegativeChecks = true
+		return nil
+	}
+}
+
+// WithWarningInterval sets how often each distinct validation warning, e.g.
+// from `WithStrictNames` or `WithReservedTagWarnings`, may be logged, so that
+// a misbehaving call site cannot flood the logs. Identical warnings within
+// the interval are suppressed. The default is one minute, and zero logs
+// every warning. Currently only supported by the `DataDogClient`,
+// `LoggerClient`, and `SlogClient`.
+func WithWarningInterval(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval < 0 {
+			return errors.New("warning interval must not be negative")
+		}
+		o.WarningInterval = interval
+		return nil
+	}
+}
+
+// WithEventDedupe drops events whose title matches an event sent within the
+// given window, so that a condition which fires repeatedly during an
+// incident sends one event instead of a flood. The next event with that
+// title after the window notes how many duplicates were dropped, e.g.
+// `(12 duplicate events suppressed)`. Duplicates are not sent by default.
+// Currently only supported by the `DataDogClient`.
+func WithEventDedupe(window time.Duration) Option {
+	return func(o *Options) error {
+		if window <= 0 {
+			return errors.New("event dedupe window must be positive")
+		}
+		o.EventWindow = window
+		return nil
+	}
+}
+
+// WithReservedTagWarnings logs a warning whenever a tag key from
+// `ReservedTagKeys`, e.g. `host`, is set, since it may shadow the tags set by
+// the DataDog agent. Currently only supported by the `DataDogClient`,
+// `LoggerClient`, and `SlogClient`.
+func WithReservedTagWarnings() Option {
+	return func(o *Options) error {
+		o.Reserved = reservedWarn
+		return nil
+	}
+}
+
+// WithTagCollisionWarnings logs a warning whenever `WithTags` or `WithTag`
+// replaces an inherited tag with a different value, including the old and
+// new values, e.g. to find out why a tag has an unexpected value deep in a
+// call chain. Overriding tags is usually intended, so this is off by
+// default and meant as a debugging aid. Currently only supported by the
+// `DataDogClient`, `LoggerClient`, and `SlogClient`.
+func WithTagCollisionWarnings() Option {
+	return func(o *Options) error {
+		o.TagCollisions = true
+		return nil
+	}
+}
+
+// WithStrictReservedTags drops any tag whose key is in `ReservedTagKeys` and
+// logs a warning instead. Currently only supported by the `DataDogClient`,
+// `LoggerClient`, and `SlogClient`.
+func WithStrictReservedTags() Option {
+	return func(o *Options) error {
+		o.Reserved = reservedStrict
+		return nil
+	}
+}
+
+// WithTagCardinalityLimit limits the number of distinct values tracked for
+// each tag key, which protects against accidentally tagging metrics with
+// unbounded values like IDs. Once a key has `limit` distinct values, new
+// values are replaced with `overflow`, or `__overflow__` if empty, and a
+// warning is logged. The limit is shared by the client and all of its clones.
+// Currently only supported by the `DataDogClient`, `LoggerClient`, and
+// `SlogClient`.
+func WithTagCardinalityLimit(limit int, overflow string) Option {
+	return func(o *Options) error {
+		if limit <= 0 {
+			return errors.New("tag cardinality limit must be positive")
+		}
+		o.TagLimit = limit
+		o.TagOverflow = overflow
+		return nil
+	}
+}
+
+// WithMaxBytesPerPayload sets the maximum size in bytes of a single packet
+// sent to the DataDog agent. It defaults to a size which fits into a single
+// UDP datagram on most networks. Currently only supported by the
+// `DataDogClient`.
+func WithMaxBytesPerPayload(bytes int) Option {
+	return func(o *Options) error {
+		if bytes <= 0 {
+			return errors.New("max bytes per payload must be positive")
+		}
+		o.MaxBytesPerPayload = bytes
+		return nil
+	}
+}
+
+// WithMaxMessagesPerPayload sets the maximum number of metrics, events, and
+// service checks in a single packet sent to the DataDog agent. By default
+// there is no limit, so packets are only bounded by `WithMaxBytesPerPayload`.
+// Currently only supported by the `DataDogClient`.
+func WithMaxMessagesPerPayload(messages int) Option {
+	return func(o *Options) error {
+		if messages <= 0 {
+			return errors.New("max messages per payload must be positive")
+		}
+		o.MaxMessagesPerPayload = messages
+		return nil
+	}
+}
+
+// WithBufferFlushInterval sets how often buffered metrics are sent to the
+// DataDog agent when the buffer is not yet full. It defaults to 100ms.
+// Currently only supported by the `DataDogClient`.
+func WithBufferFlushInterval(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			return errors.New("buffer flush interval must be positive")
+		}
+		o.FlushInterval = interval
+		return nil
+	}
+}
+
+// WithGaugeInterval sets how often callbacks registered via `RegisterGauge`
+// are polled. It defaults to 10s. Currently only supported by the
+// `DataDogClient`.
+func WithGaugeInterval(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			return errors.New("gauge interval must be positive")
+		}
+		o.GaugeInterval = interval
+		return nil
+	}
+}
+
+// WithUnixSocketRequired makes the constructor panic unless the address
+// uses the `unix://` transport:
+//
+//   client := metrics.NewDataDogClient("unix:///var/run/datadog/dsd.socket", "myprefix",
+//     metrics.WithUnixSocketRequired(),
+//   )
+//
+// This only checks the address. Origin detection, where the agent adds
+// container and pod tags like `kube_namespace` and `pod_name`, is done by the
+// agent from the credentials of a Unix domain socket when
+// `dogstatsd_origin_detection` is enabled there, so requiring the socket
+// catches deployments that would silently lose those tags. The dogstatsd
+// client sends the `DD_ENTITY_ID` environment variable as a tag whenever it
+// is set, with or without this option. Currently only supported by the
+// `DataDogClient`.
+func WithUnixSocketRequired() Option {
+	return func(o *Options) error {
+		o.RequireUnixSocket = true
+		return nil
+	}
+}
+
+// WithSummaries buffers timing, histogram, and distribution samples per
+// metric name and tags, and logs a summary with the count, min, max, p50,
+// p95, and p99 on each `Flush` and every `interval` instead of logging every
+// sample. An interval of zero only logs summaries on `Flush` and `Close`.
+// Currently only supported by the `LoggerClient`.
+func WithSummaries(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval < 0 {
+			return errors.New("summary interval must not be negative")
+		}
+		o.Summaries = true
+		o.SummaryInterval = interval
+		return nil
+	}
+}
+
+// WithClientAggregation enables client-side aggregation in the dogstatsd
+// client, which sums counts and keeps the last gauge value per metric name
+// and tags, then sends a single value for each every `interval`, or every
+// 3s if zero. This dramatically cuts packet volume for hot metrics.
+//
+// In exchange, aggregated metrics are delayed by up to the interval and are
+// not sent by `Flush`, only on the interval and on `Close`. Aggregated counts
+// are sampled once per interval rather than once per call, so use a rate of
+// 1.0 to keep them exact. Currently only supported by the `DataDogClient`.
+func WithClientAggregation(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval < 0 {
+			return errors.New("aggregation interval must not be negative")
+		}
+		o.Aggregation = true
+		o.AggregationInterval = interval
+		return nil
+	}
+}
+
 func resolveOptions(options []Option) (*Options, error) {
 	o := &Options{
 		WithoutTelemetry: false,
+		Rate:             1.0,
+		Random:           rand.Float64,
+		WarningInterval:  defaultWarningInterval,
+		Clock:            time.Now,
 	}
 
 	for _, option := range options {
@@ -48,73 +791,442 @@ func resolveOptions(options []Option) (*Options, error) {
 // the metrics prefix of `namespace`. For example, given a namespace of
 // `foo.bar`, a call to `Incr('baz')` would emit a metric with the full name
 // `foo.bar.baz` (note the period between the namespace and metric name).
+// The namespace is applied natively by the dogstatsd client, before any
+// prefix set via the `WithPrefix` option or method, so the full name is
+// always `namespace.prefix.name`.
+//
+// The address is either a UDP `host:port` or a Unix domain socket path
+// prefixed with `unix://`, e.g. `unix:///var/run/datadog/dsd.socket`. Unix
+// domain sockets are recommended for high-volume services since they apply
+// backpressure instead of silently dropping packets when the agent is busy.
+// A malformed address panics.
+//
+// All configuration is done via options, e.g. `WithInitialTags` for default
+// tags, `WithInitialRate` for the sample rate, and `WithMaxBytesPerPayload`,
+// `WithMaxMessagesPerPayload`, and `WithBufferFlushInterval` for buffering:
+//
+//   client := metrics.NewDataDogClient("127.0.0.1:8125", "myapp",
+//     metrics.WithInitialTags(map[string]string{"env": "prod"}),
+//     metrics.WithMaxBytesPerPayload(8192),
+//   )
 func NewDataDogClient(address string, namespace string, options ...Option) *DataDogClient {
 	o, err := resolveOptions(options)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	var c *statsd.Client
-	if o.WithoutTelemetry {
-		c, err = statsd.New(address, statsd.WithoutTelemetry())
-	} else {
-		c, err = statsd.New(address)
+	if err := validateDataDogAddress(address); err != nil {
+		log.Panic(err)
 	}
+	if o.RequireUnixSocket && !strings.HasPrefix(address, statsd.UnixAddressPrefix) {
+		log.Panicf("a %s address is required, found %q", statsd.UnixAddressPrefix, address)
+	}
+
+	c, err := statsd.New(address, dataDogStatsdOptions(namespace, o)...)
 	if err != nil {
 		log.Panic(err)
 	}
 
+	return newDataDogClient(c, o)
+}
+
+// dataDogStatsdOptions returns the options used to create the underlying
+// statsd client. Unset options keep the statsd defaults.
+func dataDogStatsdOptions(namespace string, o *Options) []statsd.Option {
+	var statsdOptions []statsd.Option
 	if namespace != "" {
-		c.Namespace = namespace + "."
+		statsdOptions = append(statsdOptions, statsd.WithNamespace(namespace+"."))
+	}
+	if o.WithoutTelemetry {
+		statsdOptions = append(statsdOptions, statsd.WithoutTelemetry())
+	}
+	if o.MaxBytesPerPayload > 0 {
+		statsdOptions = append(statsdOptions, statsd.WithMaxBytesPerPayload(o.MaxBytesPerPayload))
+	}
+	if o.MaxMessagesPerPayload > 0 {
+		statsdOptions = append(statsdOptions, statsd.WithMaxMessagesPerPayload(o.MaxMessagesPerPayload))
+	}
+	if o.FlushInterval > 0 {
+		statsdOptions = append(statsdOptions, statsd.WithBufferFlushInterval(o.FlushInterval))
+	}
+	if o.Aggregation {
+		statsdOptions = append(statsdOptions, statsd.WithClientSideAggregation())
+		if o.AggregationInterval > 0 {
+			statsdOptions = append(statsdOptions, statsd.WithAggregationInterval(o.AggregationInterval))
+		}
+	} else {
+		// Unlike older releases, the dogstatsd client aggregates by default.
+		statsdOptions = append(statsdOptions, statsd.WithoutClientSideAggregation())
+	}
+	return statsdOptions
+}
+
+// validateDataDogAddress checks that an address is either a `host:port` with
+// a numeric port or a `unix://` socket path. An empty address is allowed so
+// that the dogstatsd client can detect the agent from the `DD_AGENT_HOST`
+// and `DD_DOGSTATSD_PORT` environment variables.
+func validateDataDogAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	if strings.HasPrefix(address, statsd.UnixAddressPrefix) {
+		if address == statsd.UnixAddressPrefix {
+			return fmt.Errorf("invalid DataDog address %q: missing socket path", address)
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid DataDog address %q: %v", address, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid DataDog address %q: bad port %q", address, port)
 	}
+	return nil
+}
 
+// newDataDogClient creates a new DataDog client which forwards to the given
+// statsd client using the resolved options.
+func newDataDogClient(client statsdClient, o *Options) *DataDogClient {
+	limiter := newCardinalityLimiter(o.TagLimit, o.TagOverflow)
+	warnings := newWarnThrottle(o.WarningInterval)
+	interval := o.GaugeInterval
+	if interval <= 0 {
+		interval = defaultGaugeInterval
+	}
+	tagMap := combine(nil, limiter.limitTags(o.Reserved.checkTags(o.Names.sanitizeTags(redactTags(o.TagRedactor, o.Tags)), warnings)))
 	return &DataDogClient{
-		client: c,
-		rate:   1.0,
+		client:    client,
+		rate:      o.Rate,
+		tagMap:    tagMap,
+		tags:      sortedTags(tagMap, nil),
+		prefix:    o.Prefix,
+		rates:     o.MetricRates,
+		minRates:  o.MinRates,
+		redact:    o.TagRedactor,
+		clashes:   o.TagCollisions,
+		names:     o.Names,
+		stats:     &dataDogStats{},
+		onError:   o.OnError,
+		limiter:   limiter,
+		reserved:  o.Reserved,
+		negative:  o.NegativeChecks,
+		warnings:  warnings,
+		typeTags:  o.TypeTags,
+		now:       o.Clock,
+		batches:   &sync.Mutex{},
+		events:    newEventThrottle(o.EventWindow),
+		fractions: &countFractions{values: map[string]float64{}},
+		gauges:    newObservedGauges(interval, o.Clock),
 	}
 }
 
+// clone returns a shallow copy of this client. The tag map and its sorted
+// `key:value` slice are never modified once a client has been created, so
+// they are safe to share.
+func (c *DataDogClient) clone() *DataDogClient {
+	clone := *c
+	return &clone
+}
+
 // WithRate clones this client with a new sample rate.
 func (c *DataDogClient) WithRate(rate float64) Client {
-	return &DataDogClient{
-		client: c.client,
-		rate:   rate,
-		tags:   c.tags, // clone isn't necessary since original slice is immutable
-	}
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *DataDogClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0 and any
+// per-metric rates set via `WithMetricRate` removed, so that critical metrics
+// are always emitted. Tags and prefix are preserved.
+func (c *DataDogClient) Always() Client {
+	clone := c.clone()
+	clone.rate = 1.0
+	clone.rates = nil
+	return clone
 }
 
 // WithTags clones this client with additional tags. Duplicate tags overwrite
 // the existing value.
 func (c *DataDogClient) WithTags(tags map[string]string) Client {
-	return &DataDogClient{
-		client: c.client,
-		rate:   c.rate,
-		tags:   cloneTagsWithMap(c.tags, tags),
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	added := c.limiter.limitTags(c.reserved.checkTags(c.names.sanitizeTags(redactTags(c.redact, tags)), c.warnings))
+	warnCollisions(c.clashes, c.tagMap, added, c.warnings)
+	clone.tagMap = combine(c.tagMap, added)
+	if len(c.multi) > 0 {
+		keys := make([]string, 0, len(added))
+		for k := range added {
+			keys = append(keys, k)
+		}
+		clone.multi = c.multi.without(keys)
+	}
+	clone.tags = sortedTags(clone.tagMap, clone.multi)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *DataDogClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *DataDogClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *DataDogClient) WithTagValues(key string, values ...string) Client {
+	if len(values) == 0 {
+		return c.WithoutTags(key)
+	}
+	clone := c.WithTag(key, strings.Join(values, tagValueSeparator)).(*DataDogClient)
+	// The joined value has been redacted and sanitized like any other, and
+	// may have been dropped by the cardinality limit.
+	if value, ok := clone.tagMap[key]; ok {
+		clone.multi = clone.multi.with(key, strings.Split(value, tagValueSeparator))
+		clone.tags = sortedTags(clone.tagMap, clone.multi)
+	}
+	return clone
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *DataDogClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *DataDogClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *DataDogClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *DataDogClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	clone.multi = c.multi.without(keys)
+	clone.tags = sortedTags(clone.tagMap, clone.multi)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *DataDogClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions. Counts and gauges are sent via the dogstatsd
+// timestamp API like `GaugeWithTimestamp`. It has no timestamped
+// distributions, so while a timestamp is set those are dropped, counted in
+// `Stats` as dropped, passed to any error handler, and logged once.
+func (c *DataDogClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// WithPrefix clones this client with an additional metric name prefix. The
+// prefix is applied after the statsd namespace, e.g. `namespace.prefix.name`.
+func (c *DataDogClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *DataDogClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+// A batch is handed to the dogstatsd client while holding a lock shared with
+// other batches and then flushed, so that its metrics are packed into as few
+// packets as possible instead of waiting for the buffer flush interval.
+func (c *DataDogClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// sendBatch replays the calls of a batch and flushes the dogstatsd buffer.
+// Flush errors are reported to the `WithErrorHandler` callback.
+func (c *DataDogClient) sendBatch(calls []func(Client)) {
+	if c.batches != nil {
+		c.batches.Lock()
+		defer c.batches.Unlock()
+	}
+	replay(c, calls)
+	if err := c.client.Flush(); err != nil && c.onError != nil {
+		c.onError(err)
 	}
 }
 
 // WithoutTelemetry clones this client with telemetry stats turned off. Underlying
 // DataDog statsd client only supports turning off telemetry, which is on by default.
 func (c *DataDogClient) WithoutTelemetry() Client {
-	s, err := statsd.CloneWithExtraOptions(c.client, statsd.WithoutTelemetry())
+	client, ok := c.client.(*statsd.Client)
+	if !ok {
+		return c.clone()
+	}
+	s, err := statsd.CloneWithExtraOptions(client, statsd.WithoutTelemetry())
 	if err != nil {
 		log.Panic(err)
 	}
-	return &DataDogClient{
-		client: s,
-		rate:   c.rate,
-		tags:   c.tags, // clone isn't necessary since original slice is immutable
+	clone := c.clone()
+	clone.client = s
+	return clone
+}
+
+// prepare returns the full metric name and sample rate to send, and whether
+// the metric should be sent at all.
+func (c *DataDogClient) prepare(name string) (string, float64, bool) {
+	if suppressed() {
+		return "", 0, false
+	}
+	rate := metricRate(c.rates, c.minRates, name, c.rate)
+	if rate <= 0 {
+		return "", 0, false
+	}
+	name, ok := c.names.check(c.prefix+name, c.Tags, c.warnings)
+	return name, rate, ok
+}
+
+// dropStamped reports a distribution made after `WithTimestamp` as
+// unsupported and returns whether it must be dropped.
+func (c *DataDogClient) dropStamped(name string) bool {
+	if c.timestamp.IsZero() {
+		return false
+	}
+	if _, _, ok := c.prepare(name); ok {
+		warnTimestampDropped("the DataDog client", "distributions")
+		c.track(errTimestampUnsupported)
+	}
+	return true
+}
+
+// tagsFor returns the tags to send with a metric of the given type, which
+// include any default tags for the type set via `WithTypeTags`.
+func (c *DataDogClient) tagsFor(metricType string) []string {
+	if _, ok := c.typeTags[metricType]; !ok {
+		return c.tags
+	}
+	return sortedTags(typeTagMap(c.typeTags, metricType, c.tagMap), c.multi)
+}
+
+// dropNegative reports and drops negative values when negative value checks
+// are enabled.
+func (c *DataDogClient) dropNegative(kind string, name string, value float64) bool {
+	if err := checkNegative(c.negative, kind, c.prefix+name, value); err != nil {
+		c.track(err)
+		return true
+	}
+	return false
+}
+
+// track counts the result of handing a call to the underlying client and
+// passes any error to the error handler.
+func (c *DataDogClient) track(err error) {
+	if err != nil {
+		atomic.AddUint64(&c.stats.dropped, 1)
+		if c.onError != nil {
+			c.onError(err)
+		}
+		return
+	}
+	atomic.AddUint64(&c.stats.queued, 1)
+}
+
+// Stats returns counts of the calls queued and dropped by this client and all
+// of its clones, combined with the payloads sent and dropped by the
+// underlying dogstatsd client.
+func (c *DataDogClient) Stats() ClientStats {
+	stats := ClientStats{
+		Queued:  atomic.LoadUint64(&c.stats.queued),
+		Dropped: atomic.LoadUint64(&c.stats.dropped),
+	}
+	if t, ok := c.client.(statsdTelemetry); ok {
+		tlm := t.GetTelemetry()
+		// Calls dropped on receive were accepted without an error.
+		if tlm.TotalDroppedOnReceive < stats.Queued {
+			stats.Queued -= tlm.TotalDroppedOnReceive
+		} else {
+			stats.Queued = 0
+		}
+		stats.Sent = tlm.TotalPayloadsSent
+		stats.Dropped += tlm.TotalDroppedOnReceive + tlm.TotalPayloadsDropped
 	}
+	return stats
+}
+
+// Flush sends any buffered data to the underlying statsd connection.
+func (c *DataDogClient) Flush() error {
+	c.gauges.observeDue()
+	return c.client.Flush()
 }
 
-// Close closes all client connections and flushes any buffered data.
+// Close stops polling registered gauges, then closes all client connections
+// and flushes any buffered data.
 func (c *DataDogClient) Close() error {
+	c.gauges.close()
 	return c.client.Close()
 }
 
+// RegisterGauge registers a callback which is polled on the gauge interval,
+// see `WithGaugeInterval`, and whose result is sent as a gauge with this
+// client's tags and the given tags, e.g. for a queue depth:
+//
+//   client.RegisterGauge("queue.depth", func() float64 {
+//     return float64(queue.Len())
+//   }, map[string]string{"queue": "jobs"})
+//
+// `Flush` also polls the callbacks unless they were polled within the
+// interval according to the client's clock. Registering the same name and
+// tags again replaces the callback. Callbacks run on a background goroutine
+// until `Close` is called, so they must be safe for concurrent use.
+func (c *DataDogClient) RegisterGauge(name string, fn func() float64, tags map[string]string) {
+	client := c.WithTags(tags)
+	c.gauges.register(seriesKey(c.prefix+name, client.Tags()), &observedGauge{
+		client: client,
+		name:   name,
+		fn:     fn,
+	})
+	c.gauges.start()
+}
+
+// UnregisterGauge removes a callback registered via `RegisterGauge` with the
+// same name and tags on a client with the same tags and prefix.
+func (c *DataDogClient) UnregisterGauge(name string, tags map[string]string) {
+	c.gauges.unregister(seriesKey(c.prefix+name, c.WithTags(tags).Tags()))
+}
+
 // Count adds some integer value to a metric.
 func (c *DataDogClient) Count(name string, value int64) {
-	c.client.Count(name, value, c.tags, c.rate)
+	name, rate, ok := c.prepare(name)
+	if !ok {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		c.track(c.client.CountWithTimestamp(name, value, c.tagsFor("count"), rate, c.timestamp))
+		return
+	}
+	c.track(c.client.Count(name, value, c.tagsFor("count"), rate))
 }
 
 // Incr adds one to a metric.
@@ -127,31 +1239,199 @@ func (c *DataDogClient) Decr(name string) {
 	c.Count(name, -1)
 }
 
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call. Per-metric rates set via `WithMetricRate` do not apply.
+func (c *DataDogClient) CountWithRate(name string, value int64, rate float64) {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	clone.rates = nil
+	clone.Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric. The dogstatsd client only
+// supports integer counts, so fractions are accumulated per series and sent
+// as whole units once they add up, e.g. three calls with 0.4 send a count of
+// 1 on the third call and keep 0.2 for later. Nothing is lost to rounding,
+// though a fraction which never adds up to a whole unit is never sent.
+func (c *DataDogClient) CountFloat(name string, value float64) {
+	if suppressed() {
+		return
+	}
+	if whole := c.fractions.add(seriesKey(c.prefix+name, c.tagMap), value); whole != 0 {
+		c.Count(name, whole)
+	}
+}
+
 // Gauge sets a numeric value.
 func (c *DataDogClient) Gauge(name string, value float64) {
-	c.client.Gauge(name, value, c.tags, c.rate)
+	if !c.timestamp.IsZero() {
+		c.GaugeWithTimestamp(name, value, c.timestamp)
+		return
+	}
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.Gauge(name, value, c.tagsFor("gauge"), rate))
+	}
 }
 
-// Event tracks an event that may be relevant to other metrics.
+// GaugeInt sets a numeric integer value.
+func (c *DataDogClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time via the dogstatsd
+// timestamp API, which requires version 7.40.0 or later of the agent.
+// Timestamped values bypass client-side and agent aggregation. A zero
+// timestamp is rejected by the dogstatsd client and passed to any error
+// handler.
+func (c *DataDogClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.GaugeWithTimestamp(name, value, c.tagsFor("gauge"), rate, timestamp))
+	}
+}
+
+// GaugeDelta on the DataDogClient is dropped since DogStatsD does not support
+// relative gauge updates. It is counted in `Stats` as dropped and passed to
+// any error handler.
+func (c *DataDogClient) GaugeDelta(name string, delta float64) {
+	if _, _, ok := c.prepare(name); ok {
+		c.track(errDeltaUnsupported)
+	}
+}
+
+// Set counts the number of unique values for a metric. Like other metrics,
+// it is subject to the client's sample rate.
+func (c *DataDogClient) Set(name string, value string) {
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.Set(name, value, c.tagsFor("set"), rate))
+	}
+}
+
+// Event tracks an event that may be relevant to other metrics. Events are
+// sampled at the client's rate just like metrics. Client tags are merged
+// with the event's own tags, which take precedence for duplicate keys, and
+// duplicate titles are dropped when `WithEventDedupe` is set. The caller's
+// event is never modified.
 func (c *DataDogClient) Event(e *statsd.Event) {
-	if len(c.tags) > 0 {
-		e.Tags = append(e.Tags, c.tags...)
+	if suppressed() {
+		return
+	}
+	if c.rate < 1.0 && rand.Float64() >= c.rate {
+		return
 	}
 
-	c.client.Event(e)
+	dups, ok := c.events.allow(e.Title, c.now())
+	if !ok {
+		return
+	}
+
+	// Send a copy so a caller reusing the event, or a `BufferedClient` still
+	// holding it, never sees the changes.
+	ev := *e
+	if dups > 0 {
+		ev.Text += fmt.Sprintf(" (%d duplicate events suppressed)", dups)
+	}
+	ev.Tags = c.mergeTags(e.Tags)
+
+	c.track(c.client.Event(&ev))
+}
+
+// ServiceCheck reports the status of a service. Client tags are merged with
+// the service check's own tags, which take precedence for duplicate keys.
+// The caller's service check is never modified.
+func (c *DataDogClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	if suppressed() {
+		return
+	}
+	check := *sc
+	check.Tags = c.mergeTags(sc.Tags)
+
+	c.track(c.client.ServiceCheck(&check))
+}
+
+// mergeTags returns a new slice of the client tags combined with the given
+// `key:value` tags of an event or service check, sorted like metric tags.
+// Tags without a colon are kept as they are.
+func (c *DataDogClient) mergeTags(tags []string) []string {
+	if len(c.tagMap) == 0 {
+		return tags
+	}
+	own := make(map[string]string, len(tags))
+	keys := make([]string, 0, len(tags))
+	var bare []string
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			bare = append(bare, tag)
+			continue
+		}
+		own[key] = value
+		keys = append(keys, key)
+	}
+	return append(sortedTags(combine(c.tagMap, own), c.multi.without(keys)), bare...)
 }
 
 // Timing tracks a duration.
 func (c *DataDogClient) Timing(name string, value time.Duration) {
-	c.client.Timing(name, value, c.tags, c.rate)
+	if c.dropNegative("timing", name, float64(value)/float64(time.Millisecond)) {
+		return
+	}
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.Timing(name, value, c.tagsFor("timing"), rate))
+	}
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *DataDogClient) TimingMs(name string, ms float64) {
+	if c.dropNegative("timing", name, ms) {
+		return
+	}
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.TimeInMilliseconds(name, ms, c.tagsFor("timing"), rate))
+	}
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *DataDogClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *DataDogClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *DataDogClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock set via `WithClock`, or `time.Now`.
+func (c *DataDogClient) clock() func() time.Time {
+	if c.now == nil {
+		return time.Now
+	}
+	return c.now
 }
 
 // Histogram sets a numeric value while tracking min/max/avg/p95/etc.
 func (c *DataDogClient) Histogram(name string, value float64) {
-	c.client.Histogram(name, value, c.tags, c.rate)
+	if c.dropNegative("histogram", name, value) {
+		return
+	}
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.Histogram(name, value, c.tagsFor("histogram"), rate))
+	}
 }
 
 // Distribution tracks the statistical distribution of a set of values.
 func (c *DataDogClient) Distribution(name string, value float64) {
-	c.client.Distribution(name, value, c.tags, c.rate)
+	if c.dropStamped(name) {
+		return
+	}
+	if c.dropNegative("distribution", name, value) {
+		return
+	}
+	if name, rate, ok := c.prepare(name); ok {
+		c.track(c.client.Distribution(name, value, c.tagsFor("distribution"), rate))
+	}
 }
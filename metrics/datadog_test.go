@@ -1,12 +1,18 @@
 package metrics_test
 
 import (
+	"bytes"
 	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/istreamlabs/go-metrics/metrics"
 )
 
@@ -14,6 +20,81 @@ type withRater interface {
 	WithRate(rate float64) metrics.Client
 }
 
+// fakeStatsd records the calls forwarded by a DataDog client.
+type fakeStatsd struct {
+	calls     []string
+	events    []statsd.Event
+	flushes   int
+	telemetry statsd.Telemetry
+}
+
+var _ metrics.DogStatsd = &fakeStatsd{}
+
+func (f *fakeStatsd) record(kind, name string, value interface{}, tags []string, rate float64) error {
+	f.calls = append(f.calls, fmt.Sprintf("%s %s:%v %v %v", kind, name, value, tags, rate))
+	return nil
+}
+
+func (f *fakeStatsd) Count(name string, value int64, tags []string, rate float64) error {
+	return f.record("Count", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) Gauge(name string, value float64, tags []string, rate float64) error {
+	return f.record("Gauge", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) GaugeWithTimestamp(name string, value float64, tags []string, rate float64, timestamp time.Time) error {
+	return f.record("GaugeWithTimestamp", name, fmt.Sprintf("%v@%d", value, timestamp.Unix()), tags, rate)
+}
+
+func (f *fakeStatsd) CountWithTimestamp(name string, value int64, tags []string, rate float64, timestamp time.Time) error {
+	return f.record("CountWithTimestamp", name, fmt.Sprintf("%v@%d", value, timestamp.Unix()), tags, rate)
+}
+
+func (f *fakeStatsd) Set(name string, value string, tags []string, rate float64) error {
+	return f.record("Set", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) Histogram(name string, value float64, tags []string, rate float64) error {
+	return f.record("Histogram", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) Distribution(name string, value float64, tags []string, rate float64) error {
+	return f.record("Distribution", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	return f.record("Timing", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
+	return f.record("TimeInMilliseconds", name, value, tags, rate)
+}
+
+func (f *fakeStatsd) Event(e *statsd.Event) error {
+	f.calls = append(f.calls, fmt.Sprintf("Event %s %v", e.Title, e.Tags))
+	f.events = append(f.events, *e)
+	return nil
+}
+
+func (f *fakeStatsd) ServiceCheck(sc *statsd.ServiceCheck) error {
+	f.calls = append(f.calls, fmt.Sprintf("ServiceCheck %s %v", sc.Name, sc.Tags))
+	return nil
+}
+
+func (f *fakeStatsd) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func (f *fakeStatsd) Close() error {
+	return nil
+}
+
+func (f *fakeStatsd) GetTelemetry() statsd.Telemetry {
+	return f.telemetry
+}
+
 func ExampleDataDogClient() {
 	datadog := metrics.NewDataDogClient("127.0.0.1:8125", "myprefix")
 	datadog.WithTags(map[string]string{
@@ -39,8 +120,15 @@ func TestDataDogClient(t *testing.T) {
 
 	datadog.Decr("one")
 	datadog.Gauge("memory", 1024)
+	datadog.GaugeInt("connections", 12)
+	datadog.CountWithRate("sampled", 1, 0.5)
+	datadog.GaugeDelta("connections", 1)
 	datadog.Histogram("histo", 123)
 	datadog.Distribution("distro", 999)
+	datadog.WithPrefix("a.").WithPrefix("b.").Incr("prefixed")
+	datadog.WithTag("tag1", "value1").Incr("tagged")
+	datadog.Set("users", "alice")
+	datadog.Set("users", "bob")
 
 	if rater, ok := datadog.(withRater); ok {
 		ratedClient := rater.WithRate(0.5)
@@ -58,10 +146,9 @@ func TestDataDogClient(t *testing.T) {
 		"tag3": "value3",
 	})
 
-	actual := override.(*metrics.DataDogClient).Tags()
+	actual := override.(*metrics.DataDogClient).TagList()
 	expected := []string{
 		"tag1:override",
-		"tag1:value1",
 		"tag2:value2",
 		"tag3:value3",
 	}
@@ -69,7 +156,15 @@ func TestDataDogClient(t *testing.T) {
 		t.Fatalf("Expected %v to equal %v", actual, expected)
 	}
 
-	// Events should get tags assigned automatically.
+	// The tags accessor resolves overrides to the most recent value.
+	ExpectEqual(t, map[string]string{
+		"tag1": "override",
+		"tag2": "value2",
+		"tag3": "value3",
+	}, override.Tags())
+
+	// Events get tags assigned automatically on the event sent, without
+	// modifying the caller's event.
 	e := &statsd.Event{
 		Title: "Test event",
 	}
@@ -78,11 +173,548 @@ func TestDataDogClient(t *testing.T) {
 		"tag1": "value1",
 	}).Event(e)
 
-	if !reflect.DeepEqual(e.Tags, []string{"tag1:value1"}) {
-		t.Fatalf("Expected event to have tags '[tag1:value1]'. Found '%v'", e.Tags)
+	if len(e.Tags) != 0 {
+		t.Fatalf("Expected the event to be unchanged. Found tags '%v'", e.Tags)
+	}
+
+	// Service checks should get client tags merged with their own.
+	sc := &statsd.ServiceCheck{
+		Name:   "db",
+		Status: statsd.Ok,
+		Tags:   []string{"check:tag"},
+	}
+
+	datadog.WithTags(map[string]string{
+		"tag1": "value1",
+	}).ServiceCheck(sc)
+
+	if !reflect.DeepEqual(sc.Tags, []string{"check:tag"}) {
+		t.Fatalf("Expected the service check to be unchanged. Found tags '%v'", sc.Tags)
 	}
 
+	if err := datadog.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed. Found '%v'", err)
+	}
+
+	datadog.Close()
+}
+
+func TestDataDogClientForwarding(t *testing.T) {
+	fake := &fakeStatsd{}
+	datadog := metrics.NewDataDogClientWithStatsd(fake,
+		metrics.WithInitialTags(map[string]string{"env": "prod"}),
+		metrics.WithMetricRate("sampled", 0.25),
+	)
+
+	client := datadog.WithPrefix("app.").WithTags(map[string]string{
+		"tag2": "value2",
+		"env":  "staging",
+	})
+	client.Incr("one")
+	client.Count("sampled", 3)
+	client.CountFloat("rounded", 2.5)
+	client.WithRate(0.5).Gauge("memory", 1024)
+	client.GaugeDelta("memory", 1)
+	client.Set("users", "alice")
+	client.Timing("timing", time.Second)
+	client.TimingMs("timing.ms", 2.5)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.WithRate(0).Incr("never")
+	client.Event(&statsd.Event{Title: "event", Tags: []string{"event:tag"}})
+	client.ServiceCheck(&statsd.ServiceCheck{Name: "check"})
+
+	ExpectEqual(t, []string{
+		"Count app.one:1 [env:staging tag2:value2] 1",
+		"Count app.sampled:3 [env:staging tag2:value2] 0.25",
+		"Count app.rounded:2 [env:staging tag2:value2] 1",
+		"Gauge app.memory:1024 [env:staging tag2:value2] 0.5",
+		"Set app.users:alice [env:staging tag2:value2] 1",
+		"Timing app.timing:1s [env:staging tag2:value2] 1",
+		"TimeInMilliseconds app.timing.ms:2.5 [env:staging tag2:value2] 1",
+		"Histogram app.histo:123 [env:staging tag2:value2] 1",
+		"Distribution app.distro:999 [env:staging tag2:value2] 1",
+		"Event event [env:staging event:tag tag2:value2]",
+		"ServiceCheck check [env:staging tag2:value2]",
+	}, fake.calls)
+
+	// Always drops both the client and per-metric rates.
+	fake.calls = nil
+	client.WithRate(0.01).Always().Count("sampled", 1)
+	ExpectEqual(t, []string{"Count app.sampled:1 [env:staging tag2:value2] 1"}, fake.calls)
+
+	// Timestamps are passed through to the dogstatsd timestamp API.
+	fake.calls = nil
+	client.GaugeWithTimestamp("backfill", 5, time.Unix(1500000000, 0))
+	ExpectEqual(t, []string{"GaugeWithTimestamp app.backfill:5@1500000000 [env:staging tag2:value2] 1"}, fake.calls)
+
+	// Telemetry cannot be turned off on a fake, so the client is just cloned.
+	datadog.WithoutTelemetry().Incr("one")
+	ExpectEqual(t, "Count one:1 [env:prod] 1", fake.calls[len(fake.calls)-1])
+}
+
+func TestDataDogClientWithTimestamp(t *testing.T) {
+	fake := &fakeStatsd{}
+	var errs []error
+	datadog := metrics.NewDataDogClientWithStatsd(fake, metrics.WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+	metrics.ResetTimestampWarnings()
+
+	// Stamped counts and gauges are sent via the timestamp API, while
+	// distributions cannot be, so they are dropped rather than sent at the
+	// ingestion time.
+	stamped := datadog.WithTimestamp(time.Unix(1500000000, 0))
+	stamped.Incr("one")
+	stamped.GaugeInt("two", 2)
+	stamped.Distribution("three", 3)
+	stamped.Distribution("three", 3)
+	stamped.Histogram("four", 4)
+	stamped.WithTimestamp(time.Time{}).Incr("five")
+
+	ExpectEqual(t, []string{
+		"CountWithTimestamp one:1@1500000000 [] 1",
+		"GaugeWithTimestamp two:2@1500000000 [] 1",
+		"Histogram four:4 [] 1",
+		"Count five:1 [] 1",
+	}, fake.calls)
+	ExpectEqual(t, metrics.ClientStats{Queued: 4, Dropped: 2}, datadog.Stats())
+	ExpectEqual(t, 2, len(errs))
+	ExpectEqual(t, 1, strings.Count(warnings.String(), "does not support timestamped distributions"))
+}
+
+func TestDataDogClientGaugeDelta(t *testing.T) {
+	fake := &fakeStatsd{}
+	var errs []error
+	datadog := metrics.NewDataDogClientWithStatsd(fake, metrics.WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	// Deltas cannot be sent, so they are dropped rather than silently ignored.
+	datadog.GaugeDelta("queue.depth", 1)
+	datadog.WithRate(0).GaugeDelta("sampled", 1)
+
+	ExpectEqual(t, 0, len(fake.calls))
+	ExpectEqual(t, metrics.ClientStats{Dropped: 1}, datadog.Stats())
+	ExpectEqual(t, 1, len(errs))
+}
+
+func TestDataDogClientOptions(t *testing.T) {
+	datadog := metrics.NewDataDogClient("127.0.0.1:8126", "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithInitialTags(map[string]string{
+			"tag1": "value1",
+		}),
+		metrics.WithInitialRate(0.5),
+		metrics.WithMetricRate("error.count", 1.0),
+		metrics.WithPrefix("prefix."),
+	)
+	defer datadog.Close()
+
+	ExpectEqual(t, []string{"tag1:value1"}, datadog.TagList())
+	ExpectEqual(t, 0.5, datadog.MetricRate("other"))
+	ExpectEqual(t, 1.0, datadog.MetricRate("error.count"))
+
+	sanitized := metrics.NewDataDogClient("127.0.0.1:8126", "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithSanitizedNames(),
+	)
+	defer sanitized.Close()
+	ExpectEqual(t, []string{"bad_key:a_b"}, sanitized.WithTag("bad key", "a|b").(*metrics.DataDogClient).TagList())
+
+	// Minimum rates raise both the client rate and per-metric rates.
+	floored := metrics.NewDataDogClient("127.0.0.1:8126", "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithMetricRate("error.count", 0.1),
+		metrics.WithMinRate("error.count", 0.5),
+		metrics.WithMinRate("request.count", 0.25),
+	).WithRate(0.01).(*metrics.DataDogClient)
+	ExpectEqual(t, 0.5, floored.MetricRate("error.count"))
+	ExpectEqual(t, 0.25, floored.MetricRate("request.count"))
+	ExpectEqual(t, 0.01, floored.MetricRate("other"))
+
+	// Per-metric rates are kept when cloning.
+	cloned := datadog.WithTag("tag2", "value2").WithRate(0.2).(*metrics.DataDogClient)
+	ExpectEqual(t, 0.2, cloned.MetricRate("other"))
+	ExpectEqual(t, 1.0, cloned.MetricRate("error.count"))
+}
+
+func TestDataDogClientBuffering(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithMaxBytesPerPayload(512),
+		metrics.WithBufferFlushInterval(10*time.Millisecond),
+	)
+	defer datadog.Close()
+
+	// Buffered metrics are sent on the flush interval without calling Flush.
+	datadog.Incr("one")
+	ExpectEqual(t, []string{"testing.one:1|c"}, readStatsd(t, server))
+}
+
+func TestDataDogClientGaugeWithTimestamp(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing", metrics.WithoutTelemetry())
+	defer datadog.Close()
+
+	datadog.GaugeWithTimestamp("backfill", 5, time.Unix(1500000000, 0))
+	datadog.Flush()
+
+	ExpectEqual(t, []string{"testing.backfill:5|g|T1500000000"}, readStatsd(t, server))
+}
+
+func TestDataDogClientStatsdOptions(t *testing.T) {
+	resolved := metrics.DataDogStatsdOptions("testing",
+		metrics.WithMaxBytesPerPayload(512),
+		metrics.WithMaxMessagesPerPayload(16),
+		metrics.WithBufferFlushInterval(10*time.Millisecond),
+	)
+	ExpectEqual(t, "testing.", resolved.Namespace)
+	ExpectEqual(t, 512, resolved.MaxBytesPerPayload)
+	ExpectEqual(t, 16, resolved.MaxMessagesPerPayload)
+	ExpectEqual(t, 10*time.Millisecond, resolved.BufferFlushInterval)
+
+	// Unset options are left for statsd to default.
+	resolved = metrics.DataDogStatsdOptions("")
+	ExpectEqual(t, 0, resolved.MaxMessagesPerPayload)
+	ExpectEqual(t, time.Duration(0), resolved.BufferFlushInterval)
+
+	// Client-side aggregation is only enabled via `WithClientAggregation`.
+	resolved = metrics.DataDogStatsdOptions("", metrics.WithClientAggregation(time.Second))
+	ExpectEqual(t, true, resolved.Aggregation)
+}
+
+func TestDataDogClientRegisterGauge(t *testing.T) {
+	fake := &fakeStatsd{}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := metrics.NewDataDogClientWithStatsd(fake,
+		metrics.WithGaugeInterval(time.Minute),
+		metrics.WithClock(func() time.Time { return now }),
+	)
+	defer client.Close()
+
+	depth := 3.0
+	client.WithTag("env", "test").(*metrics.DataDogClient).RegisterGauge("queue.depth", func() float64 {
+		return depth
+	}, map[string]string{"queue": "jobs"})
+
+	// The callback is polled at most once per interval.
+	client.Flush()
+	depth = 5
+	client.Flush()
+	ExpectEqual(t, []string{"Gauge queue.depth:3 [env:test queue:jobs] 1"}, fake.calls)
+
+	now = now.Add(time.Minute)
+	client.Flush()
+	ExpectEqual(t, "Gauge queue.depth:5 [env:test queue:jobs] 1", fake.calls[1])
+
+	client.WithTag("env", "test").(*metrics.DataDogClient).UnregisterGauge("queue.depth", map[string]string{"queue": "jobs"})
+	now = now.Add(time.Minute)
+	client.Flush()
+	ExpectEqual(t, 2, len(fake.calls))
+}
+
+func TestDataDogClientRegisterGaugeInterval(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithBufferFlushInterval(time.Millisecond),
+		metrics.WithGaugeInterval(10*time.Millisecond),
+		metrics.WithClock(func() time.Time { return time.Time{}.Add(time.Hour) }),
+	)
+	defer datadog.Close()
+
+	// Callbacks are polled in the background on every tick without calling
+	// Flush, even when the clock says the interval has not passed.
+	datadog.RegisterGauge("queue.depth", func() float64 { return 3 }, nil)
+	ExpectEqual(t, "testing.queue.depth:3|g", readStatsd(t, server)[0])
+	datadog.Flush()
+	ExpectEqual(t, "testing.queue.depth:3|g", readStatsd(t, server)[0])
+}
+
+func TestDataDogClientAggregation(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithClientAggregation(time.Hour),
+	)
+
+	// Many increments of the same series are sent as a single count, which
+	// is sent on close at the latest.
+	for i := 0; i < 1000; i++ {
+		datadog.WithTag("tag1", "value1").Incr("hot")
+	}
 	datadog.Close()
+	ExpectEqual(t, []string{"testing.hot:1000|c|#tag1:value1"}, readStatsd(t, server))
+}
+
+func TestDataDogClientInvalidOptions(t *testing.T) {
+	invalid := map[string]func(){
+		"missing port": func() { metrics.NewDataDogClient("127.0.0.1", "testing") },
+		"bad port":     func() { metrics.NewDataDogClient("127.0.0.1:http", "testing") },
+		"large port":   func() { metrics.NewDataDogClient("127.0.0.1:99999", "testing") },
+		"empty socket": func() { metrics.NewDataDogClient("unix://", "testing") },
+		"unix socket required": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithUnixSocketRequired())
+		},
+		"max bytes": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithMaxBytesPerPayload(0))
+		},
+		"max messages": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithMaxMessagesPerPayload(-1))
+		},
+		"event dedupe": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithEventDedupe(0))
+		},
+		"tag redactor": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithTagRedactor(nil))
+		},
+		"flush interval": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithBufferFlushInterval(0))
+		},
+		"gauge interval": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithGaugeInterval(0))
+		},
+		"aggregation interval": func() {
+			metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithClientAggregation(-1))
+		},
+	}
+
+	for name, construct := range invalid {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); err == nil {
+					t.Fatalf("Expected %s to panic", name)
+				}
+			}()
+			construct()
+		})
+	}
+}
+
+func TestDataDogClientUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dsd.socket")
+	server, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Expected Unix socket listener to start. Found '%v'", err)
+	}
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient("unix://"+path, "testing", metrics.WithoutTelemetry())
+	defer datadog.Close()
+
+	datadog.WithTag("tag1", "value1").Incr("one")
+	datadog.Flush()
+
+	ExpectEqual(t, []string{"testing.one:1|c|#tag1:value1"}, readStatsd(t, server))
+}
+
+func TestDataDogClientUnixSocketRequired(t *testing.T) {
+	t.Setenv("DD_ENTITY_ID", "pod-uid")
+
+	path := filepath.Join(t.TempDir(), "dsd.socket")
+	server, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Expected Unix socket listener to start. Found '%v'", err)
+	}
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient("unix://"+path, "testing", metrics.WithoutTelemetry(), metrics.WithUnixSocketRequired())
+	defer datadog.Close()
+
+	datadog.WithTag("tag1", "value1").Incr("one")
+	datadog.Flush()
+
+	ExpectEqual(t, []string{"testing.one:1|c|#dd.internal.entity_id:pod-uid,tag1:value1"}, readStatsd(t, server))
+}
+
+func TestDataDogClientSampleRate(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing", metrics.WithoutTelemetry())
+	defer datadog.Close()
+
+	// The rate is sent along exactly once per metric, so the agent can
+	// extrapolate without double counting.
+	rated := datadog.WithRate(0.999999999)
+	rated.Histogram("histo", 123)
+	datadog.Flush()
+	ExpectEqual(t, []string{"testing.histo:123|h|@0.999999999"}, readStatsd(t, server))
+
+	rated.Timing("timing", 1500*time.Microsecond)
+	datadog.Flush()
+	ExpectEqual(t, []string{"testing.timing:1.500000|ms|@0.999999999"}, readStatsd(t, server))
+
+	datadog.Histogram("unsampled", 1)
+	datadog.Flush()
+	ExpectEqual(t, []string{"testing.unsampled:1|h"}, readStatsd(t, server))
+}
+
+func TestDataDogClientNamespace(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "namespace",
+		metrics.WithoutTelemetry(),
+		metrics.WithPrefix("option."),
+	)
+	defer datadog.Close()
+
+	// The namespace always comes first, followed by any prefixes in the
+	// order they were added.
+	datadog.WithPrefix("method.").Incr("one")
+	datadog.Flush()
+	ExpectEqual(t, []string{"namespace.option.method.one:1|c"}, readStatsd(t, server))
+
+	unprefixed := metrics.NewDataDogClient(server.LocalAddr().String(), "", metrics.WithoutTelemetry())
+	defer unprefixed.Close()
+	unprefixed.Incr("one")
+	unprefixed.Flush()
+	ExpectEqual(t, []string{"one:1|c"}, readStatsd(t, server))
+}
+
+func TestDataDogClientEventTags(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing", metrics.WithoutTelemetry())
+	defer datadog.Close()
+
+	// Client tags are sent along with the event's own tags so events can be
+	// filtered the same way as metrics.
+	e := statsd.NewEvent("deploy", "desc")
+	e.Tags = []string{"event:tag"}
+	datadog.WithTags(map[string]string{
+		"tag2": "value2",
+		"tag1": "value1",
+	}).Event(e)
+	datadog.Flush()
+
+	ExpectEqual(t, []string{"_e{6,4}:deploy|desc|#event:tag,tag1:value1,tag2:value2"}, readStatsd(t, server))
+}
+
+func TestDataDogClientCountFloat(t *testing.T) {
+	fake := &fakeStatsd{}
+	client := metrics.NewDataDogClientWithStatsd(fake)
+
+	// Fractions are kept per series and sent once they add up to a whole
+	// unit, rather than each call being rounded to zero.
+	for i := 0; i < 3; i++ {
+		client.CountFloat("bytes", 0.4)
+		client.WithTag("tag1", "value1").CountFloat("bytes", 0.5)
+	}
+	ExpectEqual(t, []string{
+		"Count bytes:1 [tag1:value1] 1",
+		"Count bytes:1 [] 1",
+	}, fake.calls)
+
+	client.CountFloat("bytes", 2.9)
+	client.CountFloat("bytes", -4.5)
+	ExpectEqual(t, []string{
+		"Count bytes:1 [tag1:value1] 1",
+		"Count bytes:1 [] 1",
+		"Count bytes:3 [] 1",
+		"Count bytes:-4 [] 1",
+	}, fake.calls)
+}
+
+func TestDataDogClientMergeTags(t *testing.T) {
+	fake := &fakeStatsd{}
+	client := metrics.NewDataDogClientWithStatsd(fake).WithTags(map[string]string{"a": "b", "x": "client"})
+
+	// Client tags are merged with the check's own tags, which override
+	// duplicate keys, and reusing a check or event sends the same tags.
+	sc := &statsd.ServiceCheck{Name: "db", Status: statsd.Ok, Tags: []string{"x:y", "canary"}}
+	client.ServiceCheck(sc)
+	client.ServiceCheck(sc)
+	e := &statsd.Event{Title: "deploy", Tags: []string{"x:y"}}
+	client.Event(e)
+	client.Event(e)
+
+	ExpectEqual(t, []string{
+		"ServiceCheck db [a:b x:y canary]",
+		"ServiceCheck db [a:b x:y canary]",
+		"Event deploy [a:b x:y]",
+		"Event deploy [a:b x:y]",
+	}, fake.calls)
+	ExpectEqual(t, []string{"x:y", "canary"}, sc.Tags)
+	ExpectEqual(t, []string{"x:y"}, e.Tags)
+}
+
+func TestDataDogClientEventDedupe(t *testing.T) {
+	fake := &fakeStatsd{}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := metrics.NewDataDogClientWithStatsd(fake,
+		metrics.WithEventDedupe(time.Minute),
+		metrics.WithClock(func() time.Time { return now }),
+	)
+
+	// Identical events within the window are only forwarded once, even from
+	// a clone of the client.
+	for i := 0; i < 100; i++ {
+		client.WithTag("attempt", "retry").Event(statsd.NewEvent("db down", "connection refused"))
+	}
+	client.Event(statsd.NewEvent("db slow", "high latency"))
+	ExpectEqual(t, []string{
+		"Event db down [attempt:retry]",
+		"Event db slow []",
+	}, fake.calls)
+
+	// The first event after the window notes the dropped duplicates on the
+	// event sent, leaving the caller's event unchanged so it can be reused.
+	now = now.Add(time.Minute)
+	e := statsd.NewEvent("db down", "connection refused")
+	client.Event(e)
+	client.Event(e)
+	now = now.Add(time.Minute)
+	client.Event(e)
+	ExpectEqual(t, 4, len(fake.calls))
+	ExpectEqual(t, "connection refused (99 duplicate events suppressed)", fake.events[2].Text)
+	ExpectEqual(t, "connection refused (1 duplicate events suppressed)", fake.events[3].Text)
+	ExpectEqual(t, "connection refused", e.Text)
+
+	// Events are not deduplicated by default.
+	fake = &fakeStatsd{}
+	client = metrics.NewDataDogClientWithStatsd(fake)
+	client.Event(statsd.NewEvent("db down", ""))
+	client.Event(statsd.NewEvent("db down", ""))
+	ExpectEqual(t, 2, len(fake.calls))
+}
+
+func TestDataDogClientDefaultTagPrecedence(t *testing.T) {
+	datadog := metrics.NewDataDogClient("127.0.0.1:8126", "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithInitialTags(map[string]string{
+			"env":    "prod",
+			"region": "us-west-2",
+		}),
+	)
+	defer datadog.Close()
+
+	ExpectEqual(t, []string{"env:prod", "region:us-west-2"}, datadog.TagList())
+
+	override := datadog.WithTag("env", "staging").(*metrics.DataDogClient)
+	ExpectEqual(t, []string{"env:staging", "region:us-west-2"}, override.TagList())
+
+	stripped := override.WithoutTags("region").(*metrics.DataDogClient)
+	ExpectEqual(t, []string{"env:staging"}, stripped.TagList())
+
+	// The root client keeps its defaults.
+	ExpectEqual(t, []string{"env:prod", "region:us-west-2"}, datadog.TagList())
 }
 
 func Benchmark_0Tags_100Emits(b *testing.B) {
@@ -113,6 +745,34 @@ func BenchmarkTags_15Tags_100Emits_WithInline(b *testing.B) {
 	benchmarkClient(b, 15, 100, true)
 }
 
+// BenchmarkDataDogTagSlice compares emitting with the tag slice cached on the
+// client against rebuilding it from the tag map on every call.
+func BenchmarkDataDogTagSlice(b *testing.B) {
+	datadog := metrics.NewDataDogClient("127.0.0.1:8126", "testing", metrics.WithoutTelemetry())
+	defer datadog.Close()
+
+	tags := map[string]string{}
+	for i := 0; i < 10; i++ {
+		tags[fmt.Sprintf("tag-%v", i)] = fmt.Sprintf("value-%v", i)
+	}
+	cli := datadog.WithTags(tags).WithRate(0.5)
+
+	b.Run("Cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cli.Count("count", 1)
+		}
+	})
+
+	b.Run("Rebuilt", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			metrics.SortedTags(tags, nil)
+			cli.Count("count", 1)
+		}
+	})
+}
+
 func benchmarkClient(b *testing.B, numTags, numMetrics int, inlineTags bool) {
 	var datadog metrics.Client
 	datadog = metrics.NewDataDogClient("127.0.0.1:8126", "testing")
@@ -136,3 +796,183 @@ func benchmarkClient(b *testing.B, numTags, numMetrics int, inlineTags bool) {
 		}
 	}
 }
+
+func TestDataDogClientStats(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing")
+	defer datadog.Close()
+
+	datadog.Incr("one")
+	datadog.WithTag("tag1", "value1").Gauge("memory", 1024)
+	datadog.Event(statsd.NewEvent("title", "desc"))
+
+	// Metrics which cannot fit into a single packet are rejected.
+	datadog.Incr(strings.Repeat("a", 2000))
+
+	// Metrics which are never handed to the dogstatsd client are not counted.
+	datadog.WithRate(0).Incr("never")
+
+	ExpectEqual(t, metrics.ClientStats{Queued: 3, Dropped: 1}, datadog.Stats())
+
+	// Payloads are counted once they have been written.
+	datadog.Flush()
+	if stats := datadog.Stats(); stats.Sent == 0 {
+		t.Errorf("Expected sent payloads, got %+v", stats)
+	}
+}
+
+func TestDataDogClientStatsTelemetry(t *testing.T) {
+	fake := &fakeStatsd{}
+	datadog := metrics.NewDataDogClientWithStatsd(fake)
+
+	for i := 0; i < 5; i++ {
+		datadog.Incr("one")
+	}
+
+	// Calls dropped after being queued are reported by the dogstatsd client.
+	fake.telemetry = statsd.Telemetry{
+		TotalDroppedOnReceive: 1,
+		TotalPayloadsSent:     2,
+		TotalPayloadsDropped:  3,
+	}
+
+	ExpectEqual(t, metrics.ClientStats{Queued: 4, Sent: 2, Dropped: 4}, datadog.Stats())
+}
+
+func TestDataDogClientErrorHandler(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	var errs []error
+	datadog := metrics.NewDataDogClient(server.LocalAddr().String(), "testing",
+		metrics.WithoutTelemetry(),
+		metrics.WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+	defer datadog.Close()
+
+	datadog.Incr("one")
+	datadog.WithTag("tag1", "value1").Incr(strings.Repeat("a", 2000))
+
+	ExpectEqual(t, 1, len(errs))
+}
+
+func TestDataDogClientClone(t *testing.T) {
+	datadog := metrics.NewDataDogClient("127.0.0.1:8125", "testing", metrics.WithoutTelemetry())
+	defer datadog.Close()
+
+	parent := datadog.WithTag("tag1", "value1")
+	clone := parent.Clone().WithTag("tag2", "value2")
+
+	ExpectEqual(t, []string{"tag1:value1"}, parent.(*metrics.DataDogClient).TagList())
+	ExpectEqual(t, []string{"tag1:value1", "tag2:value2"}, clone.(*metrics.DataDogClient).TagList())
+}
+
+func TestDataDogClientNegativeValues(t *testing.T) {
+	var errs []string
+	fake := &fakeStatsd{}
+	client := metrics.NewDataDogClientWithStatsd(fake,
+		metrics.WithNegativeValueChecks(),
+		metrics.WithErrorHandler(func(err error) {
+			errs = append(errs, err.Error())
+		}),
+	)
+
+	client.Timing("timing", -time.Second)
+	client.TimingMs("timing.ms", -1)
+	client.Histogram("histo", -1)
+	client.Distribution("distro", -1)
+	client.Gauge("gauge", -1)
+	client.Histogram("histo", 0)
+
+	ExpectEqual(t, []string{
+		"Gauge gauge:-1 [] 1",
+		"Histogram histo:0 [] 1",
+	}, fake.calls)
+	ExpectEqual(t, []string{
+		`metrics: dropping negative timing value -1000 for "timing"`,
+		`metrics: dropping negative timing value -1 for "timing.ms"`,
+		`metrics: dropping negative histogram value -1 for "histo"`,
+		`metrics: dropping negative distribution value -1 for "distro"`,
+	}, errs)
+	ExpectEqual(t, uint64(4), client.Stats().Dropped)
+
+	// Without the option, negative values are sent as-is.
+	fake.calls = nil
+	metrics.NewDataDogClientWithStatsd(fake).Histogram("histo", -1)
+	ExpectEqual(t, []string{"Histogram histo:-1 [] 1"}, fake.calls)
+}
+
+func TestDataDogClientTagValues(t *testing.T) {
+	fake := &fakeStatsd{}
+	client := metrics.NewDataDogClientWithStatsd(fake).WithTag("tag1", "value1")
+
+	teams := client.WithTagValues("team", "search", "ads")
+	teams.Incr("one")
+	teams.WithTag("team", "infra").Incr("two")
+	teams.WithTagValues("team").Incr("three")
+	teams.Event(&statsd.Event{Title: "event"})
+
+	// A single value containing a comma is still a single tag.
+	client.WithTag("query", "a,b").Incr("four")
+
+	ExpectEqual(t, []string{
+		"Count one:1 [tag1:value1 team:ads team:search] 1",
+		"Count two:1 [tag1:value1 team:infra] 1",
+		"Count three:1 [tag1:value1] 1",
+		"Event event [tag1:value1 team:ads team:search]",
+		"Count four:1 [query:a_b tag1:value1] 1",
+	}, fake.calls)
+	ExpectEqual(t, map[string]string{"tag1": "value1", "team": "search,ads"}, teams.Tags())
+}
+
+func TestDataDogClientTagOrder(t *testing.T) {
+	first := &fakeStatsd{}
+	metrics.NewDataDogClientWithStatsd(first).
+		WithTag("env", "prod").
+		WithTag("env-region", "us").
+		WithTagValues("team", "search", "ads").
+		WithTag("app", "api").
+		Incr("requests")
+
+	second := &fakeStatsd{}
+	metrics.NewDataDogClientWithStatsd(second).
+		WithTag("app", "api").
+		WithTagValues("team", "ads", "search").
+		WithTags(map[string]string{"env-region": "us", "env": "prod"}).
+		Incr("requests")
+
+	// Identical tag sets produce identical slices, sorted by key and then by
+	// value, no matter the order they were added in.
+	ExpectEqual(t, []string{
+		"Count requests:1 [app:api env:prod env-region:us team:ads team:search] 1",
+	}, first.calls)
+	ExpectEqual(t, first.calls, second.calls)
+}
+
+func TestDataDogClientTypeTags(t *testing.T) {
+	fake := &fakeStatsd{}
+	client := metrics.NewDataDogClientWithStatsd(fake,
+		metrics.WithTypeTags("timing", map[string]string{"unit": "ms"}),
+		metrics.WithTypeTags("count", map[string]string{"kind": "counter"}),
+		metrics.WithTypeTags("count", map[string]string{"tag1": "default"}),
+	).WithTag("tag1", "value1")
+
+	client.Incr("one")
+	client.Timing("timing", time.Second)
+	client.TimingMs("timing.ms", 2.5)
+	client.Gauge("gauge", 1)
+	client.Event(&statsd.Event{Title: "event"})
+
+	ExpectEqual(t, []string{
+		"Count one:1 [kind:counter tag1:value1] 1",
+		"Timing timing:1s [tag1:value1 unit:ms] 1",
+		"TimeInMilliseconds timing.ms:2.5 [tag1:value1 unit:ms] 1",
+		"Gauge gauge:1 [tag1:value1] 1",
+		"Event event [tag1:value1]",
+	}, fake.calls)
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, client.Tags())
+}
@@ -1,9 +1,86 @@
 package metrics
 
-import "sort"
+import (
+	"reflect"
+	"sort"
+	"time"
 
-// Tags returns the internal tag list from a DataDog client instance.
-func (c *DataDogClient) Tags() []string {
-	sort.Strings(c.tags)
-	return c.tags
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// TagList returns a sorted copy of the internal tag list from a DataDog
+// client instance.
+func (c *DataDogClient) TagList() []string {
+	tags := make([]string, len(c.tags))
+	copy(tags, c.tags)
+	sort.Strings(tags)
+	return tags
+}
+
+// MetricRate returns the sample rate used by a DataDog client instance for
+// the given metric name.
+func (c *DataDogClient) MetricRate(name string) float64 {
+	return metricRate(c.rates, c.minRates, name, c.rate)
+}
+
+// Combine exposes the tag map combine helper for benchmarks.
+var Combine = combine
+
+// SortedTags exposes the DataDog tag slice formatting helper for benchmarks.
+var SortedTags = sortedTags
+
+// ResetTimestampWarnings forgets which timestamp drops have been logged, so
+// tests can assert the warning regardless of test order.
+func ResetTimestampWarnings() {
+	timestampWarnings.Range(func(key, _ interface{}) bool {
+		timestampWarnings.Delete(key)
+		return true
+	})
+}
+
+// DogStatsd exposes the dogstatsd interface used by the DataDog client so
+// tests can implement a fake.
+type DogStatsd = statsdClient
+
+// NewDataDogClientWithStatsd creates a DataDog client which forwards to the
+// given statsd client, so tests can assert the exact calls made.
+func NewDataDogClientWithStatsd(client DogStatsd, options ...Option) *DataDogClient {
+	o, err := resolveOptions(options)
+	if err != nil {
+		panic(err)
+	}
+	return newDataDogClient(client, o)
+}
+
+// StatsdOptions holds the statsd client settings asserted by tests, which
+// the statsd package does not export.
+type StatsdOptions struct {
+	Namespace             string
+	MaxBytesPerPayload    int
+	MaxMessagesPerPayload int
+	BufferFlushInterval   time.Duration
+	Aggregation           bool
+}
+
+// DataDogStatsdOptions applies the options which a DataDog client passes to
+// the underlying statsd client to an empty config.
+func DataDogStatsdOptions(namespace string, options ...Option) StatsdOptions {
+	o, err := resolveOptions(options)
+	if err != nil {
+		panic(err)
+	}
+	var resolved statsd.Options
+	for _, option := range dataDogStatsdOptions(namespace, o) {
+		if err := option(&resolved); err != nil {
+			panic(err)
+		}
+	}
+	v := reflect.ValueOf(resolved)
+	return StatsdOptions{
+		Namespace:             v.FieldByName("namespace").String(),
+		MaxBytesPerPayload:    int(v.FieldByName("maxBytesPerPayload").Int()),
+		MaxMessagesPerPayload: int(v.FieldByName("maxMessagesPerPayload").Int()),
+		BufferFlushInterval:   time.Duration(v.FieldByName("bufferFlushInterval").Int()),
+		Aggregation:           v.FieldByName("aggregation").Bool(),
+	}
 }
@@ -0,0 +1,409 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// expvarMutex guards publishing new vars, since `expvar.Publish` panics if
+// the name is already in use.
+var expvarMutex sync.Mutex
+
+// expvarSummary is an expvar var which tracks summary statistics for
+// timings, histograms, and distributions. It is published as a JSON object
+// like `{"count":3,"sum":9,"min":1,"max":5,"avg":3}`.
+type expvarSummary struct {
+	mutex sync.Mutex
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (s *expvarSummary) observe(value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.sum += value
+	s.count++
+}
+
+func (s *expvarSummary) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	avg := 0.0
+	if s.count > 0 {
+		avg = s.sum / float64(s.count)
+	}
+	encoded, _ := json.Marshal(map[string]interface{}{
+		"count": s.count,
+		"sum":   s.sum,
+		"min":   s.min,
+		"max":   s.max,
+		"avg":   avg,
+	})
+	return string(encoded)
+}
+
+// expvarSet is an expvar var which counts the number of unique values.
+type expvarSet struct {
+	mutex  sync.Mutex
+	values map[string]struct{}
+}
+
+func (s *expvarSet) add(value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.values[value] = struct{}{}
+}
+
+func (s *expvarSet) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return strconv.Itoa(len(s.values))
+}
+
+// ExpvarClient publishes metrics via the standard library `expvar` package,
+// which makes them visible at `/debug/vars` without any other dependencies:
+//
+//   client := metrics.NewExpvarClient()
+//   http.ListenAndServe(":8080", nil) // expvar registers on the default mux
+//
+// Each unique combination of metric name and tags is published as its own
+// var named like `requests.count[tag1:value1 tag2:value2]`, with the tags in
+// sorted order. Counts are published as an `expvar.Int`, gauges as an
+// `expvar.Float`, and sets as the number of unique values. Timings,
+// histograms, and distributions are published as summary statistics, with
+// timings in milliseconds.
+//
+// Since expvar vars are process-global, an existing var with the same name is
+// reused, so multiple clients write to the same vars. Calls for a name which
+// is already published as a different kind of var are dropped. Events and
+// service checks are ignored. The sample rate is ignored since values are
+// aggregated in-process, except that a rate of zero drops everything.
+type ExpvarClient struct {
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewExpvarClient creates a new expvar client.
+func NewExpvarClient() *ExpvarClient {
+	return &ExpvarClient{
+		rate: 1.0,
+	}
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *ExpvarClient) clone() *ExpvarClient {
+	clone := *c
+	return &clone
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *ExpvarClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	clone.tagMap = combine(c.tagMap, tags)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *ExpvarClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *ExpvarClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *ExpvarClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *ExpvarClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *ExpvarClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *ExpvarClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *ExpvarClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *ExpvarClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions. Like `GaugeWithTimestamp`, those calls are not
+// supported and are dropped while a timestamp is set, since expvar only
+// publishes the current value. The first dropped call of each kind is logged.
+func (c *ExpvarClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *ExpvarClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *ExpvarClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *ExpvarClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *ExpvarClient) WithRate(rate float64) Client {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *ExpvarClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *ExpvarClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
+// publish returns the existing var for a metric name using the client's
+// tags, or publishes the one returned by `create`. It returns nil if the
+// rate is zero.
+func (c *ExpvarClient) publish(name string, create func() expvar.Var) expvar.Var {
+	if c.rate <= 0 {
+		return nil
+	}
+
+	key := seriesKey(c.prefix+name, c.tagMap)
+	if v := expvar.Get(key); v != nil {
+		return v
+	}
+
+	expvarMutex.Lock()
+	defer expvarMutex.Unlock()
+	if v := expvar.Get(key); v != nil {
+		return v
+	}
+	v := create()
+	expvar.Publish(key, v)
+	return v
+}
+
+// Close on the ExpvarClient is a no-op
+func (c *ExpvarClient) Close() error {
+	return nil
+}
+
+// Flush on the ExpvarClient is a no-op
+func (c *ExpvarClient) Flush() error {
+	return nil
+}
+
+// Count adds some value to a metric.
+func (c *ExpvarClient) Count(name string, value int64) {
+	if suppressed() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the expvar client", "counts")
+		return
+	}
+	v := c.publish(name, func() expvar.Var { return new(expvar.Int) })
+	if counter, ok := v.(*expvar.Int); ok {
+		counter.Add(value)
+	}
+}
+
+// Incr adds one to a metric.
+func (c *ExpvarClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *ExpvarClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *ExpvarClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric, published as an
+// `expvar.Float`. Like other calls, it is dropped if the name is already
+// published as a different type, e.g. by `Count`.
+func (c *ExpvarClient) CountFloat(name string, value float64) {
+	if suppressed() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the expvar client", "counts")
+		return
+	}
+	v := c.publish(name, func() expvar.Var { return new(expvar.Float) })
+	if counter, ok := v.(*expvar.Float); ok {
+		counter.Add(value)
+	}
+}
+
+// Gauge sets a numeric value.
+func (c *ExpvarClient) Gauge(name string, value float64) {
+	if suppressed() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the expvar client", "gauges")
+		return
+	}
+	v := c.publish(name, func() expvar.Var { return new(expvar.Float) })
+	if gauge, ok := v.(*expvar.Float); ok {
+		gauge.Set(value)
+	}
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *ExpvarClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp on the ExpvarClient is not supported and is dropped,
+// since expvar only publishes the current value. The first dropped call of
+// each kind is logged.
+func (c *ExpvarClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	warnTimestampDropped("the expvar client", "gauges")
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *ExpvarClient) GaugeDelta(name string, delta float64) {
+	if suppressed() {
+		return
+	}
+	v := c.publish(name, func() expvar.Var { return new(expvar.Float) })
+	if gauge, ok := v.(*expvar.Float); ok {
+		gauge.Add(delta)
+	}
+}
+
+// Set counts the number of unique values for a metric.
+func (c *ExpvarClient) Set(name string, value string) {
+	if suppressed() {
+		return
+	}
+	v := c.publish(name, func() expvar.Var {
+		return &expvarSet{values: map[string]struct{}{}}
+	})
+	if set, ok := v.(*expvarSet); ok {
+		set.add(value)
+	}
+}
+
+// Event on the ExpvarClient is a no-op
+func (c *ExpvarClient) Event(e *statsd.Event) {
+}
+
+// ServiceCheck on the ExpvarClient is a no-op
+func (c *ExpvarClient) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
+// observe adds a value to a summary var.
+func (c *ExpvarClient) observe(name string, value float64) {
+	if suppressed() {
+		return
+	}
+	v := c.publish(name, func() expvar.Var { return &expvarSummary{} })
+	if summary, ok := v.(*expvarSummary); ok {
+		summary.observe(value)
+	}
+}
+
+// Timing tracks a duration in milliseconds.
+func (c *ExpvarClient) Timing(name string, value time.Duration) {
+	c.observe(name, float64(value)/float64(time.Millisecond))
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *ExpvarClient) TimingMs(name string, ms float64) {
+	c.observe(name, ms)
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *ExpvarClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *ExpvarClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *ExpvarClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *ExpvarClient) Histogram(name string, value float64) {
+	c.observe(name, value)
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *ExpvarClient) Distribution(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the expvar client", "distributions")
+		return
+	}
+	c.observe(name, value)
+}
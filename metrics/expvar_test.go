@@ -0,0 +1,108 @@
+package metrics_test
+
+import (
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// expvarString returns the published value of an expvar var, or an empty
+// string if it has not been published.
+func expvarString(name string) string {
+	if v := expvar.Get(name); v != nil {
+		return v.String()
+	}
+	return ""
+}
+
+// expvarPrefix returns a unique metric name prefix for a test, since expvar
+// vars are process-global and outlive a single test run.
+func expvarPrefix(t *testing.T) string {
+	return fmt.Sprintf("%s.%d.", t.Name(), time.Now().UnixNano())
+}
+
+func ExampleExpvarClient() {
+	client := metrics.NewExpvarClient()
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("example.requests.count")
+}
+
+func TestExpvarClient(t *testing.T) {
+	prefix := expvarPrefix(t)
+
+	var client metrics.Client
+	client = metrics.NewExpvarClient().WithPrefix(prefix)
+
+	client.Incr("one")
+	client.Count("one", 5)
+	client.Decr("one")
+	client.Gauge("memory", 1024)
+	client.CountFloat("work", 0.25)
+	client.CountFloat("work", 1)
+	client.CountFloat("one", 1)
+	client.GaugeInt("queue", 10)
+	client.GaugeDelta("queue", -3)
+	client.Set("users", "alice")
+	client.Set("users", "bob")
+	client.Set("users", "alice")
+	client.Timing("timing", 100*time.Millisecond)
+	client.TimingMs("timing", 300)
+	client.Histogram("histo", 1)
+	client.Histogram("histo", 5)
+	client.Histogram("histo", 3)
+	client.WithRate(0.5).Distribution("distro", 999)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.WithTags(map[string]string{
+		"tag2": "value2",
+		"tag1": "value1",
+	}).Incr("tagged")
+	client.Flush()
+	client.Close()
+
+	ExpectEqual(t, "5", expvarString(prefix+"one[]"))
+	ExpectEqual(t, "1.25", expvarString(prefix+"work[]"))
+	ExpectEqual(t, "1024", expvarString(prefix+"memory[]"))
+	ExpectEqual(t, "7", expvarString(prefix+"queue[]"))
+	ExpectEqual(t, "2", expvarString(prefix+"users[]"))
+	ExpectEqual(t, `{"avg":200,"count":2,"max":300,"min":100,"sum":400}`, expvarString(prefix+"timing[]"))
+	ExpectEqual(t, `{"avg":3,"count":3,"max":5,"min":1,"sum":9}`, expvarString(prefix+"histo[]"))
+	ExpectEqual(t, `{"avg":999,"count":1,"max":999,"min":999,"sum":999}`, expvarString(prefix+"distro[]"))
+	ExpectEqual(t, "1", expvarString(prefix+"tagged[tag1:value1 tag2:value2]"))
+}
+
+func TestExpvarClientReusesVars(t *testing.T) {
+	prefix := expvarPrefix(t)
+	existing := expvar.NewInt(prefix + "existing[]")
+	existing.Set(10)
+
+	metrics.NewExpvarClient().WithPrefix(prefix).Incr("existing")
+	metrics.NewExpvarClient().WithPrefix(prefix).Incr("existing")
+
+	ExpectEqual(t, int64(12), existing.Value())
+}
+
+func TestExpvarClientTypeCollision(t *testing.T) {
+	prefix := expvarPrefix(t)
+	client := metrics.NewExpvarClient().WithPrefix(prefix)
+	client.Incr("collision")
+	client.Gauge("collision", 5)
+	client.Histogram("collision", 5)
+
+	ExpectEqual(t, "1", expvarString(prefix+"collision[]"))
+}
+
+func TestExpvarClientWithRateZero(t *testing.T) {
+	prefix := expvarPrefix(t)
+	client := metrics.NewExpvarClient().WithPrefix(prefix).WithRate(0)
+	client.Incr("zero")
+	client.Gauge("zero.gauge", 1)
+
+	ExpectEqual(t, "", expvarString(prefix+"zero[]"))
+	ExpectEqual(t, "", expvarString(prefix+"zero.gauge[]"))
+}
@@ -0,0 +1,340 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// FileClient aggregates metrics in memory like the `MemoryClient` and
+// periodically writes a snapshot in the OpenMetrics text format to a file,
+// e.g. for a sidecar to pick up in air-gapped environments without a network
+// listener:
+//
+//   client := metrics.NewFileClient("/var/run/metrics/app.prom", 15*time.Second)
+//   defer client.Close()
+//
+// Each snapshot is written to a temporary file in the same directory which
+// is then renamed over the path, so readers never see a partial file. Tags
+// become labels, and metric names are converted like for `Handler` on the
+// `MemoryClient`, with counters exposed with a `_total` suffix. Write errors
+// are logged, and the next interval tries again. Options are passed to the
+// underlying `MemoryClient`.
+type FileClient struct {
+	client Client
+	file   *metricsFile
+}
+
+// metricsFile writes snapshots of a memory client to a path. It is shared by
+// a file client and all of its clones.
+type metricsFile struct {
+	mutex  sync.Mutex
+	memory *MemoryClient
+	path   string
+	once   sync.Once
+	done   chan struct{}
+	exit   chan struct{}
+}
+
+// NewFileClient creates a new file client which writes to `path` on the
+// given interval. An empty path or a non-positive interval panics.
+func NewFileClient(path string, interval time.Duration, options ...Option) *FileClient {
+	if path == "" {
+		log.Panic(errors.New("file path must not be empty"))
+	}
+	if interval <= 0 {
+		log.Panic(errors.New("file interval must be positive"))
+	}
+
+	memory := NewMemoryClient(options...)
+	file := &metricsFile{
+		memory: memory,
+		path:   path,
+		done:   make(chan struct{}),
+		exit:   make(chan struct{}),
+	}
+	go file.run(interval)
+
+	return &FileClient{
+		client: memory,
+		file:   file,
+	}
+}
+
+// run periodically writes snapshots until the file is stopped.
+func (f *metricsFile) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(f.exit)
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.write(); err != nil {
+				log.Printf("metrics: writing %s: %v", f.path, err)
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// stop stops writing on the interval, waiting for any write in progress.
+func (f *metricsFile) stop() {
+	f.once.Do(func() {
+		close(f.done)
+	})
+	<-f.exit
+}
+
+// write atomically replaces the file with a snapshot of the aggregates.
+func (f *metricsFile) write() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(f.memory.exposition(true)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Snapshot returns a deep copy of the current aggregates, just like the
+// `MemoryClient`.
+func (c *FileClient) Snapshot() map[string]Aggregate {
+	return c.file.memory.Snapshot()
+}
+
+// wrap returns a new file client writing to the same file around `client`.
+func (c *FileClient) wrap(client Client) *FileClient {
+	return &FileClient{
+		client: client,
+		file:   c.file,
+	}
+}
+
+// WithTags clones this client with additional tags applied to the wrapped
+// client.
+func (c *FileClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	return c.wrap(c.client.WithTags(tags))
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *FileClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *FileClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *FileClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *FileClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags of the wrapped client.
+func (c *FileClient) Tags() map[string]string {
+	return c.client.Tags()
+}
+
+// Rate returns the sample rate of the wrapped client.
+func (c *FileClient) Rate() float64 {
+	return c.client.Rate()
+}
+
+// WithoutTags clones this client with the given tags removed from the
+// wrapped client.
+func (c *FileClient) WithoutTags(keys ...string) Client {
+	return c.wrap(c.client.WithoutTags(keys...))
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *FileClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions on the wrapped client.
+func (c *FileClient) WithTimestamp(timestamp time.Time) Client {
+	return c.wrap(c.client.WithTimestamp(timestamp))
+}
+
+// WithRate clones this client with a new sample rate applied to the wrapped
+// client.
+func (c *FileClient) WithRate(rate float64) Client {
+	return c.wrap(c.client.WithRate(rate))
+}
+
+// WithAdditionalRate clones this client with the wrapped client's sample
+// rate multiplied by `factor`.
+func (c *FileClient) WithAdditionalRate(factor float64) Client {
+	return c.wrap(c.client.WithAdditionalRate(factor))
+}
+
+// Always clones this client with the wrapped client always emitting, so that
+// critical metrics are never sampled out.
+func (c *FileClient) Always() Client {
+	return c.wrap(c.client.Always())
+}
+
+// WithPrefix clones this client with an additional metric name prefix
+// applied to the wrapped client.
+func (c *FileClient) WithPrefix(prefix string) Client {
+	return c.wrap(c.client.WithPrefix(prefix))
+}
+
+// Clone returns an independent copy of this client by cloning the wrapped
+// client.
+func (c *FileClient) Clone() Client {
+	return c.wrap(c.client.Clone())
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *FileClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// Flush writes a snapshot of the current aggregates to the file right away.
+func (c *FileClient) Flush() error {
+	return c.file.write()
+}
+
+// Close stops writing on the interval and writes a final snapshot. It is
+// shared by all clones, so later calls only write another snapshot.
+func (c *FileClient) Close() error {
+	c.file.stop()
+	return c.file.write()
+}
+
+// Count adds some value to a metric.
+func (c *FileClient) Count(name string, value int64) {
+	c.client.Count(name, value)
+}
+
+// Incr adds one to a metric.
+func (c *FileClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *FileClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *FileClient) CountWithRate(name string, value int64, rate float64) {
+	c.client.CountWithRate(name, value, rate)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *FileClient) CountFloat(name string, value float64) {
+	c.client.CountFloat(name, value)
+}
+
+// Gauge sets a numeric value.
+func (c *FileClient) Gauge(name string, value float64) {
+	c.client.Gauge(name, value)
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *FileClient) GaugeInt(name string, value int64) {
+	c.client.GaugeInt(name, value)
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time.
+func (c *FileClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.client.GaugeWithTimestamp(name, value, timestamp)
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *FileClient) GaugeDelta(name string, delta float64) {
+	c.client.GaugeDelta(name, delta)
+}
+
+// Set counts the number of unique values for a metric.
+func (c *FileClient) Set(name string, value string) {
+	c.client.Set(name, value)
+}
+
+// Event tracks an event that may be relevant to other metrics.
+func (c *FileClient) Event(e *statsd.Event) {
+	c.client.Event(e)
+}
+
+// ServiceCheck reports the status of a service.
+func (c *FileClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	c.client.ServiceCheck(sc)
+}
+
+// Timing tracks a duration.
+func (c *FileClient) Timing(name string, value time.Duration) {
+	c.client.Timing(name, value)
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *FileClient) TimingMs(name string, ms float64) {
+	c.client.TimingMs(name, ms)
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *FileClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *FileClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *FileClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock of the wrapped client.
+func (c *FileClient) clock() func() time.Time {
+	return clockFor(c.client)
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *FileClient) Histogram(name string, value float64) {
+	c.client.Histogram(name, value)
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *FileClient) Distribution(name string, value float64) {
+	c.client.Distribution(name, value)
+}
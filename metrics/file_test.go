@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleFileClient() {
+	client := metrics.NewFileClient(filepath.Join(os.TempDir(), "app.prom"), 15*time.Second)
+	defer client.Close()
+
+	client.WithTag("route", "/users").Incr("requests")
+}
+
+func TestFileClient(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.prom")
+	client := metrics.NewFileClient(path, time.Hour,
+		metrics.WithHistogramBuckets("latency", []float64{0.1, 1}),
+	)
+
+	client.WithTag("route", "/users").Incr("requests")
+	client.WithTag("route", "/users").Incr("requests")
+	client.Count("jobs_total", 3)
+	client.WithPrefix("pool.").Gauge("size", 10)
+	client.Timing("latency", 50*time.Millisecond)
+	ExpectEqual(t, 2.0, client.Snapshot()["requests[route:/users]"].Value)
+
+	if err := client.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectEqual(t, strings.Join([]string{
+		`# TYPE jobs counter`,
+		`jobs_total 3`,
+		`# TYPE latency histogram`,
+		`latency_bucket{le="0.1"} 1`,
+		`latency_bucket{le="1"} 1`,
+		`latency_bucket{le="+Inf"} 1`,
+		`latency_sum 0.05`,
+		`latency_count 1`,
+		`# TYPE pool_size gauge`,
+		`pool_size 10`,
+		`# TYPE requests counter`,
+		`requests_total{route="/users"} 2`,
+		`# EOF`,
+		``,
+	}, "\n"), string(contents))
+
+	// Close writes a final snapshot, and no temporary files are left behind.
+	client.Incr("requests")
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	contents, _ = os.ReadFile(path)
+	if !strings.Contains(string(contents), "requests_total 1\n") {
+		t.Fatalf("Expected the final snapshot to be written. Found '%s'", contents)
+	}
+	entries, _ := os.ReadDir(dir)
+	ExpectEqual(t, 1, len(entries))
+}
+
+func TestFileClientInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.prom")
+	client := metrics.NewFileClient(path, 10*time.Millisecond)
+	defer client.Close()
+
+	client.Gauge("queue.depth", 3)
+	deadline := time.Now().Add(time.Second)
+	for {
+		contents, err := os.ReadFile(path)
+		if err == nil && strings.Contains(string(contents), "queue_depth 3\n") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a snapshot to be written on the interval. Found '%s'", contents)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFileClientInvalid(t *testing.T) {
+	invalid := map[string]func(){
+		"empty path":     func() { metrics.NewFileClient("", time.Second) },
+		"empty interval": func() { metrics.NewFileClient("app.prom", 0) },
+	}
+
+	for name, construct := range invalid {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); err == nil {
+					t.Fatalf("Expected invalid options to panic")
+				}
+			}()
+			construct()
+		})
+	}
+}
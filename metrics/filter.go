@@ -0,0 +1,305 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"path"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// FilterClient wraps another client and only forwards metrics whose names
+// match an allowlist and do not match a blocklist. This is useful to control
+// cardinality costs by emitting only a curated subset of metrics. Patterns
+// use the `path.Match` glob syntax, so `requests.count` is an exact match
+// while `requests.*` matches by prefix:
+//
+//   client := metrics.NewFilterClient(
+//     metrics.NewDataDogClient("127.0.0.1:8125", "myprefix"),
+//     []string{"requests.*", "errors.count"},
+//     []string{"requests.debug.*"},
+//   )
+//
+// An empty allowlist allows every metric, and the blocklist always takes
+// precedence. Names are matched as passed to the metric call, without any
+// prefix set via `WithPrefix`. Events and service checks are always
+// forwarded.
+type FilterClient struct {
+	client Client
+	allow  []string
+	block  []string
+}
+
+// NewFilterClient creates a new filtering client wrapping `client`. Invalid
+// patterns cause a panic.
+func NewFilterClient(client Client, allow []string, block []string) *FilterClient {
+	for _, pattern := range append(append([]string{}, allow...), block...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Panicf("invalid filter pattern %q: %v", pattern, err)
+		}
+	}
+
+	return &FilterClient{
+		client: client,
+		allow:  allow,
+		block:  block,
+	}
+}
+
+// matchAny returns whether the name matches any of the given patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns whether a metric name should be forwarded.
+func (c *FilterClient) allowed(name string) bool {
+	if matchAny(c.block, name) {
+		return false
+	}
+	return len(c.allow) == 0 || matchAny(c.allow, name)
+}
+
+// wrap returns a new filter client with the same filters around `client`.
+func (c *FilterClient) wrap(client Client) *FilterClient {
+	return &FilterClient{
+		client: client,
+		allow:  c.allow,
+		block:  c.block,
+	}
+}
+
+// WithTags clones this client with additional tags applied to the wrapped
+// client.
+func (c *FilterClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	return c.wrap(c.client.WithTags(tags))
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *FilterClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *FilterClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *FilterClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *FilterClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags of the wrapped client.
+func (c *FilterClient) Tags() map[string]string {
+	return c.client.Tags()
+}
+
+// Rate returns the sample rate of the wrapped client.
+func (c *FilterClient) Rate() float64 {
+	return c.client.Rate()
+}
+
+// WithoutTags clones this client with the given tags removed from the
+// wrapped client.
+func (c *FilterClient) WithoutTags(keys ...string) Client {
+	return c.wrap(c.client.WithoutTags(keys...))
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *FilterClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions on the wrapped client.
+func (c *FilterClient) WithTimestamp(timestamp time.Time) Client {
+	return c.wrap(c.client.WithTimestamp(timestamp))
+}
+
+// WithRate clones this client with a new sample rate applied to the wrapped
+// client.
+func (c *FilterClient) WithRate(rate float64) Client {
+	return c.wrap(c.client.WithRate(rate))
+}
+
+// WithAdditionalRate clones this client with the wrapped client's sample
+// rate multiplied by `factor`.
+func (c *FilterClient) WithAdditionalRate(factor float64) Client {
+	return c.wrap(c.client.WithAdditionalRate(factor))
+}
+
+// Always clones this client with the wrapped client always emitting, so that
+// critical metrics are never sampled out.
+func (c *FilterClient) Always() Client {
+	return c.wrap(c.client.Always())
+}
+
+// WithPrefix clones this client with an additional metric name prefix
+// applied to the wrapped client.
+func (c *FilterClient) WithPrefix(prefix string) Client {
+	return c.wrap(c.client.WithPrefix(prefix))
+}
+
+// Clone returns an independent copy of this client by cloning the wrapped
+// client.
+func (c *FilterClient) Clone() Client {
+	return c.wrap(c.client.Clone())
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *FilterClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// Flush flushes the wrapped client.
+func (c *FilterClient) Flush() error {
+	return c.client.Flush()
+}
+
+// Close closes the wrapped client.
+func (c *FilterClient) Close() error {
+	return c.client.Close()
+}
+
+// Count adds some value to a metric.
+func (c *FilterClient) Count(name string, value int64) {
+	if c.allowed(name) {
+		c.client.Count(name, value)
+	}
+}
+
+// Incr adds one to a metric.
+func (c *FilterClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *FilterClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *FilterClient) CountWithRate(name string, value int64, rate float64) {
+	if c.allowed(name) {
+		c.client.CountWithRate(name, value, rate)
+	}
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *FilterClient) CountFloat(name string, value float64) {
+	if c.allowed(name) {
+		c.client.CountFloat(name, value)
+	}
+}
+
+// Gauge sets a numeric value.
+func (c *FilterClient) Gauge(name string, value float64) {
+	if c.allowed(name) {
+		c.client.Gauge(name, value)
+	}
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *FilterClient) GaugeInt(name string, value int64) {
+	if c.allowed(name) {
+		c.client.GaugeInt(name, value)
+	}
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time.
+func (c *FilterClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	if c.allowed(name) {
+		c.client.GaugeWithTimestamp(name, value, timestamp)
+	}
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *FilterClient) GaugeDelta(name string, delta float64) {
+	if c.allowed(name) {
+		c.client.GaugeDelta(name, delta)
+	}
+}
+
+// Set counts the number of unique values for a metric.
+func (c *FilterClient) Set(name string, value string) {
+	if c.allowed(name) {
+		c.client.Set(name, value)
+	}
+}
+
+// Event tracks an event that may be relevant to other metrics.
+func (c *FilterClient) Event(e *statsd.Event) {
+	c.client.Event(e)
+}
+
+// ServiceCheck reports the status of a service.
+func (c *FilterClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	c.client.ServiceCheck(sc)
+}
+
+// Timing tracks a duration.
+func (c *FilterClient) Timing(name string, value time.Duration) {
+	if c.allowed(name) {
+		c.client.Timing(name, value)
+	}
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *FilterClient) TimingMs(name string, ms float64) {
+	if c.allowed(name) {
+		c.client.TimingMs(name, ms)
+	}
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *FilterClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *FilterClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *FilterClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock of the wrapped client.
+func (c *FilterClient) clock() func() time.Time {
+	return clockFor(c.client)
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *FilterClient) Histogram(name string, value float64) {
+	if c.allowed(name) {
+		c.client.Histogram(name, value)
+	}
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *FilterClient) Distribution(name string, value float64) {
+	if c.allowed(name) {
+		c.client.Distribution(name, value)
+	}
+}
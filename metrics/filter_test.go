@@ -0,0 +1,73 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleFilterClient() {
+	client := metrics.NewFilterClient(
+		metrics.NewLoggerClient(nil),
+		[]string{"requests.*"},
+		nil,
+	)
+	client.Incr("requests.count")
+	client.Incr("debug.count")
+	// Output: Count requests.count:1 []
+}
+
+func TestFilterClient(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	var client metrics.Client
+	client = metrics.NewFilterClient(recorder,
+		[]string{"requests.*", "errors.count"},
+		[]string{"requests.debug"},
+	)
+
+	client.Incr("requests.count")
+	client.Gauge("requests.size", 10)
+	client.Incr("requests.debug")
+	client.Incr("errors.count")
+	client.Incr("errors.count.other")
+	client.Timing("other", time.Second)
+	client.TimeFunc("requests.latency", func() {})
+	client.Event(statsd.NewEvent("title", "desc"))
+
+	ExpectEqual(t, 5, recorder.Length())
+	recorder.Expect("requests.count")
+	recorder.Expect("requests.size")
+	recorder.Expect("errors.count")
+	recorder.Expect("requests.latency")
+	recorder.Expect("title")
+	recorder.If("requests.debug").Reject()
+	recorder.If("errors.count.other").Reject()
+	recorder.If("other").Reject()
+}
+
+func TestFilterClientChaining(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	client := metrics.NewFilterClient(recorder, nil, []string{"blocked"})
+
+	chained := client.WithTag("tag1", "value1").WithRate(0.5).WithPrefix("a.")
+	ExpectEqual(t, 0.5, chained.Rate())
+	ExpectEqual(t, 1.0, chained.Always().Rate())
+	chained.Incr("allowed")
+	chained.Incr("blocked")
+
+	ExpectEqual(t, 1, recorder.Length())
+	recorder.Expect("a.allowed").Tag("tag1", "value1").Rate(0.5)
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, chained.Tags())
+}
+
+func TestFilterClientInvalidPattern(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatalf("Expected invalid pattern to panic")
+		}
+	}()
+	metrics.NewFilterClient(metrics.NewNullClient(), []string{"["}, nil)
+}
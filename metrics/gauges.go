@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultGaugeInterval is how often registered gauges are polled unless set
+// via `WithGaugeInterval`.
+const defaultGaugeInterval = 10 * time.Second
+
+// observedGauge is a callback registered via `RegisterGauge` along with the
+// client which emits its result.
+type observedGauge struct {
+	client Client
+	name   string
+	fn     func() float64
+}
+
+// observedGauges holds the gauge callbacks of a client. It is shared by a
+// client and all of its clones, so a gauge registered on a tagged clone can
+// be unregistered from the same clone later.
+type observedGauges struct {
+	mutex    sync.Mutex
+	gauges   map[string]*observedGauge
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time
+	started  bool
+	closed   bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newObservedGauges creates an empty set of gauge callbacks which are polled
+// on the interval in the background, and at most once per interval by
+// `observeDue`.
+func newObservedGauges(interval time.Duration, now func() time.Time) *observedGauges {
+	return &observedGauges{
+		gauges:   map[string]*observedGauge{},
+		interval: interval,
+		now:      now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// register adds a callback, replacing any callback with the same key.
+func (g *observedGauges) register(key string, gauge *observedGauge) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.gauges[key] = gauge
+}
+
+// unregister removes a callback. Unknown keys are ignored.
+func (g *observedGauges) unregister(key string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.gauges, key)
+}
+
+// observe invokes every callback and emits the results. Callbacks are
+// invoked without holding the lock, so they may register or unregister
+// gauges themselves.
+func (g *observedGauges) observe() {
+	g.mutex.Lock()
+	keys := make([]string, 0, len(g.gauges))
+	for key := range g.gauges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	gauges := make([]*observedGauge, len(keys))
+	for i, key := range keys {
+		gauges[i] = g.gauges[key]
+	}
+	g.mutex.Unlock()
+
+	for _, gauge := range gauges {
+		gauge.client.Gauge(gauge.name, gauge.fn())
+	}
+}
+
+// observeDue invokes the callbacks unless they were already invoked within
+// the interval, according to the clock.
+func (g *observedGauges) observeDue() {
+	now := g.now()
+	g.mutex.Lock()
+	due := g.last.IsZero() || now.Sub(g.last) >= g.interval
+	if due {
+		g.last = now
+	}
+	g.mutex.Unlock()
+
+	if due {
+		g.observe()
+	}
+}
+
+// start polls the callbacks on the interval in the background until `close`
+// is called. Only the first call has any effect.
+func (g *observedGauges) start() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.started || g.closed {
+		return
+	}
+	g.started = true
+	go g.run()
+}
+
+// run polls the callbacks on every tick until the gauges are closed. Ticks
+// always poll, since scheduling jitter or a recent `observeDue` would
+// otherwise make a tick look early and skip a whole interval.
+func (g *observedGauges) run() {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	defer close(g.done)
+	for {
+		select {
+		case <-ticker.C:
+			g.mutex.Lock()
+			g.last = g.now()
+			g.mutex.Unlock()
+			g.observe()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// close stops polling in the background, waiting for any poll in progress.
+// It is safe to call more than once, or if polling never started.
+func (g *observedGauges) close() {
+	g.mutex.Lock()
+	if g.closed {
+		g.mutex.Unlock()
+		return
+	}
+	g.closed = true
+	started := g.started
+	close(g.stop)
+	g.mutex.Unlock()
+
+	if started {
+		<-g.done
+	}
+}
@@ -0,0 +1,447 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// graphiteMaxBufferSize is the number of buffered bytes after which lines
+// are written to the connection without waiting for the flush interval.
+const graphiteMaxBufferSize = 8192
+
+// graphiteTimeout limits how long dialling or a single write may take.
+const graphiteTimeout = 10 * time.Second
+
+// graphiteConn buffers metric lines and writes them to the connection from a
+// background goroutine, either when the buffer is full or on the flush
+// interval. It is shared by a Graphite client and all of its clones.
+type graphiteConn struct {
+	mutex    sync.Mutex
+	address  string
+	conn     net.Conn // nil after a failed write until redialled
+	buffer   []byte
+	warned   map[string]bool
+	warnings *warnThrottle
+	sending  sync.Mutex // held while writing, guarding `conn`
+	full     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// write adds a line to the buffer, signalling the background goroutine if
+// the buffer is full. It never waits for the server.
+func (g *graphiteConn) write(line string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.buffer = append(g.buffer, line...)
+	g.buffer = append(g.buffer, '\n')
+	if len(g.buffer) >= graphiteMaxBufferSize {
+		select {
+		case g.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush takes the buffered lines and writes them to the connection. A failed
+// write closes the connection and retries once on a new one, since Carbon
+// may have been restarted.
+func (g *graphiteConn) flush() error {
+	g.sending.Lock()
+	defer g.sending.Unlock()
+
+	g.mutex.Lock()
+	buffer := g.buffer
+	g.buffer = nil
+	g.mutex.Unlock()
+
+	if len(buffer) == 0 {
+		return nil
+	}
+	err := g.send(buffer)
+	if err != nil && g.conn != nil {
+		g.drop()
+		err = g.send(buffer)
+	}
+	if err != nil {
+		g.drop()
+	}
+	return err
+}
+
+// send writes lines to the connection, dialling it if needed. The sending
+// mutex must be held by the caller.
+func (g *graphiteConn) send(buffer []byte) error {
+	if g.conn == nil {
+		conn, err := net.DialTimeout("tcp", g.address, graphiteTimeout)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+	if err := g.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout)); err != nil {
+		return err
+	}
+	_, err := g.conn.Write(buffer)
+	return err
+}
+
+// drop closes the connection, if any, so that the next write redials it.
+// The sending mutex must be held by the caller.
+func (g *graphiteConn) drop() error {
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+// warn logs that a kind of call is not supported, once per connection.
+func (g *graphiteConn) warn(kind string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.warned[kind] {
+		g.warned[kind] = true
+		log.Printf("metrics: graphite does not support %s, dropping", kind)
+	}
+}
+
+// run flushes the buffer on the interval or when it is full until stopped.
+// Lines which fail to send are dropped, logging the error.
+func (g *graphiteConn) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(g.done)
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.full:
+		case <-g.stop:
+			return
+		}
+		if err := g.flush(); err != nil {
+			g.warnings.warnf("metrics: writing to graphite: %v", err)
+		}
+	}
+}
+
+// GraphiteClient writes metrics to a Graphite/Carbon server over TCP using
+// the plaintext protocol. Since Graphite has no concept of tags, they are
+// folded into the metric path in sorted key order. For example, given tags
+// `tag1:value1` and `tag2:value2`, a call to `Incr("requests.count")` emits
+// the following line:
+//
+//   requests.count.tag1.value1.tag2.value2 1 1500000000
+//
+// Graphite stores plain values, so counts are sent as the value added and
+// should be summed by a Carbon aggregation rule. Timings are sent in
+// milliseconds. Gauge deltas, sets, events, and service checks cannot be
+// represented and are dropped, logging a warning the first time. The sample
+// rate is ignored since Graphite cannot extrapolate, except that a rate of
+// zero drops everything.
+//
+// Lines are written by a background goroutine, so calls never wait for the
+// server. Lines which fail to send are dropped, logging the error, and the
+// connection is redialled.
+type GraphiteClient struct {
+	conn      *graphiteConn
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewGraphiteClient creates a new Graphite client connected to the Carbon
+// plaintext listener at `address`, e.g. `127.0.0.1:2003`. Buffered metrics
+// are sent at least every `flushInterval`.
+func NewGraphiteClient(address string, flushInterval time.Duration) *GraphiteClient {
+	if flushInterval <= 0 {
+		log.Panic("flush interval must be positive")
+	}
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	g := &graphiteConn{
+		address:  address,
+		conn:     conn,
+		warned:   map[string]bool{},
+		warnings: newWarnThrottle(defaultWarningInterval),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go g.run(flushInterval)
+
+	return &GraphiteClient{
+		conn: g,
+		rate: 1.0,
+	}
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *GraphiteClient) clone() *GraphiteClient {
+	clone := *c
+	return &clone
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *GraphiteClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	clone.tagMap = combine(c.tagMap, tags)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *GraphiteClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *GraphiteClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *GraphiteClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *GraphiteClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *GraphiteClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *GraphiteClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *GraphiteClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *GraphiteClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions, which is sent as the line's timestamp.
+func (c *GraphiteClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *GraphiteClient) WithRate(rate float64) Client {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *GraphiteClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *GraphiteClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *GraphiteClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *GraphiteClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *GraphiteClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// send formats and buffers a metric line with the current timestamp.
+func (c *GraphiteClient) send(name string, value float64) {
+	c.sendAt(name, value, time.Now())
+}
+
+// at returns the timestamp set via `WithTimestamp`, or the current time.
+func (c *GraphiteClient) at() time.Time {
+	if c.timestamp.IsZero() {
+		return time.Now()
+	}
+	return c.timestamp
+}
+
+// sendAt formats and buffers a metric line with the given timestamp.
+func (c *GraphiteClient) sendAt(name string, value float64, timestamp time.Time) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	path := tagPath(c.prefix+name, c.tagMap)
+	c.conn.write(path + " " + strconv.FormatFloat(value, 'f', -1, 64) + " " + strconv.FormatInt(timestamp.Unix(), 10))
+}
+
+// Flush sends any buffered metrics to the server.
+func (c *GraphiteClient) Flush() error {
+	return c.conn.flush()
+}
+
+// Close flushes any buffered metrics and closes the connection. Calling it
+// more than once is a no-op.
+func (c *GraphiteClient) Close() error {
+	var err error
+	c.conn.once.Do(func() {
+		close(c.conn.stop)
+		<-c.conn.done
+
+		err = c.Flush()
+		c.conn.sending.Lock()
+		defer c.conn.sending.Unlock()
+		if closeErr := c.conn.drop(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// Count adds some integer value to a metric.
+func (c *GraphiteClient) Count(name string, value int64) {
+	c.sendAt(name, float64(value), c.at())
+}
+
+// Incr adds one to a metric.
+func (c *GraphiteClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *GraphiteClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *GraphiteClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *GraphiteClient) CountFloat(name string, value float64) {
+	c.sendAt(name, value, c.at())
+}
+
+// Gauge sets a numeric value.
+func (c *GraphiteClient) Gauge(name string, value float64) {
+	c.sendAt(name, value, c.at())
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *GraphiteClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time, which is sent as
+// the line's timestamp.
+func (c *GraphiteClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.sendAt(name, value, timestamp)
+}
+
+// GaugeDelta on the GraphiteClient is not supported and is dropped.
+func (c *GraphiteClient) GaugeDelta(name string, delta float64) {
+	c.conn.warn("gauge deltas")
+}
+
+// Set on the GraphiteClient is not supported and is dropped.
+func (c *GraphiteClient) Set(name string, value string) {
+	c.conn.warn("sets")
+}
+
+// Event on the GraphiteClient is not supported and is dropped.
+func (c *GraphiteClient) Event(e *statsd.Event) {
+	c.conn.warn("events")
+}
+
+// ServiceCheck on the GraphiteClient is not supported and is dropped.
+func (c *GraphiteClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	c.conn.warn("service checks")
+}
+
+// Timing tracks a duration in milliseconds.
+func (c *GraphiteClient) Timing(name string, value time.Duration) {
+	c.send(name, float64(value)/float64(time.Millisecond))
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *GraphiteClient) TimingMs(name string, ms float64) {
+	c.send(name, ms)
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *GraphiteClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *GraphiteClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *GraphiteClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sends a numeric value. Graphite computes statistics over the
+// stored values.
+func (c *GraphiteClient) Histogram(name string, value float64) {
+	c.send(name, value)
+}
+
+// Distribution sends a numeric value. Graphite computes statistics over the
+// stored values.
+func (c *GraphiteClient) Distribution(name string, value float64) {
+	c.sendAt(name, value, c.at())
+}
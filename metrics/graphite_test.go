@@ -0,0 +1,222 @@
+package metrics_test
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// listenGraphite starts a TCP listener on a random local port and returns
+// a channel of the received lines.
+func listenGraphite(t *testing.T) (net.Listener, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected TCP listener to start. Found '%v'", err)
+	}
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return listener, lines
+}
+
+// readGraphite reads `n` lines and returns them without their timestamps,
+// checking that each timestamp is recent.
+func readGraphite(t *testing.T, lines chan string, n int) []string {
+	t.Helper()
+	result := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case line := <-lines:
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				t.Fatalf("Expected 'path value timestamp'. Found '%s'", line)
+			}
+			timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+				t.Fatalf("Expected a recent timestamp. Found '%s'", line)
+			}
+			result = append(result, fields[0]+" "+fields[1])
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d lines. Found '%v'", n, result)
+		}
+	}
+	return result
+}
+
+func ExampleGraphiteClient() {
+	client := metrics.NewGraphiteClient("127.0.0.1:2003", time.Second)
+	defer client.Close()
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("requests.count")
+}
+
+func TestGraphiteClient(t *testing.T) {
+	listener, lines := listenGraphite(t)
+	defer listener.Close()
+
+	var client metrics.Client
+	client = metrics.NewGraphiteClient(listener.Addr().String(), time.Hour).WithPrefix("testing.")
+
+	client.Incr("one")
+	client.Decr("one")
+	client.Count("two", 2)
+	client.CountFloat("work", 0.25)
+	client.Gauge("memory", 1024)
+	client.GaugeInt("queue", 5)
+	client.GaugeDelta("queue", 1)
+	client.Set("users", "alice")
+	client.Timing("timing", 1500*time.Microsecond)
+	client.TimingMs("timing", 2.5)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.WithTags(map[string]string{
+		"tag2": "value2",
+		"tag1": "value1",
+	}).Incr("tagged")
+	client.WithRate(0).Incr("never")
+
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed. Found '%v'", err)
+	}
+
+	ExpectEqual(t, []string{
+		"testing.one 1",
+		"testing.one -1",
+		"testing.two 2",
+		"testing.work 0.25",
+		"testing.memory 1024",
+		"testing.queue 5",
+		"testing.timing 1.5",
+		"testing.timing 2.5",
+		"testing.histo 123",
+		"testing.distro 999",
+		"testing.tagged.tag1.value1.tag2.value2 1",
+	}, readGraphite(t, lines, 11))
+
+	// Closing flushes anything left in the buffer.
+	client.Incr("closed")
+	client.Close()
+	ExpectEqual(t, []string{"testing.closed 1"}, readGraphite(t, lines, 1))
+
+	// Closing twice must not panic.
+	client.Close()
+}
+
+func TestGraphiteClientGaugeWithTimestamp(t *testing.T) {
+	listener, lines := listenGraphite(t)
+	defer listener.Close()
+
+	client := metrics.NewGraphiteClient(listener.Addr().String(), time.Hour)
+	defer client.Close()
+
+	client.GaugeWithTimestamp("backfill", 5, time.Unix(1500000000, 0))
+	client.Flush()
+
+	select {
+	case line := <-lines:
+		ExpectEqual(t, "backfill 5 1500000000", line)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a line to be sent")
+	}
+}
+
+func TestGraphiteClientWithTimestamp(t *testing.T) {
+	listener, lines := listenGraphite(t)
+	defer listener.Close()
+
+	client := metrics.NewGraphiteClient(listener.Addr().String(), time.Hour)
+	defer client.Close()
+
+	client.WithTimestamp(time.Unix(1500000000, 0)).Count("backfill", 5)
+	client.Flush()
+
+	select {
+	case line := <-lines:
+		ExpectEqual(t, "backfill 5 1500000000", line)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a line to be sent")
+	}
+}
+
+func TestGraphiteClientFlushInterval(t *testing.T) {
+	listener, lines := listenGraphite(t)
+	defer listener.Close()
+
+	client := metrics.NewGraphiteClient(listener.Addr().String(), 10*time.Millisecond)
+	defer client.Close()
+
+	client.Incr("one")
+	ExpectEqual(t, []string{"one 1"}, readGraphite(t, lines, 1))
+}
+
+func TestGraphiteClientTagPath(t *testing.T) {
+	listener, lines := listenGraphite(t)
+	defer listener.Close()
+
+	client := metrics.NewGraphiteClient(listener.Addr().String(), time.Hour)
+	defer client.Close()
+
+	// Dots in tags would otherwise add segments to the path.
+	client.WithTag("host.name", "web1.example.com").Incr("one")
+	client.Flush()
+	ExpectEqual(t, []string{"one.host_name.web1_example_com 1"}, readGraphite(t, lines, 1))
+}
+
+func TestGraphiteClientRedial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected TCP listener to start. Found '%v'", err)
+	}
+	defer listener.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	client := metrics.NewGraphiteClient(listener.Addr().String(), time.Hour)
+	defer client.Close()
+
+	// Carbon going away breaks the connection, which is noticed on a later
+	// write, so keep writing until the client redials.
+	(<-conns).Close()
+	for i := 0; i < 100; i++ {
+		client.Incr("one")
+		client.Flush()
+		select {
+		case conn := <-conns:
+			defer conn.Close()
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil || !strings.HasPrefix(line, "one 1 ") {
+				t.Fatalf("Expected a line on the new connection. Found '%s' '%v'", line, err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("Expected the client to redial")
+}
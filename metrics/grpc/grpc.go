@@ -0,0 +1,83 @@
+// Package grpc provides gRPC server interceptors which report RPC metrics to
+// a `metrics.Client`. It is a separate module so that only its users depend
+// on the gRPC libraries:
+//
+//   import metricsgrpc "github.com/istreamlabs/go-metrics/metrics/grpc"
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor which counts each unary
+// call as `grpc.requests` and times it as `grpc.request.duration`, tagged
+// with the full method name and status code, e.g. `method:/pkg.Service/Get`
+// and `code:NotFound`:
+//
+//   server := grpc.NewServer(
+//     grpc.UnaryInterceptor(metricsgrpc.UnaryServerInterceptor(client)),
+//     grpc.StreamInterceptor(metricsgrpc.StreamServerInterceptor(client)),
+//   )
+//
+// Method names are defined by the service, so their cardinality is bounded.
+// Tags stored in the call context via `metrics.ContextWithTags` are also
+// added, and durations use the client's clock set via `metrics.WithClock`.
+// If the handler panics, the call is recorded with an `Internal` code and
+// the panic continues.
+func UnaryServerInterceptor(client metrics.Client) grpc.UnaryServerInterceptor {
+	now := metrics.ClockFor(client)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		start := now()
+		completed := false
+		defer func() {
+			recordRPC(client.WithContext(ctx), info.FullMethod, rpcCode(err, completed), now().Sub(start))
+		}()
+
+		resp, err = handler(ctx, req)
+		completed = true
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor which counts and times
+// each streaming call just like `UnaryServerInterceptor`. The duration is
+// the lifetime of the stream.
+func StreamServerInterceptor(client metrics.Client) grpc.StreamServerInterceptor {
+	now := metrics.ClockFor(client)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := now()
+		completed := false
+		defer func() {
+			recordRPC(client.WithContext(ss.Context()), info.FullMethod, rpcCode(err, completed), now().Sub(start))
+		}()
+
+		err = handler(srv, ss)
+		completed = true
+		return err
+	}
+}
+
+// rpcCode returns the status code of a call, which is `Internal` if the
+// handler did not complete because it panicked.
+func rpcCode(err error, completed bool) codes.Code {
+	if !completed {
+		return codes.Internal
+	}
+	return status.Code(err)
+}
+
+// recordRPC counts and times a single call.
+func recordRPC(client metrics.Client, method string, code codes.Code, elapsed time.Duration) {
+	tagged := client.WithTags(map[string]string{
+		"method": method,
+		"code":   code.String(),
+	})
+	tagged.Incr("grpc.requests")
+	tagged.Timing("grpc.request.duration", elapsed)
+}
@@ -0,0 +1,128 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+	metricsgrpc "github.com/istreamlabs/go-metrics/metrics/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ExpectEqual compares two values and fails if they are not deeply equal.
+func ExpectEqual(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected '%s' to be '%s'", actual, expected)
+	}
+}
+
+// LogRecorder records the messages logged by a `metrics.LoggerClient`.
+type LogRecorder struct {
+	messages []string
+}
+
+// Printf appends the formatted message to the recorded messages.
+func (l *LogRecorder) Printf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+// fakeServerStream is a server stream which only provides a context.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func ExampleUnaryServerInterceptor() {
+	client := metrics.NewLoggerClient(nil)
+
+	grpc.NewServer(
+		grpc.UnaryInterceptor(metricsgrpc.UnaryServerInterceptor(client)),
+		grpc.StreamInterceptor(metricsgrpc.StreamServerInterceptor(client)),
+	)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithClock(func() time.Time {
+		return now
+	}))
+	interceptor := metricsgrpc.UnaryServerInterceptor(client)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Users/Get"}
+	ctx := metrics.ContextWithTags(context.Background(), map[string]string{"tenant": "acme"})
+
+	resp, err := interceptor(ctx, "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		now = now.Add(25 * time.Millisecond)
+		return "resp", nil
+	})
+	ExpectEqual(t, "resp", resp)
+	ExpectEqual(t, nil, err)
+
+	_, err = interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	})
+	ExpectEqual(t, codes.NotFound, status.Code(err))
+
+	_, err = interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("plain error")
+	})
+	ExpectEqual(t, codes.Unknown, status.Code(err))
+
+	ExpectEqual(t, []string{
+		"Count grpc.requests:1 [code=OK method=/test.Users/Get tenant=acme]",
+		"Timing grpc.request.duration:25ms [code=OK method=/test.Users/Get tenant=acme]",
+		"Count grpc.requests:1 [code=NotFound method=/test.Users/Get]",
+		"Timing grpc.request.duration:0s [code=NotFound method=/test.Users/Get]",
+		"Count grpc.requests:1 [code=Unknown method=/test.Users/Get]",
+		"Timing grpc.request.duration:0s [code=Unknown method=/test.Users/Get]",
+	}, recorder.messages)
+}
+
+func TestUnaryServerInterceptorPanic(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	interceptor := metricsgrpc.UnaryServerInterceptor(recorder)
+
+	defer func() {
+		if err := recover(); err != "oops" {
+			t.Fatalf("Expected the panic to continue. Found '%v'", err)
+		}
+		recorder.Expect("grpc.requests").Tag("code", "Internal")
+		recorder.Expect("grpc.request.duration").Tag("code", "Internal")
+	}()
+	interceptor(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/test.Users/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("oops")
+	})
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	interceptor := metricsgrpc.StreamServerInterceptor(recorder)
+
+	stream := &fakeServerStream{ctx: context.Background()}
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Users/Watch"}
+
+	interceptor(nil, stream, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return nil
+	})
+	err := interceptor(nil, stream, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return status.Error(codes.Unavailable, "shutting down")
+	})
+	ExpectEqual(t, codes.Unavailable, status.Code(err))
+
+	recorder.Expect("grpc.requests").Tag("method", "/test.Users/Watch").Tag("code", "OK")
+	recorder.Expect("grpc.requests").Tag("method", "/test.Users/Watch").Tag("code", "Unavailable")
+	recorder.Expect("grpc.request.duration").Tag("code", "Unavailable")
+	ExpectEqual(t, 4, recorder.Length())
+}
@@ -0,0 +1,493 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// influxMaxBufferSize is the number of buffered bytes after which lines are
+// written to the server without waiting for the flush interval.
+const influxMaxBufferSize = 65536
+
+// influxTimeout limits how long a single write request may take.
+const influxTimeout = 10 * time.Second
+
+// influxConn buffers lines and writes them to the server from a background
+// goroutine, either when the buffer is full or on the flush interval. It is
+// shared by an Influx client and all of its clones.
+type influxConn struct {
+	mutex    sync.Mutex
+	url      string
+	http     *http.Client
+	buffer   []byte
+	warned   map[string]bool
+	warnings *warnThrottle
+	sending  sync.Mutex // held while posting, so batches are sent in order
+	full     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// write adds a line to the buffer, signalling the background goroutine if
+// the buffer is full. It never waits for the server.
+func (i *influxConn) write(line string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.buffer = append(i.buffer, line...)
+	i.buffer = append(i.buffer, '\n')
+	if len(i.buffer) >= influxMaxBufferSize {
+		select {
+		case i.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush takes the buffered lines and posts them to the server. Lines written
+// while a post is in progress are buffered for the next one.
+func (i *influxConn) flush() error {
+	i.sending.Lock()
+	defer i.sending.Unlock()
+
+	i.mutex.Lock()
+	buffer := i.buffer
+	i.buffer = nil
+	i.mutex.Unlock()
+
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	resp, err := i.http.Post(i.url, "text/plain; charset=utf-8", bytes.NewReader(buffer))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("metrics: influx write failed with status %s", resp.Status)
+	}
+	return nil
+}
+
+// warn logs that a kind of call is not supported, once per connection.
+func (i *influxConn) warn(kind string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if !i.warned[kind] {
+		i.warned[kind] = true
+		log.Printf("metrics: influx does not support %s, dropping", kind)
+	}
+}
+
+// run flushes the buffer on the interval or when it is full until stopped.
+// Lines which fail to send are dropped, logging the error.
+func (i *influxConn) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(i.done)
+	for {
+		select {
+		case <-ticker.C:
+		case <-i.full:
+		case <-i.stop:
+			return
+		}
+		if err := i.flush(); err != nil {
+			i.warnings.warnf("metrics: writing to influx: %v", err)
+		}
+	}
+}
+
+// InfluxClient writes metrics to an InfluxDB server over HTTP using the line
+// protocol. The metric name is the measurement, tags are sent as tags in
+// sorted key order, and the value is a field named after the type of call.
+// For example, given a tag `tag1:value1`, a call to `Incr("requests.count")`
+// emits the following line:
+//
+//   requests.count,tag1=value1 count=1i 1500000000000000000
+//
+// Counts are integer `count` fields holding the value added, so they should
+// be summed in queries, while `CountFloat` sends a float `count` field, so
+// do not mix the two for the same metric. Gauges are float `gauge` fields,
+// timings are float `timing` fields in milliseconds, and histograms and
+// distributions are float `histogram` and `distribution` fields. Sets are
+// string `set` fields, so unique values can be counted in queries. Gauge
+// deltas, events, and service checks cannot be represented and are dropped,
+// logging a warning the first time, as are NaN and infinite values. Lines
+// are written by a background goroutine, so calls never wait for the
+// server, and lines which fail to send are dropped, logging the error. The
+// sample rate is ignored since
+// InfluxDB cannot extrapolate, except that a rate of zero drops everything.
+type InfluxClient struct {
+	conn      *influxConn
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewInfluxClient creates a new InfluxDB client which writes to the given
+// database via the `/write` endpoint of the server at `endpoint`, e.g.
+// `http://127.0.0.1:8086`. InfluxDB 2.x supports this endpoint with the
+// bucket name as the database. Buffered lines are sent at least every
+// `flushInterval`.
+func NewInfluxClient(endpoint string, database string, flushInterval time.Duration) *InfluxClient {
+	if flushInterval <= 0 {
+		log.Panic("flush interval must be positive")
+	}
+	if database == "" {
+		log.Panic("database must not be empty")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		log.Panic(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		log.Panicf("invalid influx endpoint %q: expected an http or https URL", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+	query := u.Query()
+	query.Set("db", database)
+	query.Set("precision", "ns")
+	u.RawQuery = query.Encode()
+
+	i := &influxConn{
+		url:      u.String(),
+		http:     &http.Client{Timeout: influxTimeout},
+		warned:   map[string]bool{},
+		warnings: newWarnThrottle(defaultWarningInterval),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go i.run(flushInterval)
+
+	return &InfluxClient{
+		conn: i,
+		rate: 1.0,
+	}
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *InfluxClient) clone() *InfluxClient {
+	clone := *c
+	return &clone
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *InfluxClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	clone.tagMap = combine(c.tagMap, tags)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *InfluxClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *InfluxClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *InfluxClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *InfluxClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *InfluxClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *InfluxClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *InfluxClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *InfluxClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions, which is sent as the line's timestamp.
+func (c *InfluxClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *InfluxClient) WithRate(rate float64) Client {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *InfluxClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *InfluxClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *InfluxClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *InfluxClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *InfluxClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// influxMeasurementEscaper escapes measurement names for the line protocol.
+var influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+
+// influxTagEscaper escapes tag keys, tag values, and field keys for the line
+// protocol.
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// influxStringEscaper escapes string field values for the line protocol.
+var influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// send formats and buffers a line with the current timestamp.
+func (c *InfluxClient) send(name string, field string, value string) {
+	c.sendAt(name, field, value, time.Now())
+}
+
+// at returns the timestamp set via `WithTimestamp`, or the current time.
+func (c *InfluxClient) at() time.Time {
+	if c.timestamp.IsZero() {
+		return time.Now()
+	}
+	return c.timestamp
+}
+
+// sendAt formats and buffers a line with the given timestamp. The field
+// value must already be formatted for the line protocol.
+func (c *InfluxClient) sendAt(name string, field string, value string, timestamp time.Time) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(c.tagMap))
+	for k := range c.tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var line strings.Builder
+	line.WriteString(influxMeasurementEscaper.Replace(c.prefix + name))
+	for _, k := range keys {
+		if c.tagMap[k] == "" {
+			// Empty tag values are not allowed by the line protocol.
+			continue
+		}
+		line.WriteByte(',')
+		line.WriteString(influxTagEscaper.Replace(k))
+		line.WriteByte('=')
+		line.WriteString(influxTagEscaper.Replace(c.tagMap[k]))
+	}
+	line.WriteByte(' ')
+	line.WriteString(field)
+	line.WriteByte('=')
+	line.WriteString(value)
+	line.WriteByte(' ')
+	line.WriteString(strconv.FormatInt(timestamp.UnixNano(), 10))
+
+	c.conn.write(line.String())
+}
+
+// sendFloat formats and buffers a line with a float field. NaN and infinite
+// values cannot be represented in the line protocol, and the server rejects
+// the whole batch containing one, so they are dropped, logging a warning the
+// first time.
+func (c *InfluxClient) sendFloat(name string, field string, value float64, timestamp time.Time) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		c.conn.warn("NaN or infinite values")
+		return
+	}
+	c.sendAt(name, field, influxFloat(value), timestamp)
+}
+
+// influxFloat formats a float field value.
+func influxFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Flush sends any buffered lines to the server.
+func (c *InfluxClient) Flush() error {
+	return c.conn.flush()
+}
+
+// Close flushes any buffered lines and stops the flush interval. Calling it
+// more than once is a no-op.
+func (c *InfluxClient) Close() error {
+	var err error
+	c.conn.once.Do(func() {
+		close(c.conn.stop)
+		<-c.conn.done
+
+		err = c.Flush()
+		c.conn.http.CloseIdleConnections()
+	})
+	return err
+}
+
+// Count adds some integer value to a metric.
+func (c *InfluxClient) Count(name string, value int64) {
+	c.sendAt(name, "count", strconv.FormatInt(value, 10)+"i", c.at())
+}
+
+// Incr adds one to a metric.
+func (c *InfluxClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *InfluxClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *InfluxClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric as a float field.
+func (c *InfluxClient) CountFloat(name string, value float64) {
+	c.sendFloat(name, "count", value, c.at())
+}
+
+// Gauge sets a numeric value.
+func (c *InfluxClient) Gauge(name string, value float64) {
+	c.sendFloat(name, "gauge", value, c.at())
+}
+
+// GaugeInt sets a numeric integer value. It is sent as a float field, just
+// like `Gauge`, to avoid field type conflicts.
+func (c *InfluxClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time, which is sent as
+// the line's timestamp.
+func (c *InfluxClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.sendFloat(name, "gauge", value, timestamp)
+}
+
+// GaugeDelta on the InfluxClient is not supported and is dropped.
+func (c *InfluxClient) GaugeDelta(name string, delta float64) {
+	c.conn.warn("gauge deltas")
+}
+
+// Set sends the value as a string field.
+func (c *InfluxClient) Set(name string, value string) {
+	c.send(name, "set", `"`+influxStringEscaper.Replace(value)+`"`)
+}
+
+// Event on the InfluxClient is not supported and is dropped.
+func (c *InfluxClient) Event(e *statsd.Event) {
+	c.conn.warn("events")
+}
+
+// ServiceCheck on the InfluxClient is not supported and is dropped.
+func (c *InfluxClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	c.conn.warn("service checks")
+}
+
+// Timing tracks a duration in milliseconds.
+func (c *InfluxClient) Timing(name string, value time.Duration) {
+	c.TimingMs(name, float64(value)/float64(time.Millisecond))
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *InfluxClient) TimingMs(name string, ms float64) {
+	c.sendFloat(name, "timing", ms, time.Now())
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *InfluxClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *InfluxClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *InfluxClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sends a numeric value. InfluxDB computes statistics over the
+// stored values.
+func (c *InfluxClient) Histogram(name string, value float64) {
+	c.sendFloat(name, "histogram", value, time.Now())
+}
+
+// Distribution sends a numeric value. InfluxDB computes statistics over the
+// stored values.
+func (c *InfluxClient) Distribution(name string, value float64) {
+	c.sendFloat(name, "distribution", value, c.at())
+}
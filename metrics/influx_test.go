@@ -0,0 +1,264 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// listenInflux starts an HTTP server which records the query and lines of
+// each write request.
+func listenInflux(t *testing.T, status int) (*httptest.Server, chan string, chan []string) {
+	t.Helper()
+	queries := make(chan string, 100)
+	writes := make(chan []string, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queries <- r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+		writes <- strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		w.WriteHeader(status)
+	}))
+	return server, queries, writes
+}
+
+// readInflux reads a single write request and returns its lines without
+// their timestamps, checking that each timestamp is recent.
+func readInflux(t *testing.T, writes chan []string) []string {
+	t.Helper()
+	select {
+	case lines := <-writes:
+		result := make([]string, 0, len(lines))
+		for _, line := range lines {
+			i := strings.LastIndex(line, " ")
+			timestamp, err := strconv.ParseInt(line[i+1:], 10, 64)
+			if err != nil || time.Since(time.Unix(0, timestamp)) > time.Minute {
+				t.Fatalf("Expected a recent timestamp. Found '%s'", line)
+			}
+			result = append(result, line[:i])
+		}
+		return result
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a write request")
+	}
+	return nil
+}
+
+func ExampleInfluxClient() {
+	client := metrics.NewInfluxClient("http://127.0.0.1:8086", "mydb", time.Second)
+	defer client.Close()
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("requests.count")
+}
+
+func TestInfluxClient(t *testing.T) {
+	server, queries, writes := listenInflux(t, http.StatusNoContent)
+	defer server.Close()
+
+	var client metrics.Client
+	client = metrics.NewInfluxClient(server.URL, "testing", time.Hour).WithPrefix("testing.")
+
+	client.Incr("one")
+	client.Decr("one")
+	client.Count("two", 2)
+	client.CountFloat("work", 0.25)
+	client.Gauge("memory", 1024)
+	client.GaugeInt("queue", 5)
+	client.GaugeDelta("queue", 1)
+	client.Set("users", `alice "the" admin`)
+	client.Timing("timing", 1500*time.Microsecond)
+	client.TimingMs("timing", 2.5)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.WithTags(map[string]string{
+		"tag2": "value 2",
+		"tag1": "value1",
+		"tag3": "",
+	}).Incr("tagged")
+	client.WithTagValues("team", "a", "b").Incr("with space")
+	client.WithRate(0).Incr("never")
+
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed. Found '%v'", err)
+	}
+
+	ExpectEqual(t, "POST /write?db=testing&precision=ns", <-queries)
+	ExpectEqual(t, []string{
+		"testing.one count=1i",
+		"testing.one count=-1i",
+		"testing.two count=2i",
+		"testing.work count=0.25",
+		"testing.memory gauge=1024",
+		"testing.queue gauge=5",
+		`testing.users set="alice \"the\" admin"`,
+		"testing.timing timing=1.5",
+		"testing.timing timing=2.5",
+		"testing.histo histogram=123",
+		"testing.distro distribution=999",
+		`testing.tagged,tag1=value1,tag2=value\ 2 count=1i`,
+		`testing.with\ space,team=a\,b count=1i`,
+	}, readInflux(t, writes))
+
+	// Flushing an empty buffer does not send a request.
+	client.Flush()
+
+	// Closing flushes anything left in the buffer.
+	client.Incr("closed")
+	client.Close()
+	<-queries
+	ExpectEqual(t, []string{"testing.closed count=1i"}, readInflux(t, writes))
+
+	// Closing twice must not panic.
+	client.Close()
+}
+
+func TestInfluxClientGaugeWithTimestamp(t *testing.T) {
+	server, _, writes := listenInflux(t, http.StatusNoContent)
+	defer server.Close()
+
+	client := metrics.NewInfluxClient(server.URL+"/", "testing", time.Hour)
+	defer client.Close()
+
+	client.GaugeWithTimestamp("backfill", 5, time.Unix(1500000000, 0))
+	client.Flush()
+
+	ExpectEqual(t, []string{"backfill gauge=5 1500000000000000000"}, <-writes)
+}
+
+func TestInfluxClientFlushInterval(t *testing.T) {
+	server, _, writes := listenInflux(t, http.StatusNoContent)
+	defer server.Close()
+
+	client := metrics.NewInfluxClient(server.URL, "testing", 10*time.Millisecond)
+	defer client.Close()
+
+	client.Incr("one")
+	ExpectEqual(t, []string{"one count=1i"}, readInflux(t, writes))
+}
+
+func TestInfluxClientWriteError(t *testing.T) {
+	server, _, _ := listenInflux(t, http.StatusBadRequest)
+	defer server.Close()
+
+	client := metrics.NewInfluxClient(server.URL, "testing", time.Hour)
+	defer client.Close()
+
+	client.Incr("one")
+	err := client.Flush()
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("Expected a write error. Found '%v'", err)
+	}
+}
+
+func TestInfluxClientFlushError(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	server, _, writes := listenInflux(t, http.StatusBadRequest)
+	defer server.Close()
+
+	client := metrics.NewInfluxClient(server.URL, "testing", 10*time.Millisecond)
+	client.Incr("one")
+	readInflux(t, writes)
+
+	// The error is logged before the background goroutine stops.
+	client.Close()
+	if !strings.Contains(warnings.String(), "metrics: writing to influx: metrics: influx write failed with status 400") {
+		t.Fatalf("Expected the write error to be logged. Found '%s'", warnings.String())
+	}
+}
+
+func TestInfluxClientFullBuffer(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := metrics.NewInfluxClient(server.URL, "testing", time.Hour)
+	defer client.Close()
+	defer close(release)
+
+	// A full buffer is handed to the background goroutine, while calls keep
+	// buffering without waiting for the slow server.
+	name := strings.Repeat("a", 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			client.Incr(name)
+		}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a write request for the full buffer")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected calls not to wait for the server")
+	}
+}
+
+func TestInfluxClientInvalidFloats(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	server, _, writes := listenInflux(t, http.StatusNoContent)
+	defer server.Close()
+
+	client := metrics.NewInfluxClient(server.URL, "testing", time.Hour)
+	defer client.Close()
+
+	client.Gauge("memory", math.NaN())
+	client.Histogram("histo", math.Inf(1))
+	client.Gauge("memory", 1024)
+	client.Flush()
+
+	// A single invalid value would otherwise lose the whole batch.
+	ExpectEqual(t, []string{"memory gauge=1024"}, readInflux(t, writes))
+	ExpectEqual(t, 1, strings.Count(warnings.String(), "influx does not support NaN or infinite values"))
+}
+
+func TestInfluxClientInvalidOptions(t *testing.T) {
+	tests := map[string]func(){
+		"interval": func() { metrics.NewInfluxClient("http://127.0.0.1:8086", "testing", 0) },
+		"database": func() { metrics.NewInfluxClient("http://127.0.0.1:8086", "", time.Second) },
+		"scheme":   func() { metrics.NewInfluxClient("127.0.0.1:8086", "testing", time.Second) },
+	}
+
+	for name, fn := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Expected a panic")
+				}
+			}()
+			fn()
+		})
+	}
+}
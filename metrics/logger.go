@@ -1,14 +1,21 @@
 package metrics
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/mattn/go-isatty"
 	"github.com/mgutz/ansi"
 )
@@ -24,18 +31,64 @@ var (
 )
 
 // InfoLogger provides a method for logging info messages and is implemented
-// by the standard `log` package as well as various other packages.
+// by the standard `log` package as well as various other packages. It does
+// not need to be safe for concurrent use when passed to `NewLoggerClient`.
 type InfoLogger interface {
 	Printf(format string, args ...interface{})
 }
 
 // LoggerClient simple dumps metrics into the log. Useful when running
 // locally for testing. Can be used with multiple different logging systems.
+//
+// A client is safe for concurrent use. Writes to the logger from the client
+// and all of its clones are serialized by a shared mutex, so a logger which
+// is not goroutine-safe, like a slice-backed test recorder, is never called
+// concurrently. A client created as a struct literal instead of via
+// `NewLoggerClient` has no mutex and requires a goroutine-safe logger. A rand
+// source set via `WithRandSource` is called without the mutex, so it must be
+// goroutine-safe if the client is shared.
 type LoggerClient struct {
-	logger InfoLogger
-	colors bool
-	rate   float64
+	logger    InfoLogger
+	colors    bool
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	random    func() float64
+	json      bool
+	rates     map[string]float64
+	minRates  map[string]float64
+	redact    func(key, value string) string
+	clashes   bool
+	names     nameMode
+	limiter   *cardinalityLimiter
+	reserved  reservedMode
+	samples   *loggerSamples
+	negative  bool
+	warnings  *warnThrottle
+	typeTags  map[string]map[string]string
+	hashed    bool
+	now       func() time.Time
+	output    *sync.Mutex
+	labels    map[string]string
+	timestamp time.Time
+}
+
+// loggerSamples buffers samples for the `WithSummaries` mode and is shared
+// by a logger client and all of its clones.
+type loggerSamples struct {
+	mutex  sync.Mutex
+	series map[string]*loggerSeries
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// loggerSeries contains the buffered samples for a metric name and tags.
+type loggerSeries struct {
+	kind   string
+	name   string
 	tagMap map[string]string
+	values []float64
 }
 
 // NewLoggerClient creates a new logging client. If `logger` is `nil` then it
@@ -47,7 +100,26 @@ type LoggerClient struct {
 // You can use your own logger and enable colorized output manually via:
 //
 //   metrics.NewLoggerClient(myLog).Colorized()
-func NewLoggerClient(logger InfoLogger) *LoggerClient {
+//
+// Options can be used to configure the initial tags, sample rate, and metric
+// name prefix in a single call:
+//
+//   metrics.NewLoggerClient(nil,
+//     metrics.WithInitialTags(map[string]string{"tag": "value"}),
+//     metrics.WithInitialRate(0.5),
+//     metrics.WithPrefix("myprefix."),
+//   )
+//
+// The `WithJSON` option logs each call as a single line of JSON instead of
+// the default human-readable format. The `WithSummaries` option logs
+// periodic percentile summaries of timings, histograms, and distributions
+// instead of every sample, similar to what DataDog would show.
+func NewLoggerClient(logger InfoLogger, options ...Option) *LoggerClient {
+	o, err := resolveOptions(options)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	colors := false
 	if logger == nil {
 		logger = log.New(os.Stdout, "", 0)
@@ -57,138 +129,702 @@ func NewLoggerClient(logger InfoLogger) *LoggerClient {
 		}
 	}
 
+	limiter := newCardinalityLimiter(o.TagLimit, o.TagOverflow)
+	warnings := newWarnThrottle(o.WarningInterval)
 	client := &LoggerClient{
-		logger: logger,
-		colors: colors,
-		rate:   1.0,
+		logger:   logger,
+		colors:   colors,
+		rate:     o.Rate,
+		tagMap:   combine(nil, limiter.limitTags(o.Reserved.checkTags(o.Names.sanitizeTags(redactTags(o.TagRedactor, o.Tags)), warnings))),
+		prefix:   o.Prefix,
+		random:   o.Random,
+		json:     o.JSON,
+		rates:    o.MetricRates,
+		minRates: o.MinRates,
+		redact:   o.TagRedactor,
+		clashes:  o.TagCollisions,
+		names:    o.Names,
+		limiter:  limiter,
+		reserved: o.Reserved,
+		negative: o.NegativeChecks,
+		warnings: warnings,
+		typeTags: o.TypeTags,
+		now:      o.Clock,
+		hashed:   o.HashSampling,
+		output:   &sync.Mutex{},
+		labels:   o.TypeLabels,
+	}
+
+	if o.Summaries {
+		client.samples = &loggerSamples{
+			series: map[string]*loggerSeries{},
+			stop:   make(chan struct{}),
+			done:   make(chan struct{}),
+		}
+		if o.SummaryInterval > 0 {
+			go client.run(o.SummaryInterval)
+		} else {
+			close(client.samples.done)
+		}
 	}
 
 	return client
 }
 
+// run periodically logs summaries until the client is closed.
+func (c *LoggerClient) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(c.samples.done)
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.samples.stop:
+			return
+		}
+	}
+}
+
+// NewLoggerClientWriter creates a new logging client which writes each
+// metric as a line of text to `w`, e.g. a file or a `bytes.Buffer`. Colorized
+// output is disabled by default.
+func NewLoggerClientWriter(w io.Writer, options ...Option) *LoggerClient {
+	return NewLoggerClient(log.New(w, "", 0), options...)
+}
+
+// defaultLogger is used when a client has no logger, e.g. when it was
+// created as a struct literal instead of via `NewLoggerClient`.
+var defaultLogger = log.New(os.Stdout, "", 0)
+
+// printf logs a message while holding the output lock, if any, so that it
+// cannot be interleaved with the lines of a batch.
+func (c *LoggerClient) printf(format string, args ...interface{}) {
+	if c.output != nil {
+		c.output.Lock()
+		defer c.output.Unlock()
+	}
+	c.logf(format, args...)
+}
+
+// logf logs a message, falling back to the default stdout logger when the
+// client has no logger.
+func (c *LoggerClient) logf(format string, args ...interface{}) {
+	if c.logger == nil {
+		defaultLogger.Printf(format, args...)
+		return
+	}
+	c.logger.Printf(format, args...)
+}
+
+// sampledSeries returns whether a metric should be logged at the given rate,
+// which is decided by a hash of its name and tags with `WithHashSampling`.
+func (c *LoggerClient) sampledSeries(rate float64, name string) bool {
+	if c.hashed {
+		return hashSampled(rate, c.prefix+name, c.tagMap)
+	}
+	return c.sampled(rate)
+}
+
+// sampled returns whether a call should be logged at the given rate. A
+// client without a random source falls back to `rand.Float64`.
+func (c *LoggerClient) sampled(rate float64) bool {
+	if rate >= 1.0 {
+		return true
+	}
+	if c.random == nil {
+		return rand.Float64() < rate
+	}
+	return c.random() < rate
+}
+
+// ShouldSample returns whether a call at this client's current rate would be
+// emitted, so that expensive tag values can be computed only when needed:
+//
+//   if client.ShouldSample() {
+//     client.Always().WithTag("plan", expensivePlanLookup()).Incr("requests")
+//   }
+//
+// It consumes a sample decision from the client's random source, e.g. one
+// value of a `WithRandSource` sequence. Since the guarded call would be
+// sampled again, emit it via `Always()` as above. Per-metric rates set via
+// `WithMetricRate` are not considered.
+func (c *LoggerClient) ShouldSample() bool {
+	return c.sampled(c.rate)
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *LoggerClient) clone() *LoggerClient {
+	clone := *c
+	return &clone
+}
+
 // Colorized enables colored terminal output.
 func (c *LoggerClient) Colorized() *LoggerClient {
-	return &LoggerClient{
-		logger: c.logger,
-		rate:   c.rate,
-		colors: true,
-		tagMap: c.tagMap,
+	clone := c.clone()
+	clone.colors = true
+	return clone
+}
+
+// dropNegative logs and drops negative values when negative value checks
+// are enabled.
+func (c *LoggerClient) dropNegative(kind string, name string, value float64) bool {
+	if err := checkNegative(c.negative, kind, c.prefix+name, value); err != nil {
+		c.warnings.warnf("%v", err)
+		return true
 	}
+	return false
 }
 
 // WithTags clones this client with additional tags. Duplicate tags overwrite
 // the existing value.
 func (c *LoggerClient) WithTags(tags map[string]string) Client {
-	return &LoggerClient{
-		logger: c.logger,
-		rate:   c.rate,
-		colors: c.colors,
-		tagMap: combine(c.tagMap, tags),
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	added := c.limiter.limitTags(c.reserved.checkTags(c.names.sanitizeTags(redactTags(c.redact, tags)), c.warnings))
+	warnCollisions(c.clashes, c.tagMap, added, c.warnings)
+	clone.tagMap = combine(c.tagMap, added)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *LoggerClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *LoggerClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *LoggerClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *LoggerClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *LoggerClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *LoggerClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *LoggerClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *LoggerClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions, which is shown after the value just like
+// `GaugeWithTimestamp`. Summaries ignore the timestamp.
+func (c *LoggerClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *LoggerClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *LoggerClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+// The lines of a batch are logged contiguously, without interleaving lines
+// logged by other goroutines.
+func (c *LoggerClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// batchLines collects the lines logged by a batch.
+type batchLines struct {
+	lines []string
+}
+
+// Printf adds a formatted line.
+func (b *batchLines) Printf(format string, args ...interface{}) {
+	b.lines = append(b.lines, fmt.Sprintf(format, args...))
+}
+
+// sendBatch formats the calls of a batch using a clone which collects the
+// lines, then logs them all while holding the output lock.
+func (c *LoggerClient) sendBatch(calls []func(Client)) {
+	lines := &batchLines{}
+	clone := c.clone()
+	clone.logger = lines
+	clone.output = nil
+	replay(clone, calls)
+
+	if c.output != nil {
+		c.output.Lock()
+		defer c.output.Unlock()
+	}
+	for _, line := range lines.lines {
+		c.logf("%s", line)
 	}
 }
 
 // WithRate clones this client with a given sample rate. Subsequent calls
 // will be limited to logging metrics at this rate.
 func (c *LoggerClient) WithRate(rate float64) Client {
-	return &LoggerClient{
-		logger: c.logger,
-		rate:   rate,
-		colors: c.colors,
-		tagMap: c.tagMap,
-	}
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
 }
 
-// print out the metric call, taking into account sample rate.
-func (c *LoggerClient) print(t string, name string, value interface{}, sampled interface{}) {
-	r := fmt.Sprintf("%v", c.rate)
-	v := value
-	s := sampled
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *LoggerClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
 
-	if c.colors {
-		name = cname(name)
-		r = crate(r)
-		v = cvalue(fmt.Sprintf("%v", value))
-		s = csampled(fmt.Sprintf("%v", sampled))
+// Always clones this client with the sample rate reset to 1.0 and any
+// per-metric rates set via `WithMetricRate` removed, so that critical metrics
+// are always emitted. Tags and prefix are preserved.
+func (c *LoggerClient) Always() Client {
+	clone := c.clone()
+	clone.rate = 1.0
+	clone.rates = nil
+	return clone
+}
+
+// print out the metric call, taking into account sample rate. The line is
+// rendered via `FormatMetric`, so sampled counts also show the estimated
+// total the server will extrapolate, e.g. `Count name:5 (5 / 0.5 = 10)`.
+func (c *LoggerClient) print(m Metric) {
+	if suppressed() {
+		return
+	}
+	rate := metricRate(c.rates, c.minRates, m.Name, c.rate)
+	if m.Type == KindGaugeDelta && rate > 0 {
+		rate = 1.0
+	}
+	if !c.sampledSeries(rate, m.Name) {
+		return
 	}
 
-	if c.rate == 1.0 {
-		c.logger.Printf("%s %s:%v %v", t, name, v, c.getTags())
+	name, ok := c.names.check(c.prefix+m.Name, c.Tags, c.warnings)
+	if !ok {
 		return
 	}
 
-	if rand.Float64() < c.rate {
-		if value == sampled {
-			c.logger.Printf("%s %s:%v (%v) %v", t, name, v, r, c.getTags())
-		} else {
-			c.logger.Printf("%s %s:%v (%v * %v) %v", t, name, s, v, r, c.getTags())
+	m.Name = name
+	m.Tags = combine(nil, typeTagMap(c.typeTags, string(m.Type), c.tagMap))
+	m.Rate = rate
+
+	if c.json {
+		var value interface{} = m.Value
+		if m.Type == KindSet {
+			value = m.Text
+		}
+		var timestamp *time.Time
+		if !m.Timestamp.IsZero() {
+			timestamp = &m.Timestamp
+		}
+		c.printJSON(&loggerMetric{
+			Type:      string(m.Type),
+			Name:      m.Name,
+			Value:     value,
+			Tags:      m.Tags,
+			Rate:      m.Rate,
+			Timestamp: timestamp,
+		})
+		return
+	}
+
+	c.printf("%s", formatMetric(m, c.labels, c.colors))
+}
+
+// loggerMetric is the JSON representation of a metric call.
+type loggerMetric struct {
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Value     interface{}       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+	Rate      float64           `json:"rate"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+}
+
+// loggerEvent is the JSON representation of an event call.
+type loggerEvent struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Text      string            `json:"text"`
+	Priority  string            `json:"priority"`
+	AlertType string            `json:"alert_type"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// loggerServiceCheck is the JSON representation of a service check call.
+type loggerServiceCheck struct {
+	Type    string            `json:"type"`
+	Name    string            `json:"name"`
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Tags    map[string]string `json:"tags"`
+}
+
+// printJSON logs a single line of JSON. Map keys are sorted when encoded, so
+// tags are always in a stable order.
+func (c *LoggerClient) printJSON(v interface{}) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		c.printf("%v", err)
+		return
+	}
+	c.printf("%s", encoded)
+}
+
+// formatTags returns the given tags in a stable, sorted format like
+// `[tag1=value1 tag2=value2]`.
+func (c *LoggerClient) formatTags(tagMap map[string]string) string {
+	return formatTagMap(tagMap, c.colors)
+}
+
+// summarize buffers a sample when summaries are enabled, taking into account
+// the sample rate, and returns whether the sample was handled.
+func (c *LoggerClient) summarize(kind string, name string, value float64) bool {
+	if suppressed() {
+		return true
+	}
+	if c.samples == nil {
+		return false
+	}
+
+	rate := metricRate(c.rates, c.minRates, name, c.rate)
+	if !c.sampledSeries(rate, name) {
+		return true
+	}
+
+	name, ok := c.names.check(c.prefix+name, c.Tags, c.warnings)
+	if !ok {
+		return true
+	}
+
+	tagMap := typeTagMap(c.typeTags, strings.ToLower(kind), c.tagMap)
+	key := seriesKey(kind+" "+name, tagMap)
+	c.samples.mutex.Lock()
+	defer c.samples.mutex.Unlock()
+	series := c.samples.series[key]
+	if series == nil {
+		series = &loggerSeries{
+			kind:   kind,
+			name:   name,
+			tagMap: tagMap,
 		}
+		c.samples.series[key] = series
+	}
+	series.values = append(series.values, value)
+	return true
+}
+
+// percentile returns the nearest-rank percentile `p` of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
 	}
+	return sorted[rank]
+}
+
+// loggerSummary is the JSON representation of a summary of samples.
+type loggerSummary struct {
+	Type  string            `json:"type"`
+	Name  string            `json:"name"`
+	Count int               `json:"count"`
+	Min   float64           `json:"min"`
+	Max   float64           `json:"max"`
+	P50   float64           `json:"p50"`
+	P95   float64           `json:"p95"`
+	P99   float64           `json:"p99"`
+	Tags  map[string]string `json:"tags"`
 }
 
-func (c *LoggerClient) getTags() string {
-	if !c.colors {
-		return fmt.Sprintf("%v", c.tagMap)
+// Flush logs a summary of the buffered samples when summaries are enabled,
+// sorted by metric name and tags, and clears the buffer. Otherwise it is a
+// no-op.
+func (c *LoggerClient) Flush() error {
+	if c.samples == nil {
+		return nil
 	}
 
-	keys := make([]string, 0, len(c.tagMap))
-	for k := range c.tagMap {
-		keys = append(keys, k)
+	c.samples.mutex.Lock()
+	series := c.samples.series
+	c.samples.series = map[string]*loggerSeries{}
+	c.samples.mutex.Unlock()
+
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 
-	tags := ""
 	for _, key := range keys {
-		if tags != "" {
-			tags += " "
-		}
+		c.printSummary(series[key])
+	}
+	return nil
+}
 
-		tags += fmt.Sprintf("%s:%s", ctag(key), c.tagMap[key])
+// printSummary logs the count, min, max, and percentiles of a series.
+// Timings are shown in milliseconds.
+func (c *LoggerClient) printSummary(series *loggerSeries) {
+	values := series.values
+	sort.Float64s(values)
+	summary := loggerSummary{
+		Type:  strings.ToLower(series.kind) + "_summary",
+		Name:  series.name,
+		Count: len(values),
+		Min:   values[0],
+		Max:   values[len(values)-1],
+		P50:   percentile(values, 0.5),
+		P95:   percentile(values, 0.95),
+		P99:   percentile(values, 0.99),
+		Tags:  combine(nil, series.tagMap),
+	}
+
+	if c.json {
+		c.printJSON(&summary)
+		return
+	}
+
+	format := func(v float64) string {
+		if series.kind == "Timing" {
+			return milliseconds(v).String()
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
 	}
 
-	return "map[" + tags + "]"
+	name := series.name
+	if c.colors {
+		name = cname(name)
+	}
+	c.printf("%s %s count=%d min=%s max=%s p50=%s p95=%s p99=%s %v",
+		typeLabel(c.labels, Kind(strings.ToLower(series.kind))), name, summary.Count, format(summary.Min), format(summary.Max),
+		format(summary.P50), format(summary.P95), format(summary.P99), c.formatTags(series.tagMap))
 }
 
-// Close on LoggerClient is a no-op
+// Close logs any remaining summaries and stops the summary interval when
+// summaries are enabled. Otherwise it is a no-op.
 func (c *LoggerClient) Close() error {
-	return nil
+	if c.samples == nil {
+		return nil
+	}
+	c.samples.once.Do(func() {
+		close(c.samples.stop)
+		<-c.samples.done
+	})
+	return c.Flush()
 }
 
 // Count adds some value to a metric.
 func (c *LoggerClient) Count(name string, value int64) {
-	c.print("Count", name, value, float64(value)*c.rate)
+	c.print(Metric{Type: KindCount, Name: name, Value: float64(value), Timestamp: c.timestamp})
 }
 
-// Incr adds one to a metric.
+// Incr adds one to a metric. It is sampled like any other count rather
+// than always logged, and a sampled call shows the extrapolated total just
+// like the DataDog agent would compute it, e.g. `Count name:1 (1 / 0.5 = 2)`.
+// Use `Always()` for rare events which must never be dropped.
 func (c *LoggerClient) Incr(name string) {
 	c.Count(name, 1)
 }
 
-// Decr subtracts one from a metric.
+// Decr subtracts one from a metric. It is sampled and extrapolated just like
+// `Incr`, e.g. `Count name:-1 (-1 / 0.5 = -2)`.
 func (c *LoggerClient) Decr(name string) {
 	c.Count(name, -1)
 }
 
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call. Per-metric rates set via `WithMetricRate` do not apply.
+func (c *LoggerClient) CountWithRate(name string, value int64, rate float64) {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	clone.rates = nil
+	clone.Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *LoggerClient) CountFloat(name string, value float64) {
+	c.print(Metric{Type: KindCount, Name: name, Value: value, Timestamp: c.timestamp})
+}
+
 // Gauge sets a numeric value.
 func (c *LoggerClient) Gauge(name string, value float64) {
-	c.print("Gauge", name, value, value)
+	c.print(Metric{Type: KindGauge, Name: name, Value: value, Timestamp: c.timestamp})
 }
 
-// Event tracks an event that may be relevant to other metrics.
+// GaugeInt sets a numeric integer value.
+func (c *LoggerClient) GaugeInt(name string, value int64) {
+	c.print(Metric{Type: KindGauge, Name: name, Value: float64(value), Timestamp: c.timestamp})
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time, which is shown
+// after the value, e.g. `Gauge name:5@2020-01-02T03:04:05Z`.
+func (c *LoggerClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.print(Metric{Type: KindGauge, Name: name, Value: value, Timestamp: timestamp})
+}
+
+// GaugeDelta adjusts a gauge by a signed amount. Deltas are never sampled,
+// since a dropped delta would leave the gauge wrong, so the client's rate is
+// ignored unless it is zero.
+func (c *LoggerClient) GaugeDelta(name string, delta float64) {
+	c.print(Metric{Type: KindGaugeDelta, Name: name, Value: delta})
+}
+
+// Set counts the number of unique values for a metric.
+func (c *LoggerClient) Set(name string, value string) {
+	c.print(Metric{Type: KindSet, Name: name, Text: value})
+}
+
+// Event tracks an event that may be relevant to other metrics. Events are
+// sampled at the client's rate just like metrics. The event's own tags are
+// merged with the client tags, overriding any with the same key, and line
+// breaks in the title and text are escaped so each event is a single line.
 func (c *LoggerClient) Event(e *statsd.Event) {
-	c.logger.Printf("Event %s\n%s %v", e.Title, e.Text, c.tagMap)
+	if suppressed() {
+		return
+	}
+	if !c.sampled(c.rate) {
+		return
+	}
+	tags := combine(c.tagMap, stringsToMap(e.Tags))
+	if c.json {
+		c.printJSON(&loggerEvent{
+			Type:      "event",
+			Title:     e.Title,
+			Text:      e.Text,
+			Priority:  eventPriority(e),
+			AlertType: eventAlertType(e),
+			Tags:      tags,
+		})
+		return
+	}
+	c.printf("Event %s (%s, %s): %s %v", escapeNewlines(e.Title), eventPriority(e), eventAlertType(e), escapeNewlines(e.Text), c.formatTags(tags))
+}
+
+// ServiceCheck reports the status of a service. Like events, the check's own
+// tags are merged with the client tags, overriding any with the same key,
+// and line breaks in the message are escaped so each check is a single line.
+func (c *LoggerClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	if suppressed() {
+		return
+	}
+	tags := combine(c.tagMap, stringsToMap(sc.Tags))
+	if c.json {
+		c.printJSON(&loggerServiceCheck{
+			Type:    "service_check",
+			Name:    sc.Name,
+			Status:  serviceCheckStatus(sc.Status),
+			Message: sc.Message,
+			Tags:    tags,
+		})
+		return
+	}
+	c.printf("ServiceCheck %s:%s %s %v", sc.Name, serviceCheckStatus(sc.Status), escapeNewlines(sc.Message), c.formatTags(tags))
 }
 
 // Timing tracks a duration.
 func (c *LoggerClient) Timing(name string, value time.Duration) {
-	c.print("Timing", name, value, value)
+	if c.dropNegative("timing", name, float64(value)/float64(time.Millisecond)) {
+		return
+	}
+	if c.summarize("Timing", name, float64(value)/float64(time.Millisecond)) {
+		return
+	}
+	c.print(Metric{Type: KindTiming, Name: name, Value: float64(value) / float64(time.Millisecond)})
+}
+
+// TimingMs tracks a duration given in milliseconds, e.g. `Timing name:1.5ms`.
+func (c *LoggerClient) TimingMs(name string, ms float64) {
+	if c.dropNegative("timing", name, ms) {
+		return
+	}
+	if c.summarize("Timing", name, ms) {
+		return
+	}
+	c.print(Metric{Type: KindTiming, Name: name, Value: ms})
+}
+
+// milliseconds is a float which displays with a unit, e.g. `123ms`, while
+// still being encoded as a plain number in JSON.
+type milliseconds float64
+
+func (ms milliseconds) String() string {
+	return strconv.FormatFloat(float64(ms), 'f', -1, 64) + "ms"
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *LoggerClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *LoggerClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *LoggerClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock set via `WithClock`, or `time.Now`.
+func (c *LoggerClient) clock() func() time.Time {
+	if c.now == nil {
+		return time.Now
+	}
+	return c.now
 }
 
 // Histogram sets a numeric value while tracking min/max/avg/p95/etc.
 func (c *LoggerClient) Histogram(name string, value float64) {
-	c.print("Histogram", name, value, value)
+	if c.dropNegative("histogram", name, value) {
+		return
+	}
+	if c.summarize("Histogram", name, value) {
+		return
+	}
+	c.print(Metric{Type: KindHistogram, Name: name, Value: value})
 }
 
 // Distribution tracks the statistical distribution of a set of values.
 func (c *LoggerClient) Distribution(name string, value float64) {
-	c.print("Distribution", name, value, value)
+	if c.dropNegative("distribution", name, value) {
+		return
+	}
+	if c.summarize("Distribution", name, value) {
+		return
+	}
+	c.print(Metric{Type: KindDistribution, Name: name, Value: value, Timestamp: c.timestamp})
 }
@@ -1,11 +1,22 @@
 package metrics_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/istreamlabs/go-metrics/metrics"
 )
 
@@ -25,7 +36,7 @@ func ExampleLoggerClient() {
 	client.WithTags(map[string]string{
 		"tag1": "value1",
 	}).Incr("requests.count")
-	// Output: Count requests.count:1 map[tag1:value1]
+	// Output: Count requests.count:1 [tag1=value1]
 }
 
 func TestLoggerClient(t *testing.T) {
@@ -47,15 +58,30 @@ func TestLoggerClient(t *testing.T) {
 	client.Gauge("memory", 1024)
 	client.Histogram("histo", 123)
 	client.Distribution("distro", 999)
+	client.Flush()
 	client.Close()
 
-	ExpectEqual(t, "Count one:1 map[]", recorder.messages[0])
-	ExpectEqual(t, "Event title\ndesc map[]", recorder.messages[1])
-	ExpectEqual(t, "Timing two:2s map[tag1:override]", recorder.messages[2])
-	ExpectEqual(t, "Count one:-1 map[]", recorder.messages[3])
-	ExpectEqual(t, "Gauge memory:1024 map[]", recorder.messages[4])
-	ExpectEqual(t, "Histogram histo:123 map[]", recorder.messages[5])
-	ExpectEqual(t, "Distribution distro:999 map[]", recorder.messages[6])
+	ExpectEqual(t, "Count one:1 []", recorder.messages[0])
+	ExpectEqual(t, "Event title (normal, info): desc []", recorder.messages[1])
+	ExpectEqual(t, "Timing two:2s [tag1=override]", recorder.messages[2])
+	ExpectEqual(t, "Count one:-1 []", recorder.messages[3])
+	ExpectEqual(t, "Gauge memory:1024 []", recorder.messages[4])
+	ExpectEqual(t, "Histogram histo:123 []", recorder.messages[5])
+	ExpectEqual(t, "Distribution distro:999 []", recorder.messages[6])
+
+	client.Set("users", "alice")
+	client.Set("users", "bob")
+	ExpectEqual(t, "Set users:alice []", recorder.messages[7])
+	ExpectEqual(t, "Set users:bob []", recorder.messages[8])
+
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).ServiceCheck(&statsd.ServiceCheck{
+		Name:    "db",
+		Status:  statsd.Critical,
+		Message: "connection refused",
+	})
+	ExpectEqual(t, "ServiceCheck db:CRITICAL connection refused [tag1=value1]", recorder.messages[9])
 
 	// Make sure the call works, but since it is randomly sampled we have no
 	// assertion to make.
@@ -69,5 +95,1041 @@ func TestLoggerClient(t *testing.T) {
 		"tag1": "val1",
 		"tag2": "val2",
 	}).Incr("colored")
-	ExpectEqual(t, "Count \x1b[38;5;208mcolored\x1b[0m:\x1b[38;5;32m1\x1b[0m map[\x1b[38;5;133mtag1\x1b[0m:val1 \x1b[38;5;133mtag2\x1b[0m:val2]", recorder.messages[len(recorder.messages)-1])
+	ExpectEqual(t, "Count \x1b[38;5;208mcolored\x1b[0m:\x1b[38;5;32m1\x1b[0m [\x1b[38;5;133mtag1\x1b[0m=val1 \x1b[38;5;133mtag2\x1b[0m=val2]", recorder.messages[len(recorder.messages)-1])
+}
+
+func TestLoggerClientOptions(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithInitialTags(map[string]string{
+			"tag1": "value1",
+		}),
+		metrics.WithInitialRate(1.0),
+		metrics.WithPrefix("myprefix."),
+	)
+
+	client.Incr("one")
+	client.WithTags(map[string]string{
+		"tag1": "override",
+	}).Gauge("two", 2)
+
+	ExpectEqual(t, "Count myprefix.one:1 [tag1=value1]", recorder.messages[0])
+	ExpectEqual(t, "Gauge myprefix.two:2 [tag1=override]", recorder.messages[1])
+
+	// A rate of zero should never log anything.
+	recorder = &LogRecorder{}
+	metrics.NewLoggerClient(recorder, metrics.WithInitialRate(0)).Incr("never")
+	ExpectEqual(t, 0, len(recorder.messages))
+}
+
+func TestLoggerClientWithPrefix(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	client.WithPrefix("a.").WithPrefix("b.").Incr("one")
+	client.WithPrefix("").Incr("two")
+	client.WithPrefix("a.").WithTags(map[string]string{
+		"tag1": "value1",
+	}).WithRate(1.0).Gauge("three", 3)
+
+	ExpectEqual(t, "Count a.b.one:1 []", recorder.messages[0])
+	ExpectEqual(t, "Count two:1 []", recorder.messages[1])
+	ExpectEqual(t, "Gauge a.three:3 [tag1=value1]", recorder.messages[2])
+}
+
+func TestLoggerClientWithTag(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	client.WithTag("tag1", "value1").WithTag("tag2", "value2").Incr("one")
+	client.WithTag("tag1", "value1").WithTag("tag1", "override").Incr("two")
+
+	ExpectEqual(t, "Count one:1 [tag1=value1 tag2=value2]", recorder.messages[0])
+	ExpectEqual(t, "Count two:1 [tag1=override]", recorder.messages[1])
+}
+
+func TestLoggerClientTagOrder(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	tags := map[string]string{}
+	for i := 9; i >= 0; i-- {
+		tags[fmt.Sprintf("tag%d", i)] = fmt.Sprintf("value%d", i)
+	}
+
+	for i := 0; i < 10; i++ {
+		client.WithTags(tags).Incr("ordered")
+		ExpectEqual(t, "Count ordered:1 [tag0=value0 tag1=value1 tag2=value2 tag3=value3 tag4=value4 tag5=value5 tag6=value6 tag7=value7 tag8=value8 tag9=value9]", recorder.messages[i])
+	}
+}
+
+// sequence returns a rand source which cycles through the given values.
+func sequence(values ...float64) func() float64 {
+	i := 0
+	return func() float64 {
+		value := values[i%len(values)]
+		i++
+		return value
+	}
+}
+
+func TestLoggerClientAdditionalRate(t *testing.T) {
+	recorder := &LogRecorder{}
+	r := rand.New(rand.NewSource(7))
+	client := metrics.NewLoggerClient(recorder, metrics.WithRandSource(r.Float64))
+
+	// Chained `WithRate` calls replace the rate rather than compound it.
+	ExpectEqual(t, 0.5, client.WithRate(0.5).WithRate(0.5).Rate())
+	ExpectEqual(t, 0.25, client.WithRate(0.5).WithAdditionalRate(0.5).Rate())
+	ExpectEqual(t, 0.5, client.WithRate(0.5).WithAdditionalRate(2).Rate())
+	ExpectEqual(t, 0.0, client.WithRate(0.5).WithAdditionalRate(-1).Rate())
+	ExpectEqual(t, 0.5, client.WithRate(0.25).WithAdditionalRate(0.5).WithRate(0.5).Rate())
+
+	layered := client.WithRate(0.5).WithAdditionalRate(0.5)
+	for i := 0; i < 10000; i++ {
+		layered.Incr("requests")
+	}
+	if n := len(recorder.messages); n < 2300 || n > 2700 {
+		t.Fatalf("Expected about 2500 of 10000 calls at an effective rate of 0.25. Found %d", n)
+	}
+	ExpectEqual(t, "Count requests:1 (1 / 0.25 = 4) []", recorder.messages[0])
+}
+
+func TestLoggerClientSampledIncr(t *testing.T) {
+	recorder := &LogRecorder{}
+	r := rand.New(rand.NewSource(3))
+	client := metrics.NewLoggerClient(recorder, metrics.WithRandSource(r.Float64)).WithRate(0.5)
+
+	for i := 0; i < 4; i++ {
+		client.Incr("x")
+		client.Decr("y")
+	}
+	client.Always().Incr("z")
+
+	ExpectEqual(t, []string{
+		"Count y:-1 (-1 / 0.5 = -2) []",
+		"Count x:1 (1 / 0.5 = 2) []",
+		"Count z:1 []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientMinRate(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.3, 0.3, 0.3, 0.3)),
+		metrics.WithMetricRate("slow", 0.1),
+		metrics.WithMinRate("critical", 0.5),
+		metrics.WithMinRate("slow", 0.5),
+	)
+
+	// A library sampling at 0.01 cannot push critical metrics below the floor,
+	// while other metrics keep the inherited rate.
+	library := client.WithRate(0.01)
+	library.Incr("critical")
+	library.Incr("other")
+	library.Incr("slow")
+
+	// The floor never lowers a higher rate.
+	client.Incr("critical")
+
+	ExpectEqual(t, []string{
+		"Count critical:1 (1 / 0.5 = 2) []",
+		"Count slow:1 (1 / 0.5 = 2) []",
+		"Count critical:1 []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientRandSource(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.1, 0.9, 0.4, 0.5)),
+	).WithRate(0.5)
+
+	client.Gauge("one", 1)
+	client.Gauge("two", 2)
+	client.Gauge("three", 3)
+	client.Gauge("four", 4)
+
+	ExpectEqual(t, []string{
+		"Gauge one:1 (0.5) []",
+		"Gauge three:3 (0.5) []",
+	}, recorder.messages)
+
+	// A seeded generator always produces the same sampling decisions.
+	emitted := func() []string {
+		recorder := &LogRecorder{}
+		r := rand.New(rand.NewSource(42))
+		client := metrics.NewLoggerClient(recorder, metrics.WithRandSource(r.Float64)).WithRate(0.5)
+		for i := 0; i < 20; i++ {
+			client.Gauge(fmt.Sprintf("gauge%d", i), 1)
+		}
+		return recorder.messages
+	}
+	ExpectEqual(t, emitted(), emitted())
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatalf("Expected nil rand source to panic")
+		}
+	}()
+	metrics.NewLoggerClient(recorder, metrics.WithRandSource(nil))
+}
+
+func TestLoggerClientWithRateClamp(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	client.WithRate(2.0).Incr("high")
+	client.WithRate(-1).Incr("negative")
+
+	ExpectEqual(t, []string{"Count high:1 []"}, recorder.messages)
+}
+
+func TestLoggerClientRate(t *testing.T) {
+	client := metrics.NewLoggerClient(&LogRecorder{}, metrics.WithInitialRate(0.5))
+
+	ExpectEqual(t, 0.5, client.Rate())
+	ExpectEqual(t, 0.2, client.WithRate(0.2).Rate())
+	ExpectEqual(t, 1.0, client.WithRate(2.0).Rate())
+	ExpectEqual(t, 0.5, client.WithTag("tag1", "value1").Rate())
+}
+
+func TestLoggerClientAlways(t *testing.T) {
+	recorder := &LogRecorder{}
+	sampled := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.99)),
+		metrics.WithMetricRate("errors", 0.1),
+	).WithRate(0.01).WithTag("tag1", "value1").WithPrefix("app.")
+
+	sampled.Incr("requests")
+	sampled.Incr("errors")
+	ExpectEqual(t, 0, len(recorder.messages))
+
+	always := sampled.Always()
+	always.Incr("requests")
+	always.Incr("errors")
+	ExpectEqual(t, 1.0, always.Rate())
+	ExpectEqual(t, []string{
+		"Count app.requests:1 [tag1=value1]",
+		"Count app.errors:1 [tag1=value1]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientNilLogger(t *testing.T) {
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf("Expected nil logger not to panic. Found '%v'", err)
+		}
+	}()
+
+	// A struct literal has no logger, random source, or rate.
+	var client metrics.Client = &metrics.LoggerClient{}
+	client.Incr("dropped")
+	client.Event(statsd.NewEvent("dropped", "desc"))
+
+	// Once it has a rate, calls fall back to the default stdout logger.
+	client = client.WithRate(1.0)
+	client.Incr("one")
+	client.WithRate(0.5).Gauge("memory", 1024)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+}
+
+func TestLoggerClientShouldSample(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.05, 0.5)),
+		metrics.WithInitialRate(0.1),
+	)
+
+	computed := 0
+	for i := 0; i < 4; i++ {
+		if client.ShouldSample() {
+			computed++
+			client.Always().WithTag("expensive", "value").Incr("guarded")
+		}
+	}
+
+	ExpectEqual(t, 2, computed)
+	ExpectEqual(t, []string{
+		"Count guarded:1 [expensive=value]",
+		"Count guarded:1 [expensive=value]",
+	}, recorder.messages)
+	ExpectEqual(t, true, metrics.NewLoggerClient(recorder).ShouldSample())
+}
+
+func TestLoggerClientEventSampling(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.05, 0.5, 0.09)),
+	).WithRate(0.1)
+
+	client.Event(statsd.NewEvent("first", "desc"))
+	client.Event(statsd.NewEvent("second", "desc"))
+	client.Event(statsd.NewEvent("third", "desc"))
+
+	ExpectEqual(t, []string{
+		"Event first (normal, info): desc []",
+		"Event third (normal, info): desc []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientEventTags(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder).WithTags(map[string]string{
+		"tag1": "value1",
+		"tag2": "value2",
+	})
+
+	e := statsd.NewEvent("deploy\nfailed", "line one\nline two\r\nline three")
+	e.Priority = statsd.Low
+	e.AlertType = statsd.Error
+	e.Tags = []string{"tag2:override", "event:tag", "bare"}
+	client.Event(e)
+
+	ExpectEqual(t, []string{
+		"Event deploy\\nfailed (low, error): line one\\nline two\\nline three [bare= event=tag tag1=value1 tag2=override]",
+	}, recorder.messages)
+
+	// The event itself is left unmodified.
+	ExpectEqual(t, []string{"tag2:override", "event:tag", "bare"}, e.Tags)
+}
+
+func TestLoggerClientServiceCheckTags(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder).WithTags(map[string]string{
+		"tag1": "value1",
+		"tag2": "value2",
+	})
+
+	sc := statsd.NewServiceCheck("db", statsd.Critical)
+	sc.Message = "connection refused\nretrying"
+	sc.Tags = []string{"tag2:override", "check:tag"}
+	client.ServiceCheck(sc)
+
+	ExpectEqual(t, []string{
+		"ServiceCheck db:CRITICAL connection refused\\nretrying [check=tag tag1=value1 tag2=override]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientTags(t *testing.T) {
+	client := metrics.NewLoggerClient(&LogRecorder{})
+	ExpectEqual(t, map[string]string{}, client.Tags())
+
+	tagged := client.WithTag("tag1", "value1")
+	tags := tagged.Tags()
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, tags)
+
+	// Modifying the returned map does not modify the client.
+	tags["tag1"] = "modified"
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, tagged.Tags())
+}
+
+func TestLoggerClientTagsIf(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder).WithTag("job", "sync")
+	failed := map[string]string{"error": "true"}
+
+	// A false condition returns the same client rather than a clone.
+	if client.WithTagsIf(false, failed) != client {
+		t.Fatalf("Expected a false condition to return the original client")
+	}
+	ExpectEqual(t, map[string]string{"job": "sync", "error": "true"}, client.WithTagsIf(true, failed).Tags())
+
+	client.WithTagsIf(false, failed).Incr("jobs")
+	client.WithTagsIf(true, failed).Incr("jobs")
+	ExpectEqual(t, []string{
+		"Count jobs:1 [job=sync]",
+		"Count jobs:1 [error=true job=sync]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientTagRedactor(t *testing.T) {
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:8])
+	}
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithInitialTags(map[string]string{"email": "ops@example.com"}),
+		metrics.WithTagRedactor(func(key, value string) string {
+			if key != "email" {
+				return value
+			}
+			return hash(value)
+		}),
+	)
+
+	client.Incr("signups")
+	client.WithTag("email", "user@example.com").WithTag("plan", "pro").Incr("signups")
+	ctx := metrics.ContextWithTags(context.Background(), map[string]string{"email": "ctx@example.com"})
+	ExpectEqual(t, hash("ctx@example.com"), client.WithContext(ctx).Tags()["email"])
+
+	ExpectEqual(t, []string{
+		"Count signups:1 [email=" + hash("ops@example.com") + "]",
+		"Count signups:1 [email=" + hash("user@example.com") + " plan=pro]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientEnvTag(t *testing.T) {
+	t.Setenv("TEST_POD_NAME", "web-7f9c")
+	t.Setenv("TEST_EMPTY", "")
+
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithInitialTags(map[string]string{"env": "test"}),
+		metrics.WithEnvTag("pod", "TEST_POD_NAME"),
+		metrics.WithEnvTag("zone", "TEST_EMPTY"),
+		metrics.WithEnvTag("node", "TEST_UNSET_VARIABLE"),
+	)
+	client.Incr("requests")
+
+	// Unset and empty variables are skipped rather than sent as empty tags.
+	ExpectEqual(t, []string{"Count requests:1 [env=test pod=web-7f9c]"}, recorder.messages)
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatalf("Expected an empty variable name to panic")
+		}
+	}()
+	metrics.NewLoggerClient(recorder, metrics.WithEnvTag("pod", ""))
+}
+
+func TestLoggerClientGaugeInt(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.1)),
+	)
+
+	client.GaugeInt("queue.depth", 42)
+	client.WithRate(0.5).GaugeInt("queue.depth", 7)
+	client.Gauge("load", 0.5)
+
+	ExpectEqual(t, []string{
+		"Gauge queue.depth:42 []",
+		"Gauge queue.depth:7 (0.5) []",
+		"Gauge load:0.5 []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientGaugeDelta(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	client.WithTag("tag1", "value1").GaugeDelta("connections", 1)
+	client.GaugeDelta("connections", -1)
+	client.GaugeDelta("connections", 0)
+
+	// Deltas are never sampled, unless the rate is zero.
+	client.WithRate(0.01).GaugeDelta("connections", 3)
+	client.WithRate(0).GaugeDelta("connections", 4)
+
+	ExpectEqual(t, []string{
+		"GaugeDelta connections:+1 [tag1=value1]",
+		"GaugeDelta connections:-1 []",
+		"GaugeDelta connections:+0 []",
+		"GaugeDelta connections:+3 []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientTimingMs(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	client.TimingMs("latency", 123)
+	client.WithTag("tag1", "value1").TimingMs("latency", 1.5)
+
+	ExpectEqual(t, []string{
+		"Timing latency:123ms []",
+		"Timing latency:1.5ms [tag1=value1]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientCountFloat(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithRandSource(sequence(0)))
+
+	client.CountFloat("work", 0.25)
+	client.WithRate(0.5).CountFloat("work", 1.5)
+
+	ExpectEqual(t, []string{
+		"Count work:0.25 []",
+		"Count work:1.5 (1.5 / 0.5 = 3) []",
+	}, recorder.messages)
+}
+
+// chanLogger sends log messages to a channel so they can be read from
+// another goroutine.
+type chanLogger chan string
+
+func (l chanLogger) Printf(format string, args ...interface{}) {
+	l <- fmt.Sprintf(format, args...)
+}
+
+func TestLoggerClientConcurrency(t *testing.T) {
+	// The recorder is not goroutine-safe, so this races under `-race` unless
+	// the client serializes its writes.
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tagged := client.WithTag("worker", strconv.Itoa(i))
+			for j := 0; j < 100; j++ {
+				tagged.Incr("requests")
+				tagged.Timing("latency", time.Millisecond)
+				client.Gauge("workers", float64(i))
+				tagged.Event(statsd.NewEvent("title", "desc"))
+			}
+			batch := tagged.Batch()
+			batch.Incr("batches")
+			batch.Send()
+		}(i)
+	}
+	wg.Wait()
+
+	ExpectEqual(t, 50*(4*100+1), len(recorder.messages))
+}
+
+func TestLoggerClientTypeLabels(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithTypeLabels(map[string]string{
+		"count":  "[COUNT]",
+		"timing": "[TIMING]",
+	}))
+
+	client.Incr("one")
+	client.Timing("two", 2*time.Millisecond)
+	client.Gauge("three", 3)
+	client.Event(statsd.NewEvent("title", "desc"))
+
+	ExpectEqual(t, []string{
+		"[COUNT] one:1 []",
+		"[TIMING] two:2ms []",
+		"Gauge three:3 []",
+		"Event title (normal, info): desc []",
+	}, recorder.messages)
+
+	recorder = &LogRecorder{}
+	client = metrics.NewLoggerClient(recorder,
+		metrics.WithSummaries(0),
+		metrics.WithTypeLabels(map[string]string{"histogram": "[HIST]"}),
+	)
+	client.Histogram("four", 4)
+	client.Flush()
+	ExpectEqual(t, "[HIST] four count=1 min=4 max=4 p50=4 p95=4 p99=4 []", recorder.messages[0])
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatal("Expected an unknown metric type to panic")
+		}
+	}()
+	metrics.NewLoggerClient(recorder, metrics.WithTypeLabels(map[string]string{"counter": "C"}))
+}
+
+func TestLoggerClientSummaries(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithSummaries(0))
+
+	for i := 1; i <= 100; i++ {
+		client.Histogram("histo", float64(i))
+	}
+	client.Timing("latency", 3*time.Millisecond)
+	client.TimingMs("latency", 1)
+	client.TimingMs("latency", 2)
+	client.WithTag("tag1", "value1").Distribution("distro", 5)
+	client.Incr("count")
+
+	// Only non-summarized calls are logged before flushing.
+	ExpectEqual(t, []string{"Count count:1 []"}, recorder.messages)
+
+	recorder.messages = nil
+	client.Flush()
+	ExpectEqual(t, []string{
+		"Distribution distro count=1 min=5 max=5 p50=5 p95=5 p99=5 [tag1=value1]",
+		"Histogram histo count=100 min=1 max=100 p50=50 p95=95 p99=99 []",
+		"Timing latency count=3 min=1ms max=3ms p50=2ms p95=3ms p99=3ms []",
+	}, recorder.messages)
+
+	// The buffer is cleared on flush.
+	recorder.messages = nil
+	client.Flush()
+	ExpectEqual(t, 0, len(recorder.messages))
+
+	// Closing logs anything left.
+	client.Histogram("histo", 1)
+	client.Close()
+	ExpectEqual(t, []string{"Histogram histo count=1 min=1 max=1 p50=1 p95=1 p99=1 []"}, recorder.messages)
+}
+
+func TestLoggerClientSummariesJSON(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithSummaries(0), metrics.WithJSON())
+
+	client.WithTag("tag1", "value1").TimingMs("latency", 1.5)
+	client.Flush()
+
+	ExpectEqual(t, []string{
+		`{"type":"timing_summary","name":"latency","count":1,"min":1.5,"max":1.5,"p50":1.5,"p95":1.5,"p99":1.5,"tags":{"tag1":"value1"}}`,
+	}, recorder.messages)
+}
+
+func TestLoggerClientSummariesInterval(t *testing.T) {
+	messages := make(chanLogger, 10)
+	client := metrics.NewLoggerClient(messages, metrics.WithSummaries(10*time.Millisecond))
+	defer client.Close()
+
+	client.Histogram("histo", 1)
+	select {
+	case message := <-messages:
+		ExpectEqual(t, "Histogram histo count=1 min=1 max=1 p50=1 p95=1 p99=1 []", message)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a summary to be logged on the interval")
+	}
+}
+
+func TestLoggerClientWriter(t *testing.T) {
+	var buf bytes.Buffer
+	client := metrics.NewLoggerClientWriter(&buf, metrics.WithPrefix("app."))
+
+	client.Incr("one")
+	client.WithTag("tag1", "value1").Gauge("memory", 1024)
+
+	ExpectEqual(t, "Count app.one:1 []\nGauge app.memory:1024 [tag1=value1]\n", buf.String())
+}
+
+func TestLoggerClientJSON(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithJSON(),
+		metrics.WithRandSource(sequence(0.1)),
+	)
+
+	client.WithTags(map[string]string{
+		"b": "2",
+		"a": "1",
+	}).Incr("one")
+	client.Gauge("memory", 0.5)
+	client.GaugeDelta("connections", 1)
+	client.Set("users", "alice")
+	client.WithRate(0.5).Timing("timing", 1500*time.Microsecond)
+	client.TimingMs("timing.ms", 2.5)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Warn))
+
+	ExpectEqual(t, []string{
+		`{"type":"count","name":"one","value":1,"tags":{"a":"1","b":"2"},"rate":1}`,
+		`{"type":"gauge","name":"memory","value":0.5,"tags":{},"rate":1}`,
+		`{"type":"gaugedelta","name":"connections","value":1,"tags":{},"rate":1}`,
+		`{"type":"set","name":"users","value":"alice","tags":{},"rate":1}`,
+		`{"type":"timing","name":"timing","value":1.5,"tags":{},"rate":0.5}`,
+		`{"type":"timing","name":"timing.ms","value":2.5,"tags":{},"rate":1}`,
+		`{"type":"event","title":"title","text":"desc","priority":"normal","alert_type":"info","tags":{}}`,
+		`{"type":"service_check","name":"check","status":"WARNING","message":"","tags":{}}`,
+	}, recorder.messages)
+}
+
+func TestLoggerClientMetricRate(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.5)),
+		metrics.WithMetricRate("request.bytes", 0.1),
+		metrics.WithMetricRate("error.count", 1.0),
+	).WithRate(0.9).WithPrefix("app.")
+
+	client.Count("request.bytes", 100)
+	client.Incr("error.count")
+	client.Incr("other")
+
+	ExpectEqual(t, []string{
+		"Count app.error.count:1 []",
+		"Count app.other:1 (1 / 0.9 = 1.11) []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientSanitizedNames(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithSanitizedNames(),
+		metrics.WithInitialTags(map[string]string{"bad key": "a|b"}),
+	)
+
+	client.Incr("my metric:name")
+	client.WithTag("host@name", "value\n").Incr("ok")
+
+	ExpectEqual(t, []string{
+		"Count my_metric_name:1 [bad_key=a_b]",
+		"Count ok:1 [bad_key=a_b host_name=value_]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientStrictNames(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithStrictNames())
+
+	client.Incr("my metric")
+	client.WithTag("tag", "a:b").Incr("tagged")
+	client.Incr("valid")
+
+	ExpectEqual(t, []string{"Count valid:1 []"}, recorder.messages)
+	if !strings.Contains(warnings.String(), `"my metric"`) || !strings.Contains(warnings.String(), `"a:b"`) {
+		t.Fatalf("Expected warnings for dropped metrics. Found '%s'", warnings.String())
+	}
+}
+
+func TestLoggerClientNegativeValues(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithNegativeValueChecks()).WithPrefix("app.")
+
+	client.Timing("latency", -5*time.Millisecond)
+	client.TimingMs("latency", -1)
+	client.Histogram("histo", -1)
+	client.Distribution("distro", -1)
+	client.GaugeDelta("depth", -1)
+	client.Timing("latency", 5*time.Millisecond)
+
+	ExpectEqual(t, []string{
+		"GaugeDelta app.depth:-1 []",
+		"Timing app.latency:5ms []",
+	}, recorder.messages)
+	if !strings.Contains(warnings.String(), `dropping negative timing value -5 for "app.latency"`) {
+		t.Fatalf("Expected a warning for the negative timing. Found '%s'", warnings.String())
+	}
+	ExpectEqual(t, 4, strings.Count(warnings.String(), "dropping negative"))
+}
+
+func TestLoggerClientWarningInterval(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	// Identical warnings are only logged once per interval, including from
+	// clones, while distinct warnings are still logged.
+	client := metrics.NewLoggerClient(&LogRecorder{}, metrics.WithStrictNames())
+	client.Incr("my metric")
+	client.Incr("my metric")
+	client.WithTag("tag1", "value1").Incr("my metric")
+	client.Incr("other metric")
+
+	ExpectEqual(t, 1, strings.Count(warnings.String(), `"my metric"`))
+	ExpectEqual(t, 1, strings.Count(warnings.String(), `"other metric"`))
+
+	// A zero interval logs every warning.
+	warnings.Reset()
+	client = metrics.NewLoggerClient(&LogRecorder{}, metrics.WithStrictNames(), metrics.WithWarningInterval(0))
+	client.Incr("my metric")
+	client.Incr("my metric")
+
+	ExpectEqual(t, 2, strings.Count(warnings.String(), `"my metric"`))
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for a negative warning interval")
+		}
+	}()
+	metrics.NewLoggerClient(&LogRecorder{}, metrics.WithWarningInterval(-time.Second))
+}
+
+func TestLoggerClientTagValues(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder).WithTagValues("team", "search", "ads")
+
+	client.Incr("one")
+	client.WithTag("team", "infra").Incr("two")
+
+	ExpectEqual(t, []string{
+		"Count one:1 [team=search,ads]",
+		"Count two:1 [team=infra]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientTypeTags(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithTypeTags("timing", map[string]string{"unit": "ms"}),
+	)
+
+	client.TimingMs("latency", 1.5)
+	client.Gauge("memory", 1024)
+	client.WithTag("unit", "s").TimingMs("latency", 2)
+
+	ExpectEqual(t, []string{
+		"Timing latency:1.5ms [unit=ms]",
+		"Gauge memory:1024 []",
+		"Timing latency:2ms [unit=s]",
+	}, recorder.messages)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for an unknown metric type")
+		}
+	}()
+	metrics.NewLoggerClient(recorder, metrics.WithTypeTags("timer", nil))
+}
+
+func TestLoggerClientHashSampling(t *testing.T) {
+	emitted := func(client metrics.Client, recorder *LogRecorder) []string {
+		recorder.messages = nil
+		for i := 0; i < 100; i++ {
+			client.WithTag("series", strconv.Itoa(i)).Incr("sampled")
+		}
+		return recorder.messages
+	}
+
+	// The random source would drop everything, so anything sent was decided
+	// by the hash alone.
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithHashSampling(0.5), metrics.WithRandSource(sequence(0.99)))
+
+	first := emitted(client, recorder)
+	if len(first) < 30 || len(first) > 70 {
+		t.Fatalf("Expected about half of the series to be sent. Found %d", len(first))
+	}
+
+	// The same series always make the same decision, even for a new client.
+	ExpectEqual(t, first, emitted(client, recorder))
+	other := &LogRecorder{}
+	ExpectEqual(t, first, emitted(metrics.NewLoggerClient(other, metrics.WithHashSampling(0.5)), other))
+
+	// A lower rate sends a subset of the series.
+	series := func(message string) string {
+		return message[strings.LastIndex(message, " [")+1:]
+	}
+	sent := map[string]bool{}
+	for _, message := range first {
+		sent[series(message)] = true
+	}
+	for _, message := range emitted(client.WithRate(0.1), recorder) {
+		if !sent[series(message)] {
+			t.Fatalf("Expected '%s' to also be sent at the higher rate", message)
+		}
+	}
+
+	ExpectEqual(t, 100, len(emitted(client.Always(), recorder)))
+}
+
+func TestLoggerClientDefaultTagPrecedence(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithInitialTags(map[string]string{
+			"env":    "prod",
+			"region": "us-west-2",
+		}),
+	)
+
+	client.Incr("default")
+	client.WithTag("env", "staging").Incr("override")
+
+	ExpectEqual(t, []string{
+		"Count default:1 [env=prod region=us-west-2]",
+		"Count override:1 [env=staging region=us-west-2]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientWithoutTags(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder).WithTags(map[string]string{
+		"user_id": "123",
+		"tag1":    "value1",
+	})
+
+	client.WithoutTags("user_id").Incr("stripped")
+	client.WithoutTags("user_id").WithTag("user_id", "456").Incr("readded")
+	client.WithoutTags().Incr("unchanged")
+
+	ExpectEqual(t, []string{
+		"Count stripped:1 [tag1=value1]",
+		"Count readded:1 [tag1=value1 user_id=456]",
+		"Count unchanged:1 [tag1=value1 user_id=123]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientSampledCount(t *testing.T) {
+	recorder := &LogRecorder{}
+	r := rand.New(rand.NewSource(1))
+	client := metrics.NewLoggerClient(recorder, metrics.WithRandSource(r.Float64)).WithRate(0.5)
+
+	// The seeded source means the same calls are sampled on every run.
+	for i := 0; i < 4; i++ {
+		client.Count("requests", 5)
+		client.Gauge("memory", 1024)
+	}
+
+	ExpectEqual(t, []string{
+		"Gauge memory:1024 (0.5) []",
+		"Count requests:5 (5 / 0.5 = 10) []",
+		"Count requests:5 (5 / 0.5 = 10) []",
+		"Gauge memory:1024 (0.5) []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientCountWithRate(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder,
+		metrics.WithRandSource(sequence(0.2)),
+		metrics.WithMetricRate("requests", 0.1),
+	)
+
+	client.CountWithRate("requests", 2, 0.25)
+	client.CountWithRate("requests", 2, 0.1)
+	client.Incr("other")
+
+	ExpectEqual(t, []string{
+		"Count requests:2 (2 / 0.25 = 8) []",
+		"Count other:1 []",
+	}, recorder.messages)
+}
+
+func TestLoggerClientTagCardinalityLimit(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithTagCardinalityLimit(10, ""))
+
+	for i := 0; i < 1000; i++ {
+		client.WithTags(map[string]string{
+			"user_id": strconv.Itoa(i),
+			"region":  "us-west",
+		}).Incr("requests.count")
+	}
+
+	// Values seen before the limit was reached are still allowed.
+	client.WithTag("user_id", "5").Incr("again")
+
+	ExpectEqual(t, 1001, len(recorder.messages))
+	ExpectEqual(t, "Count requests.count:1 [region=us-west user_id=9]", recorder.messages[9])
+	ExpectEqual(t, "Count requests.count:1 [region=us-west user_id=__overflow__]", recorder.messages[10])
+	ExpectEqual(t, "Count requests.count:1 [region=us-west user_id=__overflow__]", recorder.messages[999])
+	ExpectEqual(t, "Count again:1 [user_id=5]", recorder.messages[1000])
+	ExpectEqual(t, 1, strings.Count(warnings.String(), `tag "user_id" exceeded 10 distinct values`))
+}
+
+func TestLoggerClientTagCardinalityLimitPlaceholder(t *testing.T) {
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithTagCardinalityLimit(1, "other"))
+
+	client.WithTag("path", "/a").Incr("one")
+	client.WithTag("path", "/b").Incr("one")
+
+	ExpectEqual(t, []string{
+		"Count one:1 [path=/a]",
+		"Count one:1 [path=other]",
+	}, recorder.messages)
+}
+
+func TestLoggerClientReservedTags(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	recorder := &LogRecorder{}
+	metrics.NewLoggerClient(recorder, metrics.WithReservedTagWarnings()).WithTags(map[string]string{
+		"host": "web-1",
+		"tag1": "value1",
+	}).Incr("warned")
+	metrics.NewLoggerClient(recorder, metrics.WithStrictReservedTags()).WithTags(map[string]string{
+		"source": "api",
+		"tag1":   "value1",
+	}).Incr("strict")
+
+	ExpectEqual(t, []string{
+		"Count warned:1 [host=web-1 tag1=value1]",
+		"Count strict:1 [tag1=value1]",
+	}, recorder.messages)
+	if !strings.Contains(warnings.String(), `"host"`) || !strings.Contains(warnings.String(), `"source"`) {
+		t.Fatalf("Expected warnings for reserved tags. Found '%s'", warnings.String())
+	}
+}
+
+func TestLoggerClientTagCollisionWarnings(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	log.SetFlags(0)
+	defer log.SetFlags(log.LstdFlags)
+	defer log.SetOutput(os.Stderr)
+
+	recorder := &LogRecorder{}
+	parent := metrics.NewLoggerClient(recorder,
+		metrics.WithTagCollisionWarnings(),
+		metrics.WithInitialTags(map[string]string{"env": "prod", "team": "api"}),
+	)
+	parent.WithTag("env", "staging").WithTag("region", "east").Incr("requests")
+	parent.WithTag("team", "api").Incr("requests")
+
+	// Overriding is still allowed, and identical values are not reported.
+	ExpectEqual(t, []string{
+		"Count requests:1 [env=staging region=east team=api]",
+		"Count requests:1 [env=prod team=api]",
+	}, recorder.messages)
+	ExpectEqual(t, "metrics: tag \"env\" overwritten from \"prod\" to \"staging\"\n", warnings.String())
+
+	// Collisions are not reported by default.
+	warnings.Reset()
+	metrics.NewLoggerClient(recorder, metrics.WithInitialTags(map[string]string{"env": "prod"})).WithTag("env", "staging")
+	ExpectEqual(t, "", warnings.String())
+}
+
+func TestLoggerClientReservedTagsExtended(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	defer func(keys []string) { metrics.ReservedTagKeys = keys }(metrics.ReservedTagKeys)
+	metrics.ReservedTagKeys = append(metrics.ReservedTagKeys, "env")
+
+	recorder := &LogRecorder{}
+	metrics.NewLoggerClient(recorder, metrics.WithStrictReservedTags()).WithTag("env", "prod").Incr("one")
+
+	ExpectEqual(t, []string{"Count one:1 []"}, recorder.messages)
+}
+
+func TestLoggerClientGaugeWithTimestamp(t *testing.T) {
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+	client.GaugeWithTimestamp("backfill", 5, timestamp)
+	ExpectEqual(t, []string{"Gauge backfill:5@2020-01-02T03:04:05Z []"}, recorder.messages)
+
+	recorder = &LogRecorder{}
+	client = metrics.NewLoggerClient(recorder, metrics.WithJSON())
+	client.GaugeWithTimestamp("backfill", 5, timestamp)
+	ExpectEqual(t, []string{
+		`{"type":"gauge","name":"backfill","value":5,"tags":{},"rate":1,"timestamp":"2020-01-02T03:04:05Z"}`,
+	}, recorder.messages)
+}
+
+func TestLoggerClientWithTimestamp(t *testing.T) {
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder)
+	stamped := client.WithTimestamp(timestamp).WithTag("job", "backfill")
+	stamped.Count("processed", 10)
+	stamped.Gauge("pending", 2)
+	stamped.Distribution("size", 3)
+	stamped.Timing("latency", time.Millisecond)
+	stamped.WithTimestamp(time.Time{}).Incr("current")
+	client.Incr("current")
+
+	ExpectEqual(t, []string{
+		"Count processed:10@2020-01-02T03:04:05Z [job=backfill]",
+		"Gauge pending:2@2020-01-02T03:04:05Z [job=backfill]",
+		"Distribution size:3@2020-01-02T03:04:05Z [job=backfill]",
+		"Timing latency:1ms [job=backfill]",
+		"Count current:1 [job=backfill]",
+		"Count current:1 []",
+	}, recorder.messages)
 }
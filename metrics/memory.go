@@ -0,0 +1,748 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// Aggregate describes the current aggregated state of a single metric series,
+// which is a unique combination of metric name and tags. How the fields are
+// populated depends on the `Type` of the metric:
+//
+//   count:        Value is the sum of all values.
+//   gauge:        Value is the last value set, adjusted by any deltas.
+//   set:          Value is the number of unique values.
+//   timing:       Value is the last value, and Min/Max/Sum/Count track the
+//                 distribution of all values. Timings are in milliseconds.
+//   histogram:    Same as timing, without a unit.
+//   distribution: Same as histogram.
+//
+// Count is always the number of calls made for the series.
+type Aggregate struct {
+	Type  string
+	Name  string
+	Tags  map[string]string
+	Value float64
+	Count int64
+	Min   float64
+	Max   float64
+	Sum   float64
+}
+
+// Avg returns the average of all values in the series.
+func (a Aggregate) Avg() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// memorySeries holds the aggregate and any additional internal state for a
+// single metric series.
+type memorySeries struct {
+	Aggregate
+	values  map[string]struct{}
+	bounds  []float64 // upper bounds of the histogram buckets
+	buckets []uint64  // cumulative counts for each of the bounds
+}
+
+// memoryBuckets are the default upper bounds of the histogram buckets
+// exposed by `Handler`, which are the defaults of the Prometheus client
+// library used by the `prometheus.Client` subpackage.
+var memoryBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// memoryStore is shared by a memory client and all of its clones.
+type memoryStore struct {
+	mutex    sync.Mutex
+	series   map[string]*memorySeries
+	gauges   *observedGauges
+	buckets  map[string][]float64
+	now      func() time.Time
+	warnings *warnThrottle
+}
+
+// MemoryClient aggregates metrics in memory, which is useful for inspecting
+// metrics locally without running DataDog. Aggregation is goroutine-safe and
+// a shared store is used so that cloned clients all write to the same
+// aggregates. Sample rates are not applied, so every call is aggregated
+// unless the rate is zero. Events and service checks are ignored.
+//
+// Counts are always summed per metric name and tags, so it behaves like the
+// `WithClientAggregation` option of the `DataDogClient` with an unlimited
+// window: every snapshot contains one total per series.
+//
+//   client := metrics.NewMemoryClient()
+//   client.WithTags(map[string]string{"tag": "value"}).Incr("requests.count")
+//
+//   for key, aggregate := range client.Snapshot() {
+//     fmt.Println(key, aggregate.Value)
+//   }
+type MemoryClient struct {
+	store     *memoryStore
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewMemoryClient creates a new in-memory aggregating client. Only the
+// `WithHistogramBuckets`, `WithClock`, and `WithWarningInterval` options are
+// supported.
+func NewMemoryClient(options ...Option) *MemoryClient {
+	o, err := resolveOptions(options)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return &MemoryClient{
+		store: &memoryStore{
+			series:   map[string]*memorySeries{},
+			gauges:   newObservedGauges(0, o.Clock),
+			buckets:  o.HistogramBuckets,
+			now:      o.Clock,
+			warnings: newWarnThrottle(o.WarningInterval),
+		},
+		rate: 1.0,
+	}
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *MemoryClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	return &MemoryClient{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    combine(c.tagMap, tags),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *MemoryClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *MemoryClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *MemoryClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *MemoryClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *MemoryClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *MemoryClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *MemoryClient) WithoutTags(keys ...string) Client {
+	return &MemoryClient{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    without(c.tagMap, keys),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *MemoryClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions. Like `GaugeWithTimestamp`, those calls are not
+// supported and are dropped while a timestamp is set, since snapshots only
+// contain current aggregates. The first dropped call of each kind is logged.
+func (c *MemoryClient) WithTimestamp(timestamp time.Time) Client {
+	return &MemoryClient{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: timestamp,
+	}
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *MemoryClient) WithPrefix(prefix string) Client {
+	return &MemoryClient{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix + prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// Clone returns an independent copy of this client, which writes to the
+// same store as the original.
+func (c *MemoryClient) Clone() Client {
+	return &MemoryClient{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    combine(nil, c.tagMap),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *MemoryClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *MemoryClient) WithRate(rate float64) Client {
+	return &MemoryClient{
+		store:     c.store,
+		rate:      clampRate(rate),
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *MemoryClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *MemoryClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
+// seriesKey returns the unique key for a metric name and set of tags, which
+// looks like `NAME[TAG_NAME:TAG_VALUE ...]`.
+func seriesKey(name string, tagMap map[string]string) string {
+	tags := mapToStrings(tagMap)
+	sort.Strings(tags)
+	return fmt.Sprintf("%s%v", name, tags)
+}
+
+// getSeries returns the series for a metric name using the client's tags,
+// creating it if needed. The store mutex must be held by the caller.
+func (c *MemoryClient) getSeries(t string, name string) *memorySeries {
+	name = c.prefix + name
+	key := seriesKey(name, c.tagMap)
+	series := c.store.series[key]
+	if series == nil {
+		series = &memorySeries{
+			Aggregate: Aggregate{
+				Type: t,
+				Name: name,
+				Tags: combine(nil, c.tagMap),
+			},
+		}
+		c.store.series[key] = series
+	}
+	return series
+}
+
+// observe adds a value to a series which tracks min/max/avg/etc.
+func (c *MemoryClient) observe(t string, name string, value float64) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	series := c.getSeries(t, name)
+	if series.Count == 0 || value < series.Min {
+		series.Min = value
+	}
+	if series.Count == 0 || value > series.Max {
+		series.Max = value
+	}
+	series.Value = value
+	series.Sum += value
+	series.Count++
+
+	if series.buckets == nil {
+		series.bounds = memoryBuckets
+		if bounds, ok := c.store.buckets[name]; ok {
+			series.bounds = bounds
+		}
+		series.buckets = make([]uint64, len(series.bounds))
+	}
+	bucketValue := prometheusValue(t, value)
+	for i, bound := range series.bounds {
+		if bucketValue <= bound {
+			series.buckets[i]++
+		}
+	}
+}
+
+// Close on the MemoryClient is a no-op
+func (c *MemoryClient) Close() error {
+	return nil
+}
+
+// Flush polls any gauges registered via `RegisterGauge`.
+func (c *MemoryClient) Flush() error {
+	c.store.gauges.observe()
+	return nil
+}
+
+// RegisterGauge registers a callback whose result is stored as a gauge with
+// this client's tags and the given tags. Rather than polling on an interval,
+// the callbacks are invoked whenever the aggregates are read via
+// `Snapshot`, `CardinalityReport`, or `Handler`, and on `Flush`, so that
+// reads always see the current value. Registering the same name and tags
+// again replaces the callback.
+func (c *MemoryClient) RegisterGauge(name string, fn func() float64, tags map[string]string) {
+	client := c.WithTags(tags)
+	c.store.gauges.register(seriesKey(c.prefix+name, client.Tags()), &observedGauge{
+		client: client,
+		name:   name,
+		fn:     fn,
+	})
+}
+
+// UnregisterGauge removes a callback registered via `RegisterGauge` with the
+// same name and tags on a client with the same tags and prefix. The last
+// value remains in the aggregates until `Reset`.
+func (c *MemoryClient) UnregisterGauge(name string, tags map[string]string) {
+	c.store.gauges.unregister(seriesKey(c.prefix+name, c.WithTags(tags).Tags()))
+}
+
+// Count adds some value to a metric.
+func (c *MemoryClient) Count(name string, value int64) {
+	if suppressed() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the memory client", "counts")
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	series := c.getSeries("count", name)
+	series.Value += float64(value)
+	series.Count++
+}
+
+// Incr adds one to a metric.
+func (c *MemoryClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *MemoryClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *MemoryClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *MemoryClient) CountFloat(name string, value float64) {
+	if suppressed() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the memory client", "counts")
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	series := c.getSeries("count", name)
+	series.Value += value
+	series.Count++
+}
+
+// Gauge sets a numeric value.
+func (c *MemoryClient) Gauge(name string, value float64) {
+	if suppressed() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the memory client", "gauges")
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	series := c.getSeries("gauge", name)
+	series.Value = value
+	series.Count++
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *MemoryClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp on the MemoryClient is not supported and is dropped,
+// since snapshots only contain current aggregates. The first dropped call of
+// each kind is logged.
+func (c *MemoryClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	warnTimestampDropped("the memory client", "gauges")
+}
+
+// GaugeDelta adjusts a gauge by a signed amount. Like every other call it is
+// never sampled, and only dropped when the rate is zero.
+func (c *MemoryClient) GaugeDelta(name string, delta float64) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	series := c.getSeries("gauge", name)
+	series.Value += delta
+	series.Count++
+}
+
+// Set counts the number of unique values for a metric.
+func (c *MemoryClient) Set(name string, value string) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	series := c.getSeries("set", name)
+	if series.values == nil {
+		series.values = map[string]struct{}{}
+	}
+	series.values[value] = struct{}{}
+	series.Value = float64(len(series.values))
+	series.Count++
+}
+
+// Event on the MemoryClient is a no-op
+func (c *MemoryClient) Event(e *statsd.Event) {
+}
+
+// ServiceCheck on the MemoryClient is a no-op
+func (c *MemoryClient) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
+// Timing tracks a duration in milliseconds.
+func (c *MemoryClient) Timing(name string, value time.Duration) {
+	c.observe("timing", name, float64(value)/float64(time.Millisecond))
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *MemoryClient) TimingMs(name string, ms float64) {
+	c.observe("timing", name, ms)
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *MemoryClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *MemoryClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *MemoryClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock set via `WithClock`, or `time.Now`.
+func (c *MemoryClient) clock() func() time.Time {
+	return c.store.now
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *MemoryClient) Histogram(name string, value float64) {
+	c.observe("histogram", name, value)
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *MemoryClient) Distribution(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the memory client", "distributions")
+		return
+	}
+	c.observe("distribution", name, value)
+}
+
+// Snapshot returns a deep copy of the current aggregates keyed by the metric
+// name and sorted tags, e.g. `requests.count[tag1:value1 tag2:value2]`. It is
+// safe to read and modify the returned aggregates.
+func (c *MemoryClient) Snapshot() map[string]Aggregate {
+	c.store.gauges.observe()
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	snapshot := make(map[string]Aggregate, len(c.store.series))
+	for key, series := range c.store.series {
+		aggregate := series.Aggregate
+		aggregate.Tags = combine(nil, series.Tags)
+		snapshot[key] = aggregate
+	}
+	return snapshot
+}
+
+// CardinalityReport returns the number of unique tag sets observed for each
+// metric name, e.g. to find a metric whose tags are about to blow up the cost
+// of a custom metrics bill before it reaches production:
+//
+//   for name, series := range client.CardinalityReport() {
+//     if series > 100 {
+//       log.Printf("%s has %d tag combinations", name, series)
+//     }
+//   }
+//
+// Names include any prefix, and the counts reset along with the aggregates.
+func (c *MemoryClient) CardinalityReport() map[string]int {
+	c.store.gauges.observe()
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	report := map[string]int{}
+	for _, series := range c.store.series {
+		report[series.Name]++
+	}
+	return report
+}
+
+// Reset clears all aggregates, which is useful between test runs. The store
+// is shared by this client and all clients derived from it via `WithTags`,
+// `WithRate`, etc., so their aggregates are cleared as well. Those clients
+// keep working and aggregate new calls into the same store.
+func (c *MemoryClient) Reset() {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	c.store.series = map[string]*memorySeries{}
+}
+
+// prometheusTypes maps memory series types to Prometheus metric types.
+var prometheusTypes = map[string]string{
+	"count":        "counter",
+	"gauge":        "gauge",
+	"set":          "gauge",
+	"timing":       "histogram",
+	"histogram":    "histogram",
+	"distribution": "histogram",
+}
+
+// prometheusValue converts a value to the unit exposed to Prometheus, which
+// is seconds for timings.
+func prometheusValue(t string, value float64) float64 {
+	if t == "timing" {
+		return value / 1000
+	}
+	return value
+}
+
+// Handler returns an HTTP handler which serves the current aggregates in the
+// Prometheus text exposition format, e.g. to view them in a browser or check
+// them with `promtool`:
+//
+//   http.Handle("/metrics", client.Handler())
+//
+// Metric names and tag keys are converted to valid Prometheus names like
+// the `prometheus.Client` subpackage does, and tags become labels. Counts
+// are exposed as counters, gauges and sets as gauges, and timings,
+// histograms, and distributions as histograms with `_bucket`, `_sum`, and
+// `_count` series.
+// Timings are exposed in seconds, and bucket bounds can be set per metric
+// via `WithHistogramBuckets`. If multiple series with the same name have
+// different types, only the type sorted first is exposed, and if multiple
+// tag keys of a series convert to the same label name, only the key sorted
+// first is kept. Tag keys which convert to a reserved label, i.e. one
+// starting with `__` or `le` on a histogram, are dropped. All of these are
+// logged as warnings, at most once per `WithWarningInterval`.
+func (c *MemoryClient) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(c.exposition(false))
+	})
+}
+
+// exposition renders the current aggregates in the Prometheus text format,
+// or the OpenMetrics text format which names counter samples with a `_total`
+// suffix and ends with `# EOF`. Series are grouped by name and sorted so that
+// the output is stable.
+func (c *MemoryClient) exposition(openMetrics bool) []byte {
+	c.store.gauges.observe()
+	c.store.mutex.Lock()
+	families := map[string][]*memorySeries{}
+	for _, series := range c.store.series {
+		name := prometheusName(series.Name)
+		families[name] = append(families[name], series)
+	}
+
+	names := make([]string, 0, len(families))
+	for name, family := range families {
+		names = append(names, name)
+		sort.Slice(family, func(i, j int) bool {
+			if family[i].Type != family[j].Type {
+				return family[i].Type < family[j].Type
+			}
+			return seriesKey(family[i].Name, family[i].Tags) < seriesKey(family[j].Name, family[j].Tags)
+		})
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	for _, name := range names {
+		family := families[name]
+		t := family[0].Type
+		sample := name
+		if openMetrics && prometheusTypes[t] == "counter" {
+			name = strings.TrimSuffix(name, "_total")
+			sample = name + "_total"
+		}
+		fmt.Fprintf(&buffer, "# TYPE %s %s\n", name, prometheusTypes[t])
+		for _, series := range family {
+			if series.Type != t {
+				c.store.warnings.warnf("metrics: %s %q conflicts with %s %q as %q, dropping it from the exposition", series.Type, series.Name, t, family[0].Name, name)
+				continue
+			}
+			labels := prometheusLabels(series.Tags, prometheusTypes[t] == "histogram", c.store.warnings)
+			if prometheusTypes[t] != "histogram" {
+				fmt.Fprintf(&buffer, "%s%s %s\n", sample, formatLabels(labels), formatPrometheusFloat(series.Value))
+				continue
+			}
+			for i, bound := range series.bounds {
+				fmt.Fprintf(&buffer, "%s_bucket%s %d\n", name, formatLabels(labels, "le", formatPrometheusFloat(bound)), series.buckets[i])
+			}
+			fmt.Fprintf(&buffer, "%s_bucket%s %d\n", name, formatLabels(labels, "le", "+Inf"), series.Count)
+			fmt.Fprintf(&buffer, "%s_sum%s %s\n", name, formatLabels(labels), formatPrometheusFloat(prometheusValue(t, series.Sum)))
+			fmt.Fprintf(&buffer, "%s_count%s %d\n", name, formatLabels(labels), series.Count)
+		}
+	}
+	c.store.mutex.Unlock()
+
+	if openMetrics {
+		buffer.WriteString("# EOF\n")
+	}
+	return buffer.Bytes()
+}
+
+// prometheusName converts a metric or label name into a valid Prometheus
+// name by replacing any invalid characters with an underscore. Names cannot
+// start with a digit, so those are prefixed with an underscore.
+func prometheusName(name string) string {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// prometheusLabels converts tags into sorted `name="value"` label pairs. Tag
+// keys which convert to an already used label name, or to a reserved one
+// like `__name__` or the `le` bucket bound of a histogram, are dropped with
+// a warning, since duplicate labels make the whole exposition invalid.
+func prometheusLabels(tags map[string]string, histogram bool, w *warnThrottle) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, 0, len(tags))
+	used := make(map[string]string, len(tags))
+	for _, k := range keys {
+		name := prometheusName(k)
+		if strings.HasPrefix(name, "__") || (histogram && name == "le") {
+			w.warnf("metrics: tag %q uses the reserved label %q, dropping it from the exposition", k, name)
+			continue
+		}
+		if first, ok := used[name]; ok {
+			w.warnf("metrics: tag %q conflicts with tag %q as label %q, dropping it from the exposition", k, first, name)
+			continue
+		}
+		used[name] = k
+		labels = append(labels, name+`="`+escapeLabelValue(tags[k])+`"`)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// formatLabels renders label pairs in braces, with an optional additional
+// label like the `le` bucket bound appended last. No labels renders nothing.
+func formatLabels(labels []string, extra ...string) string {
+	if len(extra) == 2 {
+		labels = append(labels[:len(labels):len(labels)], extra[0]+`="`+escapeLabelValue(extra[1])+`"`)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// labelEscaper escapes label values as required by the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes backslashes, double quotes, and line feeds.
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// formatPrometheusFloat formats a sample value, using the `+Inf`, `-Inf`,
+// and `NaN` spellings of the exposition format.
+func formatPrometheusFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
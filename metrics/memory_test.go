@@ -0,0 +1,428 @@
+package metrics_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleMemoryClient() {
+	client := metrics.NewMemoryClient()
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("requests.count")
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("requests.count")
+
+	aggregate := client.Snapshot()["requests.count[tag1:value1]"]
+	fmt.Println(aggregate.Type, aggregate.Value)
+	// Output: count 2
+}
+
+func TestMemoryClient(t *testing.T) {
+	var client metrics.Client
+	client = metrics.NewMemoryClient()
+
+	client.Incr("one")
+	client.Count("one", 5)
+	client.Decr("one")
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("one")
+
+	client.Gauge("memory", 1024)
+	client.Gauge("memory", 512)
+
+	client.Set("users", "alice")
+	client.Set("users", "bob")
+	client.Set("users", "alice")
+
+	client.Timing("timing", 100*time.Millisecond)
+	client.Timing("timing", 300*time.Millisecond)
+
+	client.Histogram("histo", 1)
+	client.Histogram("histo", 5)
+	client.Histogram("histo", 3)
+	client.WithRate(0.5).Distribution("distro", 999)
+
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.Flush()
+	client.Close()
+
+	snapshot := client.(*metrics.MemoryClient).Snapshot()
+
+	ExpectEqual(t, 7, len(snapshot))
+	ExpectEqual(t, 5.0, snapshot["one[]"].Value)
+	ExpectEqual(t, int64(3), snapshot["one[]"].Count)
+	ExpectEqual(t, 1.0, snapshot["one[tag1:value1]"].Value)
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, snapshot["one[tag1:value1]"].Tags)
+	ExpectEqual(t, 512.0, snapshot["memory[]"].Value)
+	ExpectEqual(t, 2.0, snapshot["users[]"].Value)
+
+	timing := snapshot["timing[]"]
+	ExpectEqual(t, "timing", timing.Type)
+	ExpectEqual(t, 100.0, timing.Min)
+	ExpectEqual(t, 300.0, timing.Max)
+	ExpectEqual(t, 200.0, timing.Avg())
+
+	histo := snapshot["histo[]"]
+	ExpectEqual(t, 1.0, histo.Min)
+	ExpectEqual(t, 5.0, histo.Max)
+	ExpectEqual(t, 3.0, histo.Avg())
+	ExpectEqual(t, 3.0, histo.Value)
+	ExpectEqual(t, int64(3), histo.Count)
+
+	ExpectEqual(t, 999.0, snapshot["distro[]"].Sum)
+}
+
+func TestMemoryClientSnapshotCopy(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("one")
+
+	snapshot := client.Snapshot()
+	snapshot["one[tag1:value1]"].Tags["tag1"] = "modified"
+	delete(snapshot, "one[tag1:value1]")
+
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("one")
+
+	aggregate := client.Snapshot()["one[tag1:value1]"]
+	ExpectEqual(t, "value1", aggregate.Tags["tag1"])
+	ExpectEqual(t, 2.0, aggregate.Value)
+}
+
+func TestMemoryClientConcurrency(t *testing.T) {
+	client := metrics.NewMemoryClient()
+
+	wg := sync.WaitGroup{}
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				client.Incr("concurrent")
+				client.Histogram("concurrent.histo", float64(j))
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	snapshot := client.Snapshot()
+	ExpectEqual(t, 1000.0, snapshot["concurrent[]"].Value)
+	ExpectEqual(t, int64(1000), snapshot["concurrent.histo[]"].Count)
+}
+
+func TestMemoryClientWithTag(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.WithTag("tag1", "value1").Incr("one")
+
+	ExpectEqual(t, 1.0, client.Snapshot()["one[tag1:value1]"].Value)
+}
+
+func TestMemoryClientWithPrefix(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.WithPrefix("a.").WithPrefix("b.").Incr("one")
+	client.WithPrefix("").Incr("two")
+
+	snapshot := client.Snapshot()
+	ExpectEqual(t, "a.b.one", snapshot["a.b.one[]"].Name)
+	ExpectEqual(t, 1.0, snapshot["two[]"].Value)
+}
+
+func TestMemoryClientWithRateClamp(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.WithRate(2.0).Incr("high")
+	client.WithRate(-1).Incr("negative")
+	client.WithRate(-1).Histogram("negative.histo", 1)
+
+	snapshot := client.Snapshot()
+	ExpectEqual(t, 1, len(snapshot))
+	ExpectEqual(t, 1.0, snapshot["high[]"].Value)
+}
+
+func TestMemoryClientGaugeDelta(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.Gauge("connections", 10)
+	client.GaugeDelta("connections", 2)
+	client.GaugeDelta("connections", -5)
+
+	aggregate := client.Snapshot()["connections[]"]
+	ExpectEqual(t, "gauge", aggregate.Type)
+	ExpectEqual(t, 7.0, aggregate.Value)
+}
+
+func TestMemoryClientWithTimestamp(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+	metrics.ResetTimestampWarnings()
+
+	client := metrics.NewMemoryClient()
+	stamped := client.WithTimestamp(time.Now().Add(-time.Hour)).WithTag("tag1", "value1")
+	stamped.Incr("requests")
+	stamped.Gauge("pending", 1)
+	stamped.Timing("latency", time.Millisecond)
+
+	// Only the unstamped timing is aggregated.
+	snapshot := client.Snapshot()
+	ExpectEqual(t, 1, len(snapshot))
+	ExpectEqual(t, "timing", snapshot["latency[tag1:value1]"].Type)
+
+	// Dropped calls are logged once per kind.
+	stamped.Incr("requests")
+	ExpectEqual(t, 1, strings.Count(warnings.String(), "memory client does not support timestamped counts"))
+	ExpectEqual(t, 1, strings.Count(warnings.String(), "memory client does not support timestamped gauges"))
+}
+
+func TestMemoryClientCountFloat(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.Count("work", 1)
+	client.CountFloat("work", 0.25)
+
+	aggregate := client.Snapshot()["work[]"]
+	ExpectEqual(t, "count", aggregate.Type)
+	ExpectEqual(t, 1.25, aggregate.Value)
+}
+
+func TestMemoryClientClock(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := metrics.NewMemoryClient(metrics.WithClock(func() time.Time {
+		return now
+	}))
+
+	start := now
+	now = now.Add(250 * time.Millisecond)
+	client.TimingSince("since", start)
+
+	ExpectEqual(t, 250.0, client.Snapshot()["since[]"].Value)
+}
+
+func TestMemoryClientRegisterGauge(t *testing.T) {
+	client := metrics.NewMemoryClient()
+
+	depth := 3.0
+	client.WithPrefix("app.").(*metrics.MemoryClient).RegisterGauge("queue.depth", func() float64 {
+		return depth
+	}, map[string]string{"queue": "jobs"})
+
+	// Reads always poll the callbacks for the current value.
+	ExpectEqual(t, 3.0, client.Snapshot()["app.queue.depth[queue:jobs]"].Value)
+	depth = 5
+	ExpectEqual(t, 5.0, client.Snapshot()["app.queue.depth[queue:jobs]"].Value)
+
+	// The last value is kept after unregistering.
+	client.WithPrefix("app.").(*metrics.MemoryClient).UnregisterGauge("queue.depth", map[string]string{"queue": "jobs"})
+	depth = 7
+	client.Flush()
+	ExpectEqual(t, 5.0, client.Snapshot()["app.queue.depth[queue:jobs]"].Value)
+}
+
+func TestMemoryClientCardinalityReport(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	ExpectEqual(t, map[string]int{}, client.CardinalityReport())
+
+	for _, user := range []string{"a", "b", "c", "a"} {
+		client.WithTag("user", user).Incr("requests")
+		client.WithTags(map[string]string{"user": user, "region": "us"}).Incr("requests")
+	}
+	client.Incr("requests")
+	client.WithTag("pool", "db").Gauge("pool.size", 10)
+	client.WithTag("pool", "db").Gauge("pool.size", 12)
+	client.WithPrefix("app.").Timing("latency", time.Millisecond)
+
+	ExpectEqual(t, map[string]int{
+		"requests":    7,
+		"pool.size":   1,
+		"app.latency": 1,
+	}, client.CardinalityReport())
+
+	client.Reset()
+	ExpectEqual(t, map[string]int{}, client.CardinalityReport())
+}
+
+func TestMemoryClientReset(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	child := client.WithTag("tag1", "value1")
+
+	client.Incr("one")
+	child.Incr("one")
+	child.(*metrics.MemoryClient).Reset()
+	ExpectEqual(t, 0, len(client.Snapshot()))
+
+	child.Incr("one")
+	ExpectEqual(t, 1.0, client.Snapshot()["one[tag1:value1]"].Value)
+}
+
+func ExampleMemoryClient_Handler() {
+	client := metrics.NewMemoryClient()
+	client.WithTag("status", "200").Incr("requests.count")
+
+	recorder := httptest.NewRecorder()
+	client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	fmt.Print(recorder.Body.String())
+	// Output: # TYPE requests_count counter
+	// requests_count{status="200"} 1
+}
+
+func TestMemoryClientHandler(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.WithTag("path", `C:\dir "a"`+"\n").Count("requests", 3)
+	client.WithTag("pool", "db").Gauge("pool.size", 10)
+	client.Set("users", "a")
+	client.Set("users", "b")
+	client.WithTag("route", "/users").Timing("latency", 20*time.Millisecond)
+	client.WithTag("route", "/users").Timing("latency", 3*time.Second)
+	client.Histogram("size", 0.5)
+	client.Histogram("size", 100)
+
+	server := httptest.NewServer(client.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	ExpectEqual(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	ExpectEqual(t, strings.Join([]string{
+		`# TYPE latency histogram`,
+		`latency_bucket{route="/users",le="0.005"} 0`,
+		`latency_bucket{route="/users",le="0.01"} 0`,
+		`latency_bucket{route="/users",le="0.025"} 1`,
+		`latency_bucket{route="/users",le="0.05"} 1`,
+		`latency_bucket{route="/users",le="0.1"} 1`,
+		`latency_bucket{route="/users",le="0.25"} 1`,
+		`latency_bucket{route="/users",le="0.5"} 1`,
+		`latency_bucket{route="/users",le="1"} 1`,
+		`latency_bucket{route="/users",le="2.5"} 1`,
+		`latency_bucket{route="/users",le="5"} 2`,
+		`latency_bucket{route="/users",le="10"} 2`,
+		`latency_bucket{route="/users",le="+Inf"} 2`,
+		`latency_sum{route="/users"} 3.02`,
+		`latency_count{route="/users"} 2`,
+		`# TYPE pool_size gauge`,
+		`pool_size{pool="db"} 10`,
+		`# TYPE requests counter`,
+		`requests{path="C:\\dir \"a\"\n"} 3`,
+		`# TYPE size histogram`,
+		`size_bucket{le="0.005"} 0`,
+		`size_bucket{le="0.01"} 0`,
+		`size_bucket{le="0.025"} 0`,
+		`size_bucket{le="0.05"} 0`,
+		`size_bucket{le="0.1"} 0`,
+		`size_bucket{le="0.25"} 0`,
+		`size_bucket{le="0.5"} 1`,
+		`size_bucket{le="1"} 1`,
+		`size_bucket{le="2.5"} 1`,
+		`size_bucket{le="5"} 1`,
+		`size_bucket{le="10"} 1`,
+		`size_bucket{le="+Inf"} 2`,
+		`size_sum 100.5`,
+		`size_count 2`,
+		`# TYPE users gauge`,
+		`users 2`,
+		``,
+	}, "\n"), string(body))
+}
+
+func TestMemoryClientHandlerBuckets(t *testing.T) {
+	client := metrics.NewMemoryClient(metrics.WithHistogramBuckets("latency", []float64{0.1, 1}))
+	client.Timing("latency", 50*time.Millisecond)
+	client.Timing("latency", 2*time.Second)
+
+	recorder := httptest.NewRecorder()
+	client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	ExpectEqual(t, strings.Join([]string{
+		`# TYPE latency histogram`,
+		`latency_bucket{le="0.1"} 1`,
+		`latency_bucket{le="1"} 1`,
+		`latency_bucket{le="+Inf"} 2`,
+		`latency_sum 2.05`,
+		`latency_count 2`,
+		``,
+	}, "\n"), recorder.Body.String())
+}
+
+func TestMemoryClientHandlerTypeConflict(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.Incr("jobs.total")
+	client.Gauge("jobs_total", 5)
+
+	recorder := httptest.NewRecorder()
+	client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	ExpectEqual(t, "# TYPE jobs_total counter\njobs_total 1\n", recorder.Body.String())
+}
+
+func TestMemoryClientHandlerTypeConflictWarns(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	client := metrics.NewMemoryClient()
+	client.Incr("jobs.total")
+	client.Gauge("jobs_total", 5)
+
+	client.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(warnings.String(), `gauge "jobs_total" conflicts with count "jobs.total"`) {
+		t.Fatalf("Expected a warning for the dropped series. Found '%s'", warnings.String())
+	}
+}
+
+func TestMemoryClientHandlerLabelConflict(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	client := metrics.NewMemoryClient()
+	client.WithTags(map[string]string{"a.b": "one", "a_b": "two"}).Incr("jobs")
+
+	recorder := httptest.NewRecorder()
+	client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	ExpectEqual(t, "# TYPE jobs counter\njobs{a_b=\"one\"} 1\n", recorder.Body.String())
+	if !strings.Contains(warnings.String(), `tag "a_b" conflicts with tag "a.b" as label "a_b"`) {
+		t.Fatalf("Expected a warning for the dropped label. Found '%s'", warnings.String())
+	}
+}
+
+func TestMemoryClientHandlerInvalidNames(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	client := metrics.NewMemoryClient()
+	client.WithTags(map[string]string{"1st": "one", "__name__": "two"}).Incr("5xx")
+	client.WithTag("le", "three").Histogram("size", 1)
+
+	recorder := httptest.NewRecorder()
+	client.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	// Names cannot start with a digit, and reserved labels are dropped.
+	if !strings.Contains(body, "_5xx{_1st=\"one\"} 1\n") {
+		t.Fatalf("Expected prefixed names. Found '%s'", body)
+	}
+	ExpectEqual(t, 1, strings.Count(body, `le="+Inf"`))
+	ExpectEqual(t, false, strings.Contains(body, `le="three"`))
+	for _, label := range []string{"__name__", "le"} {
+		if !strings.Contains(warnings.String(), `uses the reserved label "`+label+`"`) {
+			t.Fatalf("Expected a warning for the %s label. Found '%s'", label, warnings.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a metric call, e.g. so that a custom sink reading from
+// a `ChannelClient` can switch over every kind:
+//
+//   switch m.Type {
+//   case metrics.KindCount:
+//     ...
+//   }
+type Kind string
+
+// The kinds of metric calls. `KindGaugeDelta` is a signed adjustment to a
+// gauge rather than a new value.
+const (
+	KindCount        Kind = "count"
+	KindGauge        Kind = "gauge"
+	KindGaugeDelta   Kind = "gaugedelta"
+	KindSet          Kind = "set"
+	KindTiming       Kind = "timing"
+	KindHistogram    Kind = "histogram"
+	KindDistribution Kind = "distribution"
+)
+
+// Metric is a single metric call, e.g. as sent by a `ChannelClient`, which
+// can be rendered as a human-readable line via `FormatMetric`.
+type Metric struct {
+	// Type is the kind of call, e.g. `KindCount`.
+	Type Kind
+	Name string
+
+	// Value is the numeric value of the call. Timings are in milliseconds.
+	// It is zero for sets, whose unique value is in `Text` instead.
+	Value float64
+	Text  string
+
+	Tags      map[string]string
+	Rate      float64
+	Timestamp time.Time
+}
+
+// metricTypeNames are the display names of each metric type.
+var metricTypeNames = map[Kind]string{
+	KindCount:        "Count",
+	KindGauge:        "Gauge",
+	KindGaugeDelta:   "GaugeDelta",
+	KindSet:          "Set",
+	KindTiming:       "Timing",
+	KindHistogram:    "Histogram",
+	KindDistribution: "Distribution",
+}
+
+// FormatMetric returns the canonical human-readable line for a metric, as
+// written by the `LoggerClient`, with tags sorted by key:
+//
+//   Count requests.count:1 [tag1=value1]
+//   Count requests.count:5 (5 / 0.5 = 10) [tag1=value1]
+//   Gauge queue.depth:3 (0.5) []
+//   GaugeDelta queue.depth:-2 []
+//   Set users.unique:user1 []
+//   Timing request.latency:1.5ms []
+//   Gauge backfill:5@2020-01-02T03:04:05Z []
+//
+// Sampled counts also show the estimated total the server will extrapolate
+// from the value. A zero rate is treated as unsampled, and the timestamp is
+// only shown when it is set.
+func FormatMetric(m Metric) string {
+	return formatMetric(m, nil, false)
+}
+
+// formatMetric renders a metric line, optionally colorizing it. Type labels
+// override the default display name of each metric type.
+func formatMetric(m Metric, labels map[string]string, colors bool) string {
+	t := typeLabel(labels, m.Type)
+
+	name := m.Name
+	rate := m.Rate
+	if rate == 0 {
+		rate = 1.0
+	}
+	v := formatMetricValue(m)
+	r := strconv.FormatFloat(rate, 'f', -1, 64)
+	s := ""
+	scaled := m.Type == KindCount
+	if scaled {
+		estimate := math.Round(m.Value/rate*100) / 100
+		s = strconv.FormatFloat(estimate, 'f', -1, 64)
+	}
+
+	if colors {
+		name = cname(name)
+		r = crate(r)
+		v = cvalue(v)
+		s = csampled(s)
+	}
+
+	tags := formatTagMap(m.Tags, colors)
+
+	if rate == 1.0 {
+		return t + " " + name + ":" + v + " " + tags
+	}
+
+	if scaled {
+		return t + " " + name + ":" + v + " (" + v + " / " + r + " = " + s + ") " + tags
+	}
+	return t + " " + name + ":" + v + " (" + r + ") " + tags
+}
+
+// typeLabel returns the display name of a metric type, preferring the given
+// labels and falling back to the type itself if it is unknown.
+func typeLabel(labels map[string]string, kind Kind) string {
+	if label, ok := labels[string(kind)]; ok {
+		return label
+	}
+	if name, ok := metricTypeNames[kind]; ok {
+		return name
+	}
+	return string(kind)
+}
+
+// formatMetricValue renders the value of a metric: sets show their text,
+// gauge deltas always have a sign, and timings are shown as durations.
+func formatMetricValue(m Metric) string {
+	var v string
+	switch m.Type {
+	case KindSet:
+		v = m.Text
+	case KindGaugeDelta:
+		v = strconv.FormatFloat(m.Value, 'f', -1, 64)
+		if m.Value >= 0 {
+			v = "+" + v
+		}
+	case KindTiming:
+		v = time.Duration(math.Round(m.Value * float64(time.Millisecond))).String()
+	default:
+		v = strconv.FormatFloat(m.Value, 'f', -1, 64)
+	}
+
+	if !m.Timestamp.IsZero() {
+		v += "@" + m.Timestamp.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// formatTagMap returns the given tags in a stable, sorted format like
+// `[tag1=value1 tag2=value2]`, optionally colorizing the keys.
+func formatTagMap(tagMap map[string]string, colors bool) string {
+	keys := make([]string, 0, len(tagMap))
+	for k := range tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		k := key
+		if colors {
+			k = ctag(key)
+		}
+		tags = append(tags, k+"="+tagMap[key])
+	}
+
+	return "[" + strings.Join(tags, " ") + "]"
+}
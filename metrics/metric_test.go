@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleFormatMetric() {
+	fmt.Println(metrics.FormatMetric(metrics.Metric{
+		Type:  metrics.KindCount,
+		Name:  "requests.count",
+		Value: 5,
+		Tags:  map[string]string{"tag": "value"},
+		Rate:  0.5,
+	}))
+	// Output: Count requests.count:5 (5 / 0.5 = 10) [tag=value]
+}
+
+func ExampleKind() {
+	calls := []metrics.Metric{
+		{Type: metrics.KindCount, Name: "requests", Value: 1},
+		{Type: metrics.KindTiming, Name: "latency", Value: 25},
+	}
+
+	for _, m := range calls {
+		switch m.Type {
+		case metrics.KindCount:
+			fmt.Println("count", m.Name, m.Value)
+		case metrics.KindTiming:
+			fmt.Println("timing", m.Name, m.Value, "ms")
+		}
+	}
+	// Output: count requests 1
+	// timing latency 25 ms
+}
+
+func TestFormatMetric(t *testing.T) {
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tags := map[string]string{"tag2": "value2", "tag1": "value1"}
+
+	tests := []struct {
+		metric   metrics.Metric
+		expected string
+	}{
+		{metrics.Metric{Type: metrics.KindCount, Name: "one", Value: 1, Rate: 1}, "Count one:1 []"},
+		{metrics.Metric{Type: metrics.KindCount, Name: "one", Value: 1}, "Count one:1 []"},
+		{metrics.Metric{Type: metrics.KindCount, Name: "work", Value: 0.25, Rate: 1, Tags: tags}, "Count work:0.25 [tag1=value1 tag2=value2]"},
+		{metrics.Metric{Type: metrics.KindCount, Name: "one", Value: 1, Rate: 0.3}, "Count one:1 (1 / 0.3 = 3.33) []"},
+		{metrics.Metric{Type: metrics.KindGauge, Name: "big", Value: 1000000, Rate: 1}, "Gauge big:1000000 []"},
+		{metrics.Metric{Type: metrics.KindGauge, Name: "gauge", Value: 1.5, Rate: 0.5}, "Gauge gauge:1.5 (0.5) []"},
+		{metrics.Metric{Type: metrics.KindGauge, Name: "backfill", Value: 5, Rate: 1, Timestamp: timestamp}, "Gauge backfill:5@2020-01-02T03:04:05Z []"},
+		{metrics.Metric{Type: metrics.KindGaugeDelta, Name: "delta", Value: 2, Rate: 1}, "GaugeDelta delta:+2 []"},
+		{metrics.Metric{Type: metrics.KindGaugeDelta, Name: "delta", Value: -2, Rate: 1}, "GaugeDelta delta:-2 []"},
+		{metrics.Metric{Type: metrics.KindSet, Name: "unique", Text: "user1", Rate: 1}, "Set unique:user1 []"},
+		{metrics.Metric{Type: metrics.KindTiming, Name: "timing", Value: 2000, Rate: 1}, "Timing timing:2s []"},
+		{metrics.Metric{Type: metrics.KindTiming, Name: "timing", Value: 1.5, Rate: 1}, "Timing timing:1.5ms []"},
+		{metrics.Metric{Type: metrics.KindHistogram, Name: "histo", Value: 10, Rate: 1}, "Histogram histo:10 []"},
+		{metrics.Metric{Type: metrics.KindDistribution, Name: "dist", Value: 20, Rate: 1}, "Distribution dist:20 []"},
+		{metrics.Metric{Type: "custom", Name: "other", Value: 1, Rate: 1}, "custom other:1 []"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			ExpectEqual(t, test.expected, metrics.FormatMetric(test.metric))
+		})
+	}
+}
+
+func TestFormatMetricMatchesLogger(t *testing.T) {
+	ch := make(chan metrics.Metric, 10)
+	recorder := &LogRecorder{}
+	channel := metrics.NewChannelClient(ch, metrics.BufferBlock)
+	logger := metrics.NewLoggerClient(recorder)
+
+	for _, client := range []metrics.Client{channel, logger} {
+		client = client.WithTag("tag1", "value1")
+		client.Count("count", 2)
+		client.GaugeDelta("delta", 1)
+		client.Set("unique", "user1")
+		client.Timing("timing", 1500*time.Microsecond)
+	}
+
+	ExpectEqual(t, 4, len(recorder.messages))
+	for _, message := range recorder.messages {
+		m := <-ch
+		m.Timestamp = time.Time{}
+		ExpectEqual(t, message, metrics.FormatMetric(m))
+	}
+}
@@ -0,0 +1,264 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// MiddlewareOptions contains the configuration options for `Middleware`.
+type MiddlewareOptions struct {
+	CountName    string
+	DurationName string
+	Tags         []string
+	Route        func(r *http.Request) string
+}
+
+// MiddlewareOption is a middleware option. Can return an error if validation
+// fails.
+type MiddlewareOption func(*MiddlewareOptions) error
+
+// middlewareTags are the tags which can be included by `Middleware`.
+var middlewareTags = map[string]bool{
+	"method": true,
+	"route":  true,
+	"status": true,
+}
+
+// WithRequestCountName sets the name of the request count metric, which is
+// `http.requests` by default.
+func WithRequestCountName(name string) MiddlewareOption {
+	return func(o *MiddlewareOptions) error {
+		o.CountName = name
+		return nil
+	}
+}
+
+// WithRequestDurationName sets the name of the request duration timing,
+// which is `http.request.duration` by default.
+func WithRequestDurationName(name string) MiddlewareOption {
+	return func(o *MiddlewareOptions) error {
+		o.DurationName = name
+		return nil
+	}
+}
+
+// WithRequestTags sets which of the `method`, `route`, and `status` tags are
+// added to request metrics. All of them are added by default.
+func WithRequestTags(tags ...string) MiddlewareOption {
+	return func(o *MiddlewareOptions) error {
+		for _, tag := range tags {
+			if !middlewareTags[tag] {
+				return fmt.Errorf("unknown request tag %q", tag)
+			}
+		}
+		o.Tags = tags
+		return nil
+	}
+}
+
+// WithRouteFunc sets how the `route` tag is derived from a request. By
+// default it is the `http.ServeMux` pattern which matched the request, e.g.
+// `GET /users/{id}`, or `unknown`. Avoid raw URL paths, since their
+// cardinality is unbounded.
+func WithRouteFunc(route func(r *http.Request) string) MiddlewareOption {
+	return func(o *MiddlewareOptions) error {
+		if route == nil {
+			return errors.New("route func must not be nil")
+		}
+		o.Route = route
+		return nil
+	}
+}
+
+// defaultRoute returns the pattern which matched the request, which is set
+// by `http.ServeMux` once it has routed the request, so it is read after the
+// handler returns.
+func defaultRoute(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unknown"
+	}
+	return r.Pattern
+}
+
+// Middleware returns HTTP middleware which counts each request as
+// `http.requests` and times it as `http.request.duration`, tagged with the
+// request method, route, and response status:
+//
+//   mux := http.NewServeMux()
+//   mux.HandleFunc("GET /users/{id}", getUser)
+//
+//   handler := metrics.Middleware(client)(mux)
+//   http.ListenAndServe(":8080", handler)
+//
+// Tags stored in the request context via `ContextWithTags` are also added.
+// Durations use the client's clock set via `WithClock`. If the handler
+// panics, the request is recorded with a `500` status and the panic
+// continues.
+func Middleware(client Client, options ...MiddlewareOption) func(http.Handler) http.Handler {
+	o := &MiddlewareOptions{
+		CountName:    "http.requests",
+		DurationName: "http.request.duration",
+		Tags:         []string{"method", "route", "status"},
+		Route:        defaultRoute,
+	}
+	for _, option := range options {
+		if err := option(o); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	now := clockFor(client)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := now()
+			sw, rw := newStatusWriter(w)
+
+			defer func() {
+				p := recover()
+				if p != nil {
+					sw.status = http.StatusInternalServerError
+				}
+
+				tagged := client.WithContext(r.Context()).WithTags(o.tags(r, sw.statusCode()))
+				tagged.Incr(o.CountName)
+				tagged.Timing(o.DurationName, now().Sub(start))
+
+				if p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// tags returns the configured request tags.
+func (o *MiddlewareOptions) tags(r *http.Request, status int) map[string]string {
+	tags := make(map[string]string, len(o.Tags))
+	for _, tag := range o.Tags {
+		switch tag {
+		case "method":
+			tags[tag] = r.Method
+		case "route":
+			tags[tag] = o.Route(r)
+		case "status":
+			tags[tag] = strconv.Itoa(status)
+		}
+	}
+	return tags
+}
+
+// statusWriter captures the status code written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the final status code before writing it.
+// Informational `1xx` statuses are not final, so they are not recorded.
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit `200` status before writing the body.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original writer, so that `http.ResponseController` can
+// still access any other optional interfaces.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// newStatusWriter wraps a writer to capture its status code. The returned
+// writer implements `http.Flusher` and `http.Hijacker` only if the original
+// does, so that handlers checking for them with a type assertion, e.g. for
+// server-sent events or WebSockets, behave exactly as without the
+// middleware.
+func newStatusWriter(w http.ResponseWriter) (*statusWriter, http.ResponseWriter) {
+	sw := &statusWriter{ResponseWriter: w}
+	_, flusher := w.(http.Flusher)
+	_, hijacker := w.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return sw, flushHijackWriter{sw}
+	case flusher:
+		return sw, flushWriter{sw}
+	case hijacker:
+		return sw, hijackWriter{sw}
+	}
+	return sw, sw
+}
+
+// flush records an implicit `200` status, since flushing writes the headers,
+// and flushes the original writer, which must be an `http.Flusher`.
+func (w *statusWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijack takes over the connection of the original writer, which must be an
+// `http.Hijacker`.
+func (w *statusWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// flushWriter is a `statusWriter` for an `http.Flusher`.
+type flushWriter struct {
+	*statusWriter
+}
+
+// Flush sends any buffered data to the client.
+func (w flushWriter) Flush() {
+	w.flush()
+}
+
+// hijackWriter is a `statusWriter` for an `http.Hijacker`.
+type hijackWriter struct {
+	*statusWriter
+}
+
+// Hijack lets the handler take over the connection.
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+// flushHijackWriter is a `statusWriter` for a writer which is both an
+// `http.Flusher` and an `http.Hijacker`, like those of `net/http` servers.
+type flushHijackWriter struct {
+	*statusWriter
+}
+
+// Flush sends any buffered data to the client.
+func (w flushHijackWriter) Flush() {
+	w.flush()
+}
+
+// Hijack lets the handler take over the connection.
+func (w flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+// statusCode returns the written status, which is `200` if the handler never
+// wrote anything.
+func (w *statusWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,133 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleMiddleware() {
+	client := metrics.NewLoggerClient(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handler := metrics.Middleware(client, metrics.WithRequestTags("route", "status"))(mux)
+	http.ListenAndServe(":8080", handler)
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithClock(func() time.Time {
+		return now
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		now = now.Add(25 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusConflict)
+	})
+	handler := metrics.Middleware(client)(mux)
+
+	ctx := metrics.ContextWithTags(context.Background(), map[string]string{"tenant": "acme"})
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/users/123", nil).WithContext(ctx))
+	ExpectEqual(t, "ok", response.Body.String())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	ExpectEqual(t, []string{
+		"Count http.requests:1 [method=GET route=GET /users/{id} status=200 tenant=acme]",
+		"Timing http.request.duration:25ms [method=GET route=GET /users/{id} status=200 tenant=acme]",
+		"Count http.requests:1 [method=POST route=POST /users status=201]",
+		"Timing http.request.duration:0s [method=POST route=POST /users status=201]",
+		"Count http.requests:1 [method=GET route=unknown status=404]",
+		"Timing http.request.duration:0s [method=GET route=unknown status=404]",
+	}, recorder.messages)
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	handler := metrics.Middleware(recorder,
+		metrics.WithRequestCountName("api.requests"),
+		metrics.WithRequestDurationName("api.latency"),
+		metrics.WithRequestTags("route"),
+		metrics.WithRouteFunc(func(r *http.Request) string {
+			return "custom"
+		}),
+	)(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	recorder.Expect("api.requests").Value(1).Tag("route", "custom")
+	recorder.Expect("api.latency").Tag("route", "custom")
+	ExpectEqual(t, map[string]string{"route": "custom"}, recorder.GetCalls()[0].(*metrics.MetricCall).TagMap)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for an unknown request tag")
+		}
+	}()
+	metrics.Middleware(recorder, metrics.WithRequestTags("path"))
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	handler := metrics.Middleware(recorder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+
+	defer func() {
+		if err := recover(); err != "oops" {
+			t.Fatalf("Expected the panic to continue. Found '%v'", err)
+		}
+		recorder.Expect("http.requests").Tag("status", "500")
+		recorder.Expect("http.request.duration").Tag("status", "500")
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestMiddlewareOptionalInterfaces(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	supports := make(chan [2]bool, 2)
+	handler := metrics.Middleware(recorder, metrics.WithRequestTags("status"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, flusher := w.(http.Flusher)
+		_, hijacker := w.(http.Hijacker)
+		supports <- [2]bool{flusher, hijacker}
+		if flusher {
+			f.Flush()
+		}
+	}))
+
+	// The recorder can flush but not hijack, and the wrapper does the same.
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	ExpectEqual(t, [2]bool{true, false}, <-supports)
+	ExpectEqual(t, true, response.Flushed)
+	recorder.Expect("http.requests").Tag("status", "200")
+
+	// Server connections support both.
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	ExpectEqual(t, [2]bool{true, true}, <-supports)
+}
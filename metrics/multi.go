@@ -0,0 +1,362 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// MultiClient sends every metric, event, and service check to multiple
+// clients. This is useful when migrating between metrics providers or when
+// sending metrics to a production backend while also logging them locally.
+//
+//   client := metrics.NewMultiClient(
+//     metrics.NewDataDogClient("127.0.0.1:8125", "myprefix"),
+//     metrics.NewLoggerClient(nil),
+//   )
+type MultiClient struct {
+	clients []Client
+}
+
+// NewMultiClient creates a new client which fans out to all given clients.
+func NewMultiClient(clients ...Client) *MultiClient {
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// WithTags clones this client with additional tags applied to each of the
+// wrapped clients.
+func (c *MultiClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.WithTags(tags)
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *MultiClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *MultiClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *MultiClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *MultiClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns the combined tags of all the wrapped clients. If clients have
+// different values for the same tag, the last client wins.
+func (c *MultiClient) Tags() map[string]string {
+	tagMap := map[string]string{}
+	for _, client := range c.clients {
+		tagMap = combine(tagMap, client.Tags())
+	}
+	return tagMap
+}
+
+// Rate returns the highest sample rate of the wrapped clients, or 1.0 if
+// there are none.
+func (c *MultiClient) Rate() float64 {
+	if len(c.clients) == 0 {
+		return 1.0
+	}
+	rate := 0.0
+	for _, client := range c.clients {
+		rate = math.Max(rate, client.Rate())
+	}
+	return rate
+}
+
+// WithoutTags clones this client with the given tags removed from each of
+// the wrapped clients.
+func (c *MultiClient) WithoutTags(keys ...string) Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.WithoutTags(keys...)
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *MultiClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions on each of the wrapped clients.
+func (c *MultiClient) WithTimestamp(timestamp time.Time) Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.WithTimestamp(timestamp)
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// WithRate clones this client with a new sample rate applied to each of the
+// wrapped clients.
+func (c *MultiClient) WithRate(rate float64) Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.WithRate(rate)
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// WithAdditionalRate clones this client with the sample rate of each of the
+// wrapped clients multiplied by `factor`.
+func (c *MultiClient) WithAdditionalRate(factor float64) Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.WithAdditionalRate(factor)
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// Always clones this client with each of the wrapped clients always
+// emitting, so that critical metrics are never sampled out.
+func (c *MultiClient) Always() Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.Always()
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// WithPrefix clones this client with an additional metric name prefix
+// applied to each of the wrapped clients.
+func (c *MultiClient) WithPrefix(prefix string) Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.WithPrefix(prefix)
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// Clone returns an independent copy of this client by cloning each wrapped
+// client.
+func (c *MultiClient) Clone() Client {
+	clients := make([]Client, len(c.clients))
+	for i, client := range c.clients {
+		clients[i] = client.Clone()
+	}
+	return &MultiClient{
+		clients: clients,
+	}
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+// Each client is sent its own batch of the calls, so that clients which can
+// emit a batch as a unit still do so.
+func (c *MultiClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// sendBatch sends the calls of a batch to each client as a separate batch.
+func (c *MultiClient) sendBatch(calls []func(Client)) {
+	for _, client := range c.clients {
+		batch := client.Batch()
+		batch.calls = calls
+		batch.Send()
+	}
+}
+
+// Flush flushes all wrapped clients. Any errors are combined into a single
+// returned error.
+func (c *MultiClient) Flush() error {
+	var errs []error
+	for _, client := range c.clients {
+		if err := client.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all wrapped clients. Any errors are combined into a single
+// returned error.
+func (c *MultiClient) Close() error {
+	var errs []error
+	for _, client := range c.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Count adds some value to a metric.
+func (c *MultiClient) Count(name string, value int64) {
+	for _, client := range c.clients {
+		client.Count(name, value)
+	}
+}
+
+// Incr adds one to a metric.
+func (c *MultiClient) Incr(name string) {
+	for _, client := range c.clients {
+		client.Incr(name)
+	}
+}
+
+// Decr subtracts one from a metric.
+func (c *MultiClient) Decr(name string) {
+	for _, client := range c.clients {
+		client.Decr(name)
+	}
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *MultiClient) CountWithRate(name string, value int64, rate float64) {
+	for _, client := range c.clients {
+		client.CountWithRate(name, value, rate)
+	}
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *MultiClient) CountFloat(name string, value float64) {
+	for _, client := range c.clients {
+		client.CountFloat(name, value)
+	}
+}
+
+// Gauge sets a numeric value.
+func (c *MultiClient) Gauge(name string, value float64) {
+	for _, client := range c.clients {
+		client.Gauge(name, value)
+	}
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *MultiClient) GaugeInt(name string, value int64) {
+	for _, client := range c.clients {
+		client.GaugeInt(name, value)
+	}
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time.
+func (c *MultiClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	for _, client := range c.clients {
+		client.GaugeWithTimestamp(name, value, timestamp)
+	}
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *MultiClient) GaugeDelta(name string, delta float64) {
+	for _, client := range c.clients {
+		client.GaugeDelta(name, delta)
+	}
+}
+
+// Set counts the number of unique values for a metric.
+func (c *MultiClient) Set(name string, value string) {
+	for _, client := range c.clients {
+		client.Set(name, value)
+	}
+}
+
+// Event tracks an event that may be relevant to other metrics. Each client
+// receives its own copy of the event, since clients may modify it.
+func (c *MultiClient) Event(e *statsd.Event) {
+	for _, client := range c.clients {
+		copied := *e
+		copied.Tags = append([]string(nil), e.Tags...)
+		client.Event(&copied)
+	}
+}
+
+// ServiceCheck reports the status of a service. Each client receives its own
+// copy of the service check, since clients may modify it.
+func (c *MultiClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	for _, client := range c.clients {
+		copied := *sc
+		copied.Tags = append([]string(nil), sc.Tags...)
+		client.ServiceCheck(&copied)
+	}
+}
+
+// Timing tracks a duration.
+func (c *MultiClient) Timing(name string, value time.Duration) {
+	for _, client := range c.clients {
+		client.Timing(name, value)
+	}
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *MultiClient) TimingMs(name string, ms float64) {
+	for _, client := range c.clients {
+		client.TimingMs(name, ms)
+	}
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *MultiClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *MultiClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *MultiClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock of the first wrapped client, or `time.Now`.
+func (c *MultiClient) clock() func() time.Time {
+	if len(c.clients) == 0 {
+		return time.Now
+	}
+	return clockFor(c.clients[0])
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *MultiClient) Histogram(name string, value float64) {
+	for _, client := range c.clients {
+		client.Histogram(name, value)
+	}
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *MultiClient) Distribution(name string, value float64) {
+	for _, client := range c.clients {
+		client.Distribution(name, value)
+	}
+}
@@ -0,0 +1,141 @@
+package metrics_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// failingClient returns errors when flushed or closed.
+type failingClient struct {
+	metrics.NullClient
+	err error
+}
+
+func (c *failingClient) Flush() error {
+	return c.err
+}
+
+func (c *failingClient) Close() error {
+	return c.err
+}
+
+func ExampleMultiClient() {
+	client := metrics.NewMultiClient(
+		metrics.NewLoggerClient(nil),
+		metrics.NewNullClient(),
+	)
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("requests.count")
+	// Output: Count requests.count:1 [tag1=value1]
+}
+
+func TestMultiClient(t *testing.T) {
+	first := metrics.NewRecorderClient().WithTest(t)
+	second := metrics.NewRecorderClient().WithTest(t)
+
+	var client metrics.Client
+	client = metrics.NewMultiClient(first, second)
+
+	client.Incr("one")
+	client.Decr("one")
+	client.Count("two", 2)
+	client.Gauge("memory", 1024)
+	client.Set("users", "alice")
+	client.Timing("timing", time.Second)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).WithRate(0.5).Incr("tagged")
+
+	for _, recorder := range []*metrics.RecorderClient{first, second} {
+		ExpectEqual(t, 11, recorder.Length())
+		recorder.Expect("one").Value(1)
+		recorder.Expect("one").Value(-1)
+		recorder.Expect("two").Value(2)
+		recorder.Expect("memory").Value(1024)
+		recorder.Expect("users").Value("alice")
+		recorder.Expect("timing").Value(time.Second)
+		recorder.Expect("histo").Value(123)
+		recorder.Expect("distro").Value(999)
+		recorder.Expect("title").Text("desc")
+		recorder.Expect("check")
+		recorder.Expect("tagged").Tag("tag1", "value1").Rate(0.5)
+	}
+
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed. Found '%v'", err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Expected close to succeed. Found '%v'", err)
+	}
+}
+
+func TestMultiClientErrors(t *testing.T) {
+	client := metrics.NewMultiClient(
+		&failingClient{err: errors.New("first")},
+		metrics.NewNullClient(),
+		&failingClient{err: errors.New("second")},
+	)
+
+	err := client.Flush()
+	if err == nil || !strings.Contains(err.Error(), "first") || !strings.Contains(err.Error(), "second") {
+		t.Fatalf("Expected flush to return both errors. Found '%v'", err)
+	}
+
+	err = client.Close()
+	if err == nil || !strings.Contains(err.Error(), "first") || !strings.Contains(err.Error(), "second") {
+		t.Fatalf("Expected close to return both errors. Found '%v'", err)
+	}
+}
+
+func TestMultiClientWithPrefix(t *testing.T) {
+	first := metrics.NewRecorderClient().WithTest(t)
+	second := metrics.NewRecorderClient().WithTest(t)
+
+	metrics.NewMultiClient(first, second).WithPrefix("a.").WithPrefix("b.").Incr("one")
+
+	first.Expect("a.b.one").Value(1)
+	second.Expect("a.b.one").Value(1)
+}
+
+func TestMultiClientTags(t *testing.T) {
+	client := metrics.NewMultiClient(
+		metrics.NewRecorderClient(),
+		metrics.NewNullClient(),
+	).WithTag("tag1", "value1")
+
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, client.Tags())
+}
+
+func TestMultiClientRate(t *testing.T) {
+	client := metrics.NewMultiClient(
+		metrics.NewRecorderClient().WithRate(0.1),
+		metrics.NewRecorderClient().WithRate(0.5),
+	)
+
+	ExpectEqual(t, 0.5, client.Rate())
+	ExpectEqual(t, 0.2, client.WithRate(0.2).Rate())
+	ExpectEqual(t, 1.0, metrics.NewMultiClient().Rate())
+	ExpectEqual(t, 1.0, client.WithRate(0).Always().Rate())
+	ExpectEqual(t, 0.25, client.WithAdditionalRate(0.5).Rate())
+}
+
+func TestMultiClientWithoutTags(t *testing.T) {
+	first := metrics.NewRecorderClient().WithTest(t)
+	second := metrics.NewRecorderClient().WithTest(t)
+
+	metrics.NewMultiClient(first, second).WithTag("user_id", "123").WithoutTags("user_id").Incr("one")
+
+	ExpectEqual(t, "one:1[]", first.GetCalls()[0].String())
+	ExpectEqual(t, "one:1[]", second.GetCalls()[0].String())
+}
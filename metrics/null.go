@@ -1,9 +1,10 @@
 package metrics
 
 import (
+	"context"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
 // NullClient does nothing. Useful for tests when you do not care about metrics
@@ -16,15 +17,90 @@ func NewNullClient() *NullClient {
 	return &NullClient{}
 }
 
-// WithTags clones this client with additional tags. Duplicate tags overwrite
-// the existing value.
+// WithTags returns this client, since there is no state to modify. This
+// avoids allocations when chaining calls.
 func (c *NullClient) WithTags(tags map[string]string) Client {
-	return &NullClient{}
+	return c
+}
+
+// WithTagsIf returns this client, since there is no state to modify.
+func (c *NullClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return c
+}
+
+// WithTag returns this client, since there is no state to modify.
+func (c *NullClient) WithTag(key, value string) Client {
+	return c
+}
+
+// WithTagValues returns this client, since there is no state to modify.
+func (c *NullClient) WithTagValues(key string, values ...string) Client {
+	return c
+}
+
+// WithTagsFromStruct returns this client, since there is no state to modify.
+func (c *NullClient) WithTagsFromStruct(v interface{}) Client {
+	return c
+}
+
+// Tags always returns an empty map since the null client ignores tags.
+func (c *NullClient) Tags() map[string]string {
+	return map[string]string{}
+}
+
+// Rate always returns 1.0 since the NullClient never samples.
+func (c *NullClient) Rate() float64 {
+	return 1.0
+}
+
+// WithoutTags returns this client, since there is no state to modify.
+func (c *NullClient) WithoutTags(keys ...string) Client {
+	return c
+}
+
+// WithContext returns this client, since there is no state to modify.
+func (c *NullClient) WithContext(ctx context.Context) Client {
+	return c
 }
 
-// WithRate clones this client with a given sample rate.
+// WithTimestamp returns this client, since there is no state to modify.
+func (c *NullClient) WithTimestamp(timestamp time.Time) Client {
+	return c
+}
+
+// WithRate returns this client, since there is no state to modify.
 func (c *NullClient) WithRate(rate float64) Client {
-	return &NullClient{}
+	return c
+}
+
+// WithAdditionalRate returns this client, since there is no state to modify.
+func (c *NullClient) WithAdditionalRate(factor float64) Client {
+	return c
+}
+
+// Always returns this client, since there is no state to modify.
+func (c *NullClient) Always() Client {
+	return c
+}
+
+// Flush on a NullClient is a no-op
+func (c *NullClient) Flush() error {
+	return nil
+}
+
+// WithPrefix returns this client, since there is no state to modify.
+func (c *NullClient) WithPrefix(prefix string) Client {
+	return c
+}
+
+// Clone returns an independent copy of this client.
+func (c *NullClient) Clone() Client {
+	return c
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *NullClient) Batch() *Batch {
+	return newBatch(c)
 }
 
 // Close on a NullClient is a no-op
@@ -44,14 +120,43 @@ func (c *NullClient) Incr(name string) {
 func (c *NullClient) Decr(name string) {
 }
 
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *NullClient) CountWithRate(name string, value int64, rate float64) {
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *NullClient) CountFloat(name string, value float64) {
+}
+
 // Gauge sets a numeric value.
 func (c *NullClient) Gauge(name string, value float64) {
 }
 
+// GaugeInt sets a numeric integer value.
+func (c *NullClient) GaugeInt(name string, value int64) {
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time.
+func (c *NullClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *NullClient) GaugeDelta(name string, delta float64) {
+}
+
+// Set counts the number of unique values for a metric.
+func (c *NullClient) Set(name string, value string) {
+}
+
 // Event tracks an event that may be relevant to other metrics.
 func (c *NullClient) Event(event *statsd.Event) {
 }
 
+// ServiceCheck reports the status of a service.
+func (c *NullClient) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
 // Timing tracks a duration.
 func (c *NullClient) Timing(name string, value time.Duration) {
 }
@@ -60,6 +165,25 @@ func (c *NullClient) Timing(name string, value time.Duration) {
 func (c *NullClient) Histogram(name string, value float64) {
 }
 
+// TimingMs tracks a duration given in milliseconds.
+func (c *NullClient) TimingMs(name string, ms float64) {
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *NullClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *NullClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *NullClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
 // Distribution tracks the statistical distribution of a set of values.
 func (c *NullClient) Distribution(name string, value float64) {
 }
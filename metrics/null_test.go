@@ -4,7 +4,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/istreamlabs/go-metrics/metrics"
 )
 
@@ -27,13 +27,35 @@ func TestNullClientMethods(t *testing.T) {
 	client.Count("count", 5)
 
 	client.Gauge("gauge", 10)
+	client.Set("set", "value")
 
 	client.Histogram("histo", 1.25)
 	client.Timing("timing", time.Duration(123))
 	client.Distribution("distro", 999)
 
 	client.Event(&statsd.Event{})
+	client.ServiceCheck(&statsd.ServiceCheck{})
 
 	client.WithRate(1.2).Incr("rated")
+	ExpectEqual(t, 1.0, client.WithRate(0.5).Rate())
+	client.Flush()
 	client.Close()
 }
+
+func TestNullClientChaining(t *testing.T) {
+	var client metrics.Client
+	client = metrics.NewNullClient()
+
+	chained := client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).WithTag("tag2", "value2").WithTagsIf(true, map[string]string{
+		"tag3": "value3",
+	}).WithRate(0.5).WithPrefix("prefix.")
+	chained.Incr("chained")
+
+	if chained != client {
+		t.Fatalf("Expected chained null client to be the original client")
+	}
+
+	ExpectEqual(t, map[string]string{}, chained.Tags())
+}
@@ -0,0 +1,449 @@
+// Package otel provides a `metrics.Client` which writes into an
+// OpenTelemetry meter. It is a separate module so that only its users depend
+// on the OpenTelemetry libraries:
+//
+//   import "github.com/istreamlabs/go-metrics/metrics/otel"
+package otel
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// otelStore caches the created instruments by name and is shared by an
+// OpenTelemetry client and all of its clones.
+type otelStore struct {
+	mutex         sync.Mutex
+	meter         metric.Meter
+	counters      map[string]metric.Int64Counter
+	floatCounters map[string]metric.Float64Counter
+	gauges        map[string]metric.Float64Gauge
+	updowns       map[string]metric.Float64UpDownCounter
+	histograms    map[string]metric.Float64Histogram
+}
+
+// Client writes metrics into an OpenTelemetry `metric.Meter`, so they can
+// be exported by whichever readers and exporters are configured on its
+// `MeterProvider`:
+//
+//   provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+//   client := otel.NewClient(provider.Meter("myapp"))
+//
+// Counts are mapped to `Int64Counter` instruments, gauges to `Float64Gauge`
+// instruments, gauge deltas to `Float64UpDownCounter` instruments, and
+// timings, histograms, and distributions to `Float64Histogram` instruments.
+// Timings are recorded in seconds. Tags become attributes. Instruments are
+// created once per metric name and reused for subsequent calls.
+//
+// Negative counts are dropped since OpenTelemetry counters cannot decrease.
+// Sets, events, and service checks have no OpenTelemetry equivalent and are
+// ignored. The sample rate is ignored since values are aggregated
+// in-process, except that a rate of zero drops everything.
+type Client struct {
+	store     *otelStore
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewClient creates a new OpenTelemetry client which creates its
+// instruments using `meter`.
+func NewClient(meter metric.Meter) *Client {
+	if meter == nil {
+		log.Panic("meter must not be nil")
+	}
+
+	return &Client{
+		store: &otelStore{
+			meter:         meter,
+			counters:      map[string]metric.Int64Counter{},
+			floatCounters: map[string]metric.Float64Counter{},
+			gauges:        map[string]metric.Float64Gauge{},
+			updowns:       map[string]metric.Float64UpDownCounter{},
+			histograms:    map[string]metric.Float64Histogram{},
+		},
+		rate: 1.0,
+	}
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *Client) clone() *Client {
+	clone := *c
+	return &clone
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *Client) WithTags(tags map[string]string) metrics.Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	clone.tagMap = metrics.CombineTags(c.tagMap, tags)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *Client) WithTagsIf(cond bool, tags map[string]string) metrics.Client {
+	if !cond {
+		return c
+	}
+	return c.WithTags(tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *Client) WithTag(key, value string) metrics.Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *Client) WithTagValues(key string, values ...string) metrics.Client {
+	return metrics.ReplaceTagValues(c, key, values...)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *Client) WithTagsFromStruct(v interface{}) metrics.Client {
+	return c.WithTags(metrics.TagsFromStruct(v))
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *Client) Tags() map[string]string {
+	return metrics.CombineTags(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *Client) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *Client) WithoutTags(keys ...string) metrics.Client {
+	clone := c.clone()
+	clone.tagMap = metrics.RemoveTags(c.tagMap, keys...)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *Client) WithContext(ctx context.Context) metrics.Client {
+	return c.WithTags(metrics.TagsFromContext(ctx))
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions. Like `GaugeWithTimestamp`, those calls are not
+// supported and are dropped while a timestamp is set, since OpenTelemetry
+// instruments record the current time. The first dropped call of each kind is
+// logged.
+func (c *Client) WithTimestamp(timestamp time.Time) metrics.Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *Client) WithPrefix(prefix string) metrics.Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *Client) Clone() metrics.Client {
+	clone := c.clone()
+	clone.tagMap = metrics.CombineTags(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *Client) Batch() *metrics.Batch {
+	return metrics.NewBatch(c)
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *Client) WithRate(rate float64) metrics.Client {
+	clone := c.clone()
+	clone.rate = metrics.ClampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *Client) WithAdditionalRate(factor float64) metrics.Client {
+	return c.WithRate(c.rate * metrics.ClampRate(factor))
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *Client) Always() metrics.Client {
+	return c.WithRate(1.0)
+}
+
+// attributes returns the client tags as a measurement option, with the
+// attributes in sorted key order.
+func (c *Client) attributes() metric.MeasurementOption {
+	keys := make([]string, 0, len(c.tagMap))
+	for k := range c.tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, attribute.String(k, c.tagMap[k]))
+	}
+	return metric.WithAttributes(attrs...)
+}
+
+// Close on the Client is a no-op. The `MeterProvider` is responsible
+// for shutting down its readers and exporters.
+func (c *Client) Close() error {
+	return nil
+}
+
+// Flush on the Client is a no-op. Use `ForceFlush` on the
+// `MeterProvider` instead.
+func (c *Client) Flush() error {
+	return nil
+}
+
+// Count adds some value to a metric.
+func (c *Client) Count(name string, value int64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the OpenTelemetry client", "counts")
+		return
+	}
+	if value < 0 || c.rate <= 0 {
+		return
+	}
+
+	name = c.prefix + name
+
+	c.store.mutex.Lock()
+	counter := c.store.counters[name]
+	if counter == nil {
+		var err error
+		if counter, err = c.store.meter.Int64Counter(name); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.counters[name] = counter
+	}
+	c.store.mutex.Unlock()
+
+	counter.Add(context.Background(), value, c.attributes())
+}
+
+// Incr adds one to a metric.
+func (c *Client) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric. Since OpenTelemetry counters cannot
+// decrease, this is a no-op.
+func (c *Client) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *Client) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric using a `Float64Counter`
+// instrument. Negative values are dropped like in `Count`. Use a different
+// metric name than for integer counts, since OpenTelemetry instruments with
+// the same name but a different kind conflict.
+func (c *Client) CountFloat(name string, value float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the OpenTelemetry client", "counts")
+		return
+	}
+	if value < 0 || c.rate <= 0 {
+		return
+	}
+
+	name = c.prefix + name
+
+	c.store.mutex.Lock()
+	counter := c.store.floatCounters[name]
+	if counter == nil {
+		var err error
+		if counter, err = c.store.meter.Float64Counter(name); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.floatCounters[name] = counter
+	}
+	c.store.mutex.Unlock()
+
+	counter.Add(context.Background(), value, c.attributes())
+}
+
+// Gauge sets a numeric value.
+func (c *Client) Gauge(name string, value float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the OpenTelemetry client", "gauges")
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+
+	name = c.prefix + name
+
+	c.store.mutex.Lock()
+	gauge := c.store.gauges[name]
+	if gauge == nil {
+		var err error
+		if gauge, err = c.store.meter.Float64Gauge(name); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.gauges[name] = gauge
+	}
+	c.store.mutex.Unlock()
+
+	gauge.Record(context.Background(), value, c.attributes())
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *Client) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp on the Client is not supported and is dropped, since
+// OpenTelemetry instruments record the current time. The first dropped call
+// of each kind is logged.
+func (c *Client) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	metrics.WarnTimestampDropped("the OpenTelemetry client", "gauges")
+}
+
+// GaugeDelta adjusts an up-down counter by a signed amount. OpenTelemetry
+// gauges cannot be adjusted, so this uses a separate instrument and should
+// not be mixed with `Gauge` for the same metric name.
+func (c *Client) GaugeDelta(name string, delta float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+
+	name = c.prefix + name
+
+	c.store.mutex.Lock()
+	updown := c.store.updowns[name]
+	if updown == nil {
+		var err error
+		if updown, err = c.store.meter.Float64UpDownCounter(name); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.updowns[name] = updown
+	}
+	c.store.mutex.Unlock()
+
+	updown.Add(context.Background(), delta, c.attributes())
+}
+
+// Set on the Client is a no-op
+func (c *Client) Set(name string, value string) {
+}
+
+// Event on the Client is a no-op
+func (c *Client) Event(e *statsd.Event) {
+}
+
+// ServiceCheck on the Client is a no-op
+func (c *Client) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
+// record adds a value to an OpenTelemetry histogram. The options are only
+// used when the histogram is first created.
+func (c *Client) record(name string, value float64, options ...metric.Float64HistogramOption) {
+	if !metrics.Enabled() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+
+	name = c.prefix + name
+
+	c.store.mutex.Lock()
+	histogram := c.store.histograms[name]
+	if histogram == nil {
+		var err error
+		if histogram, err = c.store.meter.Float64Histogram(name, options...); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.histograms[name] = histogram
+	}
+	c.store.mutex.Unlock()
+
+	histogram.Record(context.Background(), value, c.attributes())
+}
+
+// Timing tracks a duration in seconds.
+func (c *Client) Timing(name string, value time.Duration) {
+	c.record(name, value.Seconds(), metric.WithUnit("s"))
+}
+
+// TimingMs tracks a duration given in milliseconds. Like `Timing`, it is
+// recorded in seconds.
+func (c *Client) TimingMs(name string, ms float64) {
+	c.record(name, ms/1000, metric.WithUnit("s"))
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *Client) NewTimer(name string) *metrics.Timer {
+	return metrics.NewTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *Client) TimeFunc(name string, fn func()) {
+	metrics.TimeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *Client) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *Client) Histogram(name string, value float64) {
+	c.record(name, value)
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *Client) Distribution(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the OpenTelemetry client", "distributions")
+		return
+	}
+	c.record(name, value)
+}
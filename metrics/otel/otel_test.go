@@ -0,0 +1,144 @@
+package otel_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+	"github.com/istreamlabs/go-metrics/metrics/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// ExpectEqual compares two values and fails if they are not deeply equal.
+func ExpectEqual(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected '%s' to be '%s'", actual, expected)
+	}
+}
+
+// newOTelClient returns an OpenTelemetry client backed by an in-memory
+// reader.
+func newOTelClient() (*otel.Client, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return otel.NewClient(provider.Meter("testing")), reader
+}
+
+// collectOTel returns the collected metrics from the reader by name.
+func collectOTel(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Expected collect to succeed. Found '%v'", err)
+	}
+	collected := map[string]metricdata.Metrics{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			collected[m.Name] = m
+		}
+	}
+	return collected
+}
+
+func ExampleClient() {
+	provider := sdkmetric.NewMeterProvider()
+	client := otel.NewClient(provider.Meter("myapp"))
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("requests.count")
+}
+
+func TestClient(t *testing.T) {
+	exporter, reader := newOTelClient()
+
+	var client metrics.Client = exporter
+	client.Incr("one")
+	client.Count("one", 5)
+	client.Decr("one")
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.Set("users", "alice")
+	client.Gauge("memory", 512)
+	client.GaugeInt("memory", 1024)
+	client.GaugeDelta("connections", 3)
+	client.GaugeDelta("connections", -1)
+	client.WithRate(0.5).Timing("two", 2*time.Second)
+	client.TimingMs("two", 500)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.WithTag("tag1", "value1").Incr("tagged.count")
+	client.WithTag("tag1", "value1").Incr("tagged.count")
+	client.Flush()
+	client.Close()
+
+	collected := collectOTel(t, reader)
+	ExpectEqual(t, 7, len(collected))
+
+	one := collected["one"].Data.(metricdata.Sum[int64])
+	ExpectEqual(t, true, one.IsMonotonic)
+	ExpectEqual(t, int64(6), one.DataPoints[0].Value)
+
+	memory := collected["memory"].Data.(metricdata.Gauge[float64])
+	ExpectEqual(t, 1024.0, memory.DataPoints[0].Value)
+
+	connections := collected["connections"].Data.(metricdata.Sum[float64])
+	ExpectEqual(t, false, connections.IsMonotonic)
+	ExpectEqual(t, 2.0, connections.DataPoints[0].Value)
+
+	two := collected["two"]
+	ExpectEqual(t, "s", two.Unit)
+	ExpectEqual(t, uint64(2), two.Data.(metricdata.Histogram[float64]).DataPoints[0].Count)
+	ExpectEqual(t, 2.5, two.Data.(metricdata.Histogram[float64]).DataPoints[0].Sum)
+
+	ExpectEqual(t, 123.0, collected["histo"].Data.(metricdata.Histogram[float64]).DataPoints[0].Sum)
+	ExpectEqual(t, 999.0, collected["distro"].Data.(metricdata.Histogram[float64]).DataPoints[0].Sum)
+
+	tagged := collected["tagged.count"].Data.(metricdata.Sum[int64])
+	ExpectEqual(t, 1, len(tagged.DataPoints))
+	ExpectEqual(t, int64(2), tagged.DataPoints[0].Value)
+	ExpectEqual(t, attribute.NewSet(attribute.String("tag1", "value1")), tagged.DataPoints[0].Attributes)
+}
+
+func TestClientCountFloat(t *testing.T) {
+	client, reader := newOTelClient()
+	client.CountFloat("work", 0.25)
+	client.CountFloat("work", 1)
+	client.CountFloat("work", -1)
+
+	work := collectOTel(t, reader)["work"].Data.(metricdata.Sum[float64])
+	ExpectEqual(t, true, work.IsMonotonic)
+	ExpectEqual(t, 1.25, work.DataPoints[0].Value)
+}
+
+func TestClientWithPrefix(t *testing.T) {
+	client, reader := newOTelClient()
+	client.WithPrefix("a.").WithPrefix("b.").Incr("one")
+
+	collected := collectOTel(t, reader)
+	ExpectEqual(t, int64(1), collected["a.b.one"].Data.(metricdata.Sum[int64]).DataPoints[0].Value)
+}
+
+func TestClientWithoutTags(t *testing.T) {
+	client, reader := newOTelClient()
+	client.WithTag("user_id", "123").WithTag("tag1", "value1").WithoutTags("user_id").Incr("one")
+
+	point := collectOTel(t, reader)["one"].Data.(metricdata.Sum[int64]).DataPoints[0]
+	ExpectEqual(t, attribute.NewSet(attribute.String("tag1", "value1")), point.Attributes)
+}
+
+func TestClientWithRateZero(t *testing.T) {
+	client, reader := newOTelClient()
+	zero := client.WithRate(0)
+	zero.Incr("one")
+	zero.Gauge("memory", 1)
+	zero.GaugeDelta("connections", 1)
+	zero.Histogram("histo", 1)
+
+	ExpectEqual(t, 0, len(collectOTel(t, reader)))
+}
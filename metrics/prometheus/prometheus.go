@@ -0,0 +1,470 @@
+// Package prometheus provides a `metrics.Client` which writes into a
+// Prometheus registry. It is a separate module so that only its users depend
+// on the Prometheus client library:
+//
+//   import "github.com/istreamlabs/go-metrics/metrics/prometheus"
+package prometheus
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prometheusStore caches the registered metric vectors by name and is shared
+// by a Prometheus client and all of its clones.
+type prometheusStore struct {
+	mutex      sync.Mutex
+	registry   *prometheus.Registry
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+	buckets    map[string][]float64
+}
+
+// Client writes metrics into a Prometheus registry, which can be exposed to a
+// Prometheus server via an HTTP handler:
+//
+//   client := prometheus.NewClient()
+//   http.Handle("/metrics", promhttp.HandlerFor(client.Registry(), promhttp.HandlerOpts{}))
+//
+// Counts are mapped to counters, gauges to gauges, and timings, histograms,
+// and distributions to histograms using the default buckets unless set via
+// `metrics.WithHistogramBuckets`. Timings are observed in seconds. Tags
+// become labels. Metric and label names are
+// converted to valid Prometheus names by replacing invalid characters with
+// underscores, e.g. `requests.count` becomes `requests_count`.
+//
+// Prometheus requires the label names for a metric to be declared up front,
+// so they are taken from the first call for a given metric name. Subsequent
+// calls for that name with a different set of tag names are dropped, as are
+// negative counts since Prometheus counters cannot decrease. Sets, events,
+// and service checks have no Prometheus equivalent and are ignored. The
+// sample rate is ignored since values are aggregated in-process, except that
+// a rate of zero drops everything.
+type Client struct {
+	store     *prometheusStore
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
+}
+
+// NewClient creates a new Prometheus client with its own registry. Only the
+// `metrics.WithHistogramBuckets` option is supported.
+func NewClient(options ...metrics.Option) *Client {
+	o := &metrics.Options{}
+	for _, option := range options {
+		if err := option(o); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	return &Client{
+		store: &prometheusStore{
+			registry:   prometheus.NewRegistry(),
+			counters:   map[string]*prometheus.CounterVec{},
+			gauges:     map[string]*prometheus.GaugeVec{},
+			histograms: map[string]*prometheus.HistogramVec{},
+			buckets:    o.HistogramBuckets,
+		},
+		rate: 1.0,
+	}
+}
+
+// Registry returns the underlying Prometheus registry.
+func (c *Client) Registry() *prometheus.Registry {
+	return c.store.registry
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *Client) WithTags(tags map[string]string) metrics.Client {
+	if len(tags) == 0 {
+		return c
+	}
+	return &Client{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    metrics.CombineTags(c.tagMap, tags),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *Client) WithTagsIf(cond bool, tags map[string]string) metrics.Client {
+	if !cond {
+		return c
+	}
+	return c.WithTags(tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *Client) WithTag(key, value string) metrics.Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *Client) WithTagValues(key string, values ...string) metrics.Client {
+	return metrics.ReplaceTagValues(c, key, values...)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *Client) WithTagsFromStruct(v interface{}) metrics.Client {
+	return c.WithTags(metrics.TagsFromStruct(v))
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *Client) Tags() map[string]string {
+	return metrics.CombineTags(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *Client) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *Client) WithoutTags(keys ...string) metrics.Client {
+	return &Client{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    metrics.RemoveTags(c.tagMap, keys...),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *Client) WithContext(ctx context.Context) metrics.Client {
+	return c.WithTags(metrics.TagsFromContext(ctx))
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions. Like `GaugeWithTimestamp`, those calls are not
+// supported and are dropped while a timestamp is set, since Prometheus
+// scrapes the current value. The first dropped call of each kind is logged.
+func (c *Client) WithTimestamp(timestamp time.Time) metrics.Client {
+	return &Client{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: timestamp,
+	}
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *Client) WithPrefix(prefix string) metrics.Client {
+	return &Client{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix + prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// Clone returns an independent copy of this client, which writes to the
+// same store as the original.
+func (c *Client) Clone() metrics.Client {
+	return &Client{
+		store:     c.store,
+		rate:      c.rate,
+		tagMap:    metrics.CombineTags(nil, c.tagMap),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *Client) Batch() *metrics.Batch {
+	return metrics.NewBatch(c)
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *Client) WithRate(rate float64) metrics.Client {
+	return &Client{
+		store:     c.store,
+		rate:      metrics.ClampRate(rate),
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *Client) WithAdditionalRate(factor float64) metrics.Client {
+	return c.WithRate(c.rate * metrics.ClampRate(factor))
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *Client) Always() metrics.Client {
+	return c.WithRate(1.0)
+}
+
+// prometheusName converts a metric or label name into a valid Prometheus
+// name by replacing any invalid characters with an underscore. Names cannot
+// start with a digit, so those are prefixed with an underscore.
+func prometheusName(name string) string {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// labels returns the sorted label names and label values for the client tags.
+func (c *Client) labels() ([]string, prometheus.Labels) {
+	names := make([]string, 0, len(c.tagMap))
+	labels := make(prometheus.Labels, len(c.tagMap))
+	for k, v := range c.tagMap {
+		name := prometheusName(k)
+		names = append(names, name)
+		labels[name] = v
+	}
+	sort.Strings(names)
+	return names, labels
+}
+
+// Close on the Client is a no-op
+func (c *Client) Close() error {
+	return nil
+}
+
+// Flush on the Client is a no-op
+func (c *Client) Flush() error {
+	return nil
+}
+
+// Count adds some value to a metric.
+func (c *Client) Count(name string, value int64) {
+	c.CountFloat(name, float64(value))
+}
+
+// Incr adds one to a metric.
+func (c *Client) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric. Since Prometheus counters cannot
+// decrease, this is a no-op.
+func (c *Client) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *Client) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric. Negative values are
+// dropped like in `Count`.
+func (c *Client) CountFloat(name string, value float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the Prometheus client", "counts")
+		return
+	}
+	if value < 0 || c.rate <= 0 {
+		return
+	}
+
+	names, labels := c.labels()
+	name = prometheusName(c.prefix + name)
+
+	c.store.mutex.Lock()
+	vec := c.store.counters[name]
+	if vec == nil {
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: name,
+			Help: name,
+		}, names)
+		if err := c.store.registry.Register(vec); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.counters[name] = vec
+	}
+	c.store.mutex.Unlock()
+
+	if counter, err := vec.GetMetricWith(labels); err == nil {
+		counter.Add(value)
+	}
+}
+
+// gauge returns the Prometheus gauge for a metric name using the client's
+// tags, or nil if it cannot be registered or the labels do not match.
+func (c *Client) gauge(name string) prometheus.Gauge {
+	names, labels := c.labels()
+	name = prometheusName(c.prefix + name)
+
+	c.store.mutex.Lock()
+	vec := c.store.gauges[name]
+	if vec == nil {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name,
+			Help: name,
+		}, names)
+		if err := c.store.registry.Register(vec); err != nil {
+			c.store.mutex.Unlock()
+			return nil
+		}
+		c.store.gauges[name] = vec
+	}
+	c.store.mutex.Unlock()
+
+	gauge, err := vec.GetMetricWith(labels)
+	if err != nil {
+		return nil
+	}
+	return gauge
+}
+
+// Gauge sets a numeric value.
+func (c *Client) Gauge(name string, value float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the Prometheus client", "gauges")
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	if gauge := c.gauge(name); gauge != nil {
+		gauge.Set(value)
+	}
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *Client) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp on the Client is not supported and is dropped, since
+// Prometheus scrapes the current value. The first dropped call of each kind
+// is logged.
+func (c *Client) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	metrics.WarnTimestampDropped("the Prometheus client", "gauges")
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *Client) GaugeDelta(name string, delta float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	if gauge := c.gauge(name); gauge != nil {
+		gauge.Add(delta)
+	}
+}
+
+// Set on the Client is a no-op
+func (c *Client) Set(name string, value string) {
+}
+
+// Event on the Client is a no-op
+func (c *Client) Event(e *statsd.Event) {
+}
+
+// ServiceCheck on the Client is a no-op
+func (c *Client) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
+// observe adds a value to a Prometheus histogram.
+func (c *Client) observe(name string, value float64) {
+	if !metrics.Enabled() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	names, labels := c.labels()
+	buckets := c.store.buckets[name]
+	name = prometheusName(c.prefix + name)
+
+	c.store.mutex.Lock()
+	vec := c.store.histograms[name]
+	if vec == nil {
+		vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    name,
+			Help:    name,
+			Buckets: buckets,
+		}, names)
+		if err := c.store.registry.Register(vec); err != nil {
+			c.store.mutex.Unlock()
+			return
+		}
+		c.store.histograms[name] = vec
+	}
+	c.store.mutex.Unlock()
+
+	if observer, err := vec.GetMetricWith(labels); err == nil {
+		observer.Observe(value)
+	}
+}
+
+// Timing tracks a duration in seconds.
+func (c *Client) Timing(name string, value time.Duration) {
+	c.observe(name, value.Seconds())
+}
+
+// TimingMs tracks a duration given in milliseconds. Like `Timing`, it is
+// observed in seconds.
+func (c *Client) TimingMs(name string, ms float64) {
+	c.observe(name, ms/1000)
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *Client) NewTimer(name string) *metrics.Timer {
+	return metrics.NewTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *Client) TimeFunc(name string, fn func()) {
+	metrics.TimeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *Client) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *Client) Histogram(name string, value float64) {
+	c.observe(name, value)
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *Client) Distribution(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		metrics.WarnTimestampDropped("the Prometheus client", "distributions")
+		return
+	}
+	c.observe(name, value)
+}
@@ -0,0 +1,224 @@
+package prometheus_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+	"github.com/istreamlabs/go-metrics/metrics/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// ExpectEqual compares two values and fails if they are not deeply equal.
+func ExpectEqual(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected '%s' to be '%s'", actual, expected)
+	}
+}
+
+// gatherMetric returns the gathered Prometheus metric with the given name and
+// label value for `tag`, or nil if it cannot be found.
+func gatherMetric(t *testing.T, client *prometheus.Client, name, tag, value string) *dto.Metric {
+	t.Helper()
+	families, err := client.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Expected gather to succeed. Found '%v'", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == tag && label.GetValue() == value {
+					return metric
+				}
+			}
+			if tag == "" && len(metric.GetLabel()) == 0 {
+				return metric
+			}
+		}
+	}
+	return nil
+}
+
+func ExampleClient() {
+	client := prometheus.NewClient()
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("requests.count")
+}
+
+func TestClient(t *testing.T) {
+	var client metrics.Client
+	client = prometheus.NewClient()
+
+	client.Incr("one")
+	client.Count("one", 5)
+	client.Decr("one")
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.Set("users", "alice")
+	client.Gauge("memory", 1024)
+	client.WithRate(0.5).Timing("two", 2*time.Second)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+
+	tagged := client.WithTags(map[string]string{
+		"tag-1": "value1",
+	})
+	tagged.Incr("tagged.count")
+	tagged.Incr("tagged.count")
+
+	// Different label names for the same metric name are dropped.
+	client.WithTags(map[string]string{
+		"other": "value",
+	}).Incr("tagged.count")
+
+	client.Flush()
+	client.Close()
+
+	prom := client.(*prometheus.Client)
+
+	one := gatherMetric(t, prom, "one", "", "")
+	ExpectEqual(t, 6.0, one.GetCounter().GetValue())
+
+	memory := gatherMetric(t, prom, "memory", "", "")
+	ExpectEqual(t, 1024.0, memory.GetGauge().GetValue())
+
+	two := gatherMetric(t, prom, "two", "", "")
+	ExpectEqual(t, uint64(1), two.GetHistogram().GetSampleCount())
+	ExpectEqual(t, 2.0, two.GetHistogram().GetSampleSum())
+
+	histo := gatherMetric(t, prom, "histo", "", "")
+	ExpectEqual(t, 123.0, histo.GetHistogram().GetSampleSum())
+
+	distro := gatherMetric(t, prom, "distro", "", "")
+	ExpectEqual(t, 999.0, distro.GetHistogram().GetSampleSum())
+
+	tagCount := gatherMetric(t, prom, "tagged_count", "tag_1", "value1")
+	ExpectEqual(t, 2.0, tagCount.GetCounter().GetValue())
+
+	if gatherMetric(t, prom, "tagged_count", "other", "value") != nil {
+		t.Fatalf("Expected metric with mismatched labels to be dropped")
+	}
+}
+
+func TestClientWithPrefix(t *testing.T) {
+	client := prometheus.NewClient()
+	client.WithPrefix("a.").WithPrefix("b.").Incr("one")
+
+	one := gatherMetric(t, client, "a_b_one", "", "")
+	ExpectEqual(t, 1.0, one.GetCounter().GetValue())
+}
+
+func TestClientHistogramBuckets(t *testing.T) {
+	client := prometheus.NewClient(
+		metrics.WithHistogramBuckets("latency", []float64{0.01, 0.1, 1}),
+		metrics.WithHistogramBuckets("size", []float64{10, 100}),
+	)
+	for _, ms := range []int{5, 50, 60, 500, 5000} {
+		client.WithPrefix("api.").Timing("latency", time.Duration(ms)*time.Millisecond)
+	}
+	client.Histogram("size", 50)
+	client.Histogram("other", 50)
+
+	// Timing bounds are in seconds and bucket counts are cumulative.
+	var counts []uint64
+	var bounds []float64
+	for _, bucket := range gatherMetric(t, client, "api_latency", "", "").GetHistogram().GetBucket() {
+		bounds = append(bounds, bucket.GetUpperBound())
+		counts = append(counts, bucket.GetCumulativeCount())
+	}
+	ExpectEqual(t, []float64{0.01, 0.1, 1}, bounds)
+	ExpectEqual(t, []uint64{1, 3, 4}, counts)
+
+	ExpectEqual(t, 2, len(gatherMetric(t, client, "size", "", "").GetHistogram().GetBucket()))
+	ExpectEqual(t, len(promclient.DefBuckets), len(gatherMetric(t, client, "other", "", "").GetHistogram().GetBucket()))
+
+	invalid := map[string][]float64{
+		"empty":      nil,
+		"unsorted":   {1, 0.5},
+		"duplicated": {1, 1},
+	}
+	for name, bounds := range invalid {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); err == nil {
+					t.Fatalf("Expected invalid buckets to panic")
+				}
+			}()
+			prometheus.NewClient(metrics.WithHistogramBuckets("latency", bounds))
+		})
+	}
+}
+
+func TestClientGaugeDelta(t *testing.T) {
+	client := prometheus.NewClient()
+	client.Gauge("connections", 10)
+	client.GaugeDelta("connections", 2)
+	client.GaugeDelta("connections", -5)
+
+	connections := gatherMetric(t, client, "connections", "", "")
+	ExpectEqual(t, 7.0, connections.GetGauge().GetValue())
+}
+
+func TestClientCountFloat(t *testing.T) {
+	client := prometheus.NewClient()
+	client.Count("work", 1)
+	client.CountFloat("work", 0.25)
+	client.CountFloat("work", -1)
+
+	work := gatherMetric(t, client, "work", "", "")
+	ExpectEqual(t, 1.25, work.GetCounter().GetValue())
+}
+
+func TestClientLeadingDigit(t *testing.T) {
+	client := prometheus.NewClient()
+	client.WithTag("1st", "value").Incr("5xx")
+
+	// Names cannot start with a digit, so they are prefixed.
+	errors := gatherMetric(t, client, "_5xx", "_1st", "value")
+	ExpectEqual(t, 1.0, errors.GetCounter().GetValue())
+}
+
+func TestMemoryClientHandlerParses(t *testing.T) {
+	client := metrics.NewMemoryClient()
+	client.WithTag("path", `C:\dir "a"`+"\n").Count("requests", 3)
+	client.WithTag("pool", "db").Gauge("pool.size", 10)
+	client.Set("users", "a")
+	client.WithTag("route", "/users").Timing("latency", 20*time.Millisecond)
+	client.WithTag("route", "/users").Timing("latency", 3*time.Second)
+	client.Histogram("size", 0.5)
+	client.WithTags(map[string]string{"1st": "a", "le": "b"}).Histogram("5xx", 1)
+
+	server := httptest.NewServer(client.Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	// The memory client's exposition must be accepted by the Prometheus text
+	// parser.
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectEqual(t, 6, len(families))
+	ExpectEqual(t, "_1st", families["_5xx"].GetMetric()[0].GetLabel()[0].GetName())
+	ExpectEqual(t, `C:\dir "a"`+"\n", families["requests"].GetMetric()[0].GetLabel()[0].GetValue())
+	ExpectEqual(t, uint64(2), families["latency"].GetMetric()[0].GetHistogram().GetSampleCount())
+}
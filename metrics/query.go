@@ -34,7 +34,8 @@ type Query interface {
 	Accept()
 
 	// GetCalls returns the currently matching list of calls. The calls may be
-	// cast to `MetricCall` or `EventCall` for further processing.
+	// cast to `MetricCall`, `SetCall`, `EventCall`, or `ServiceCheckCall` for
+	// further processing.
 	GetCalls() []Call
 
 	// MinTimes sets the minimum number of calls that should be left before
@@ -46,16 +47,17 @@ type Query interface {
 	// in the serialized representation of the call.
 	Contains(component string) Query
 
-	// ID filters out any metric whose name does not match `id` or event whose
-	// title does not match `id`. Using `*` will match any ID.
+	// ID filters out any metric or service check whose name does not match
+	// `id` or event whose title does not match `id`. Using `*` will match any ID.
 	ID(name string) Query
 
 	// Value filters out any metric whose numeric value does not match `value`.
-	// All events are filtered out.
+	// Sets are compared using the string representation of `value`. All events
+	// are filtered out.
 	Value(value interface{}) Query
 
-	// Text filters out any event whose content text does not match `text`. All
-	// metrics are filtered out.
+	// Text filters out any event whose content text or service check whose
+	// message does not match `text`. All metrics are filtered out.
 	Text(text string) Query
 
 	// Tag filters out any metric or event that does not contain the given tag
@@ -164,7 +166,7 @@ func (q *query) Contains(component string) Query {
 	return q
 }
 
-// ID expects a metric name or event title.
+// ID expects a metric name, event title, or service check name.
 func (q *query) ID(id string) Query {
 	q.history = fmt.Sprintf("%s id(%s)", q.history, id)
 	q.filter(func(call Call) bool {
@@ -173,10 +175,18 @@ func (q *query) ID(id string) Query {
 			if t.Name == id {
 				return true
 			}
+		case *SetCall:
+			if t.Name == id {
+				return true
+			}
 		case *EventCall:
 			if t.Event.Title == id {
 				return true
 			}
+		case *ServiceCheckCall:
+			if t.Check.Name == id {
+				return true
+			}
 		}
 		return false
 	})
@@ -192,8 +202,11 @@ func (q *query) ID(id string) Query {
 func (q *query) Value(value interface{}) Query {
 	q.history = fmt.Sprintf("%s value(%v)", q.history, value)
 	q.filter(func(call Call) bool {
-		if m, ok := call.(*MetricCall); ok {
-			return reflect.DeepEqual(m.Value, toFloat64(value))
+		switch t := call.(type) {
+		case *MetricCall:
+			return reflect.DeepEqual(t.Value, toFloat64(value))
+		case *SetCall:
+			return t.Value == fmt.Sprintf("%v", value)
 		}
 		return false
 	})
@@ -205,12 +218,15 @@ func (q *query) Value(value interface{}) Query {
 	return q
 }
 
-// Text expects an event with the given text content value.
+// Text expects an event or service check with the given text content value.
 func (q *query) Text(text string) Query {
 	q.history = fmt.Sprintf("%s text(%10s)", q.history, text)
 	q.filter(func(call Call) bool {
-		if e, ok := call.(*EventCall); ok {
-			return e.Event.Text == text
+		switch t := call.(type) {
+		case *EventCall:
+			return t.Event.Text == text
+		case *ServiceCheckCall:
+			return t.Check.Message == text
 		}
 		return false
 	})
@@ -231,10 +247,18 @@ func (q *query) Tag(name, value string) Query {
 			if v, ok := t.TagMap[name]; ok {
 				return v == value
 			}
+		case *SetCall:
+			if v, ok := t.TagMap[name]; ok {
+				return v == value
+			}
 		case *EventCall:
 			if v, ok := t.TagMap[name]; ok {
 				return v == value
 			}
+		case *ServiceCheckCall:
+			if v, ok := t.TagMap[name]; ok {
+				return v == value
+			}
 		}
 		return false
 	})
@@ -255,10 +279,18 @@ func (q *query) TagName(name string) Query {
 			if _, ok := t.TagMap[name]; ok {
 				return true
 			}
+		case *SetCall:
+			if _, ok := t.TagMap[name]; ok {
+				return true
+			}
 		case *EventCall:
 			if _, ok := t.TagMap[name]; ok {
 				return true
 			}
+		case *ServiceCheckCall:
+			if _, ok := t.TagMap[name]; ok {
+				return true
+			}
 		}
 		return false
 	})
@@ -277,6 +309,8 @@ func (q *query) Rate(rate float64) Query {
 		switch t := call.(type) {
 		case *MetricCall:
 			return t.Rate == rate
+		case *SetCall:
+			return t.Rate == rate
 		case *EventCall:
 			return false
 		}
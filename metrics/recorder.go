@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"path"
 	"runtime"
 	"sort"
@@ -9,21 +11,24 @@ import (
 	"sync"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
-// Call describes either a metrics or event call. You can cast it to
-// either `MetricCall` or `EventCall` to get at type-specific fields
-// for custom checks. Conversion to a string results in a serialized
-// representation that looks like one of the following, where the (RATE)
-// field is only shown when not equal to 1.0:
+// Call describes either a metrics, set, event, or service check call. You can
+// cast it to `MetricCall`, `SetCall`, `EventCall`, or `ServiceCheckCall` to
+// get at type-specific fields for custom checks. Conversion to a string
+// results in a serialized representation that looks like one of the
+// following, where the (RATE) field is only shown when not equal to 1.0:
 //
-//   // Serialized metric
+//   // Serialized metric or set
 //   NAME:VALUE(RATE)[TAG_NAME:TAG_VALUE TAG_NAME:TAG_VALUE ...]
 //
 //   // Serialized event
 //   TITLE:TEXT[TAG_NAME:TAG_VALUE TAG_NAME:TAG_VALUE ...]
 //
+//   // Serialized service check
+//   NAME:STATUS:MESSAGE[TAG_NAME:TAG_VALUE TAG_NAME:TAG_VALUE ...]
+//
 //   // Example of casting to get additional data
 //   value := call.(*MetricCall).Value
 //   title := call.(*EventCall).Event.Title
@@ -38,11 +43,15 @@ type TestFailer interface {
 
 // MetricCall tracks a single metrics call, value, and tags. All values are
 // converted to `float64` from the `int`, `float64`, or `time.Duration` inputs.
+// The `Type` is one of `count`, `gauge`, `gaugedelta`, `timing`,
+// `histogram`, or `distribution`.
 type MetricCall struct {
-	Name   string
-	Value  float64
-	Rate   float64
-	TagMap map[string]string
+	Type      string
+	Name      string
+	Value     float64
+	Rate      float64
+	TagMap    map[string]string
+	Timestamp time.Time // zero unless sent via `GaugeWithTimestamp` or `WithTimestamp`
 }
 
 // String returns a serialized representation of the metric.
@@ -56,6 +65,25 @@ func (m *MetricCall) String() string {
 	return fmt.Sprintf("%s:%v%v", m.Name, m.Value, tags)
 }
 
+// SetCall tracks a single set call, its unique string value, and tags.
+type SetCall struct {
+	Name   string
+	Value  string
+	Rate   float64
+	TagMap map[string]string
+}
+
+// String returns a serialized representation of the set.
+func (s *SetCall) String() string {
+	tags := mapToStrings(s.TagMap)
+	sort.Strings(tags)
+	if s.Rate != 1.0 {
+		return fmt.Sprintf("%s:%s(%v)%v", s.Name, s.Value, s.Rate, tags)
+	}
+
+	return fmt.Sprintf("%s:%s%v", s.Name, s.Value, tags)
+}
+
 // EventCall tracks a single event call and tags.
 type EventCall struct {
 	Event  *statsd.Event
@@ -69,6 +97,19 @@ func (e *EventCall) String() string {
 	return fmt.Sprintf("%s:%s%v", e.Event.Title, e.Event.Text, tags)
 }
 
+// ServiceCheckCall tracks a single service check call and tags.
+type ServiceCheckCall struct {
+	Check  *statsd.ServiceCheck
+	TagMap map[string]string
+}
+
+// String returns a serialized representation of the service check.
+func (s *ServiceCheckCall) String() string {
+	tags := mapToStrings(s.TagMap)
+	sort.Strings(tags)
+	return fmt.Sprintf("%s:%s:%s%v", s.Check.Name, serviceCheckStatus(s.Check.Status), s.Check.Message, tags)
+}
+
 // stackInfo returns a string representation of the metrics call stack.
 func stackInfo(info *callInfo) string {
 	stack := make([]string, 0, len(info.Calls))
@@ -81,6 +122,7 @@ func stackInfo(info *callInfo) string {
 type callInfo struct {
 	Calls   []Call
 	RWMutex sync.RWMutex
+	now     func() time.Time
 }
 
 // RecorderClient records any metric that is sent, allowing you to make
@@ -88,7 +130,7 @@ type callInfo struct {
 // context is used that allows cloned clients to all write to the same
 // call info store.
 //
-// Assertion methods for convenient testing
+// # Assertion methods for convenient testing
 //
 // These methods provide a fast way to write tests while providing useful
 // and consistent output in the event of a test failure. For example:
@@ -115,7 +157,7 @@ type callInfo struct {
 //     recorder.If("my.metric").Value(5).Reject()
 //   }
 //
-// Custom Checks
+// # Custom Checks
 //
 // The recorder provides access to individual call information so that
 // custom checks can be written if needed. For example, to check that a given
@@ -135,18 +177,25 @@ type callInfo struct {
 //       recorder.Fatalf("Expected values '1, 2' in order.")
 //     }
 //   }
-//
 type RecorderClient struct {
-	callInfo *callInfo
-	test     TestFailer
-	rate     float64
-	tagMap   map[string]string
+	callInfo  *callInfo
+	test      TestFailer
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	timestamp time.Time
 }
 
-// NewRecorderClient creates a new recording metrics client.
-func NewRecorderClient() *RecorderClient {
+// NewRecorderClient creates a new recording metrics client. Only the
+// `WithClock` option is supported.
+func NewRecorderClient(options ...Option) *RecorderClient {
+	o, err := resolveOptions(options)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	return &RecorderClient{
-		callInfo: &callInfo{},
+		callInfo: &callInfo{now: o.Clock},
 		rate:     1.0,
 	}
 }
@@ -154,36 +203,162 @@ func NewRecorderClient() *RecorderClient {
 // WithTags clones this client with additional tags. Duplicate tags overwrite
 // the existing value.
 func (c *RecorderClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
 	return &RecorderClient{
-		callInfo: c.callInfo,
-		test:     c.test,
-		rate:     c.rate,
-		tagMap:   combine(c.tagMap, tags),
+		callInfo:  c.callInfo,
+		test:      c.test,
+		rate:      c.rate,
+		tagMap:    combine(c.tagMap, tags),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
 	}
 }
 
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *RecorderClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *RecorderClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *RecorderClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *RecorderClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *RecorderClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *RecorderClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *RecorderClient) WithoutTags(keys ...string) Client {
+	return &RecorderClient{
+		callInfo:  c.callInfo,
+		test:      c.test,
+		rate:      c.rate,
+		tagMap:    without(c.tagMap, keys),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *RecorderClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions, which is recorded in each call's `Timestamp`.
+func (c *RecorderClient) WithTimestamp(timestamp time.Time) Client {
+	return &RecorderClient{
+		callInfo:  c.callInfo,
+		test:      c.test,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: timestamp,
+	}
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *RecorderClient) WithPrefix(prefix string) Client {
+	return &RecorderClient{
+		callInfo:  c.callInfo,
+		test:      c.test,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix + prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// Clone returns an independent copy of this client. Calls made on the clone
+// are recorded with those of the original.
+func (c *RecorderClient) Clone() Client {
+	return &RecorderClient{
+		callInfo:  c.callInfo,
+		test:      c.test,
+		rate:      c.rate,
+		tagMap:    combine(nil, c.tagMap),
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
+	}
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *RecorderClient) Batch() *Batch {
+	return newBatch(c)
+}
+
 // WithRate clones this client with a new sample rate.
 func (c *RecorderClient) WithRate(rate float64) Client {
 	return &RecorderClient{
-		callInfo: c.callInfo,
-		test:     c.test,
-		rate:     rate,
-		tagMap:   c.tagMap,
+		callInfo:  c.callInfo,
+		test:      c.test,
+		rate:      clampRate(rate),
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
 	}
 }
 
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *RecorderClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *RecorderClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
 // WithTest returns a recorder client linked with a given test instance.
 func (c *RecorderClient) WithTest(test TestFailer) *RecorderClient {
 	return &RecorderClient{
-		callInfo: c.callInfo,
-		test:     test,
-		rate:     c.rate,
-		tagMap:   c.tagMap,
+		callInfo:  c.callInfo,
+		test:      test,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		prefix:    c.prefix,
+		timestamp: c.timestamp,
 	}
 }
 
 // logCall will record a single metrics call.
-func (c *RecorderClient) logCall(name string, value interface{}) {
+func (c *RecorderClient) logCall(t string, name string, value interface{}) {
+	c.logCallAt(t, name, value, time.Time{})
+}
+
+// logCallAt records a metric call with an explicit timestamp.
+func (c *RecorderClient) logCallAt(t string, name string, value interface{}, timestamp time.Time) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
 	tagMapCopy := make(map[string]string, len(c.tagMap))
 	for k, v := range c.tagMap {
 		tagMapCopy[k] = v
@@ -191,13 +366,20 @@ func (c *RecorderClient) logCall(name string, value interface{}) {
 	c.callInfo.RWMutex.Lock()
 	defer c.callInfo.RWMutex.Unlock()
 	c.callInfo.Calls = append(c.callInfo.Calls, &MetricCall{
-		Name:   name,
-		Value:  toFloat64(value),
-		Rate:   c.rate,
-		TagMap: tagMapCopy,
+		Type:      t,
+		Name:      c.prefix + name,
+		Value:     toFloat64(value),
+		Rate:      c.rate,
+		TagMap:    tagMapCopy,
+		Timestamp: timestamp,
 	})
 }
 
+// Flush on the RecorderClient is a no-op
+func (c *RecorderClient) Flush() error {
+	return nil
+}
+
 // Close on the RecorderClient is a no-op
 func (c *RecorderClient) Close() error {
 	return nil
@@ -208,7 +390,7 @@ func (c *RecorderClient) Count(name string, value int64) {
 	// Normally this would be stored as an integer, but instead we assert that
 	// it can be cast to an int, cast it, and then store it as a float so that
 	// assertions below are simpler.
-	c.logCall(name, value)
+	c.logCallAt("count", name, value, c.timestamp)
 }
 
 // Incr adds one to a metric.
@@ -221,14 +403,67 @@ func (c *RecorderClient) Decr(name string) {
 	c.Count(name, -1)
 }
 
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *RecorderClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric. It is recorded as a
+// `count` call like `Count`.
+func (c *RecorderClient) CountFloat(name string, value float64) {
+	c.logCallAt("count", name, value, c.timestamp)
+}
+
 // Gauge sets a numeric value.
 func (c *RecorderClient) Gauge(name string, value float64) {
-	c.logCall(name, value)
+	c.logCallAt("gauge", name, value, c.timestamp)
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *RecorderClient) GaugeInt(name string, value int64) {
+	c.logCallAt("gauge", name, value, c.timestamp)
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time. It is recorded
+// as a `gauge` call with the timestamp set.
+func (c *RecorderClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.logCallAt("gauge", name, value, timestamp)
+}
+
+// GaugeDelta adjusts a gauge by a signed amount.
+func (c *RecorderClient) GaugeDelta(name string, delta float64) {
+	c.logCall("gaugedelta", name, delta)
+}
+
+// Set counts the number of unique values for a metric.
+func (c *RecorderClient) Set(name string, value string) {
+	if suppressed() {
+		return
+	}
+	if c.rate <= 0 {
+		return
+	}
+	tagMapCopy := make(map[string]string, len(c.tagMap))
+	for k, v := range c.tagMap {
+		tagMapCopy[k] = v
+	}
+	c.callInfo.RWMutex.Lock()
+	defer c.callInfo.RWMutex.Unlock()
+	c.callInfo.Calls = append(c.callInfo.Calls, &SetCall{
+		Name:   c.prefix + name,
+		Value:  value,
+		Rate:   c.rate,
+		TagMap: tagMapCopy,
+	})
 }
 
 // Event tracks an event that may be relevant to other metrics.
 func (c *RecorderClient) Event(e *statsd.Event) {
-	var tagMapCopy map[string]string
+	if suppressed() {
+		return
+	}
+	tagMapCopy := make(map[string]string, len(c.tagMap))
 	for k, v := range c.tagMap {
 		tagMapCopy[k] = v
 	}
@@ -240,22 +475,68 @@ func (c *RecorderClient) Event(e *statsd.Event) {
 	})
 }
 
+// ServiceCheck reports the status of a service.
+func (c *RecorderClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	if suppressed() {
+		return
+	}
+	tagMapCopy := make(map[string]string, len(c.tagMap))
+	for k, v := range c.tagMap {
+		tagMapCopy[k] = v
+	}
+	c.callInfo.RWMutex.Lock()
+	defer c.callInfo.RWMutex.Unlock()
+	c.callInfo.Calls = append(c.callInfo.Calls, &ServiceCheckCall{
+		Check:  sc,
+		TagMap: tagMapCopy,
+	})
+}
+
 // Timing tracks a duration.
 func (c *RecorderClient) Timing(name string, value time.Duration) {
-	c.logCall(name, value)
+	c.logCall("timing", name, value)
+}
+
+// TimingMs tracks a duration given in milliseconds. It is recorded just like
+// a call to `Timing`.
+func (c *RecorderClient) TimingMs(name string, ms float64) {
+	c.Timing(name, fromMilliseconds(ms))
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *RecorderClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *RecorderClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *RecorderClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock set via `WithClock`, or `time.Now`.
+func (c *RecorderClient) clock() func() time.Time {
+	return c.callInfo.now
 }
 
 // Histogram sets a numeric value while tracking min/max/avg/p95/etc.
 func (c *RecorderClient) Histogram(name string, value float64) {
-	c.logCall(name, value)
+	c.logCall("histogram", name, value)
 }
 
 // Distribution tracks the statistical distribution of a set of values.
 func (c *RecorderClient) Distribution(name string, value float64) {
-	c.logCall(name, value)
+	c.logCallAt("distribution", name, value, c.timestamp)
 }
 
 // Reset will clear the call info context, which is useful between test runs.
+// The call info is shared by this client and all clients derived from it via
+// `WithTags`, `WithRate`, etc., so their recorded calls are cleared as well.
+// Those clients keep working and record new calls into the same context.
 func (c *RecorderClient) Reset() {
 	c.callInfo.RWMutex.Lock()
 	defer c.callInfo.RWMutex.Unlock()
@@ -314,6 +595,51 @@ func (c *RecorderClient) GetCalls() []Call {
 	return c.callInfo.Calls
 }
 
+// Counts returns the values of all recorded count calls (including `Incr` and
+// `Decr`) with the given metric name, in the order they were made.
+func (c *RecorderClient) Counts(name string) []int64 {
+	c.callInfo.RWMutex.RLock()
+	defer c.callInfo.RWMutex.RUnlock()
+	var counts []int64
+	for _, call := range c.callInfo.Calls {
+		if m, ok := call.(*MetricCall); ok && m.Type == "count" && m.Name == name {
+			counts = append(counts, int64(m.Value))
+		}
+	}
+	return counts
+}
+
+// CallCount returns the number of recorded calls for a metric name, event
+// title, or service check name.
+func (c *RecorderClient) CallCount(name string) int {
+	return len(c.If(name).GetCalls())
+}
+
+// AssertCount asserts that the recorded count calls (including `Incr` and
+// `Decr`) for a metric name add up to the expected total, failing `t`
+// otherwise.
+//
+//   recorder.Incr("requests.count")
+//   recorder.Count("requests.count", 2)
+//   recorder.AssertCount(t, "requests.count", 3)
+func (c *RecorderClient) AssertCount(t TestFailer, name string, expected int64) {
+	var total int64
+	for _, count := range c.Counts(name) {
+		total += count
+	}
+	if total != expected {
+		c.WithTest(t).Fatalf("Expected count '%s' to total %d but found %d.", name, expected, total)
+	}
+}
+
+// AssertTagged asserts that at least one call for a metric name, event
+// title, or service check name was made with the given tag, failing `t`
+// otherwise. Tags are checked as they would be emitted, i.e. including all
+// tags merged via `WithTags`.
+func (c *RecorderClient) AssertTagged(t TestFailer, name, key, value string) {
+	c.WithTest(t).Expect(name).Tag(key, value)
+}
+
 // ExpectEmpty asserts that no metrics have been emitted.
 func (c *RecorderClient) ExpectEmpty() {
 	c.callInfo.RWMutex.RLock()
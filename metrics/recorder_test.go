@@ -7,7 +7,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/DataDog/datadog-go/statsd"
+	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/istreamlabs/go-metrics/metrics"
 )
 
@@ -86,6 +86,19 @@ func ExampleMetricCall() {
 	// Output: 'requests.count' value is '1'
 }
 
+func ExampleRecorderClient_Counts() {
+	recorder := metrics.NewRecorderClient()
+	recorder.WithTags(map[string]string{
+		"status": "200",
+	}).Incr("requests.count")
+
+	// Check that the counter was incremented exactly once with the tag.
+	counts := recorder.Counts("requests.count")
+	call := recorder.GetCalls()[0].(*metrics.MetricCall)
+	fmt.Println(counts, call.Type, call.TagMap["status"])
+	// Output: [1] count 200
+}
+
 func TestRecorderClient(t *testing.T) {
 	var client metrics.Client
 	client = metrics.NewRecorderClient().WithTest(t)
@@ -141,6 +154,7 @@ func TestRecorderClient(t *testing.T) {
 		t.Fatal("Expected a length of zero after reset")
 	}
 
+	client.Flush()
 	client.Close()
 
 	recorder.Incr("one")
@@ -151,6 +165,57 @@ func TestRecorderClient(t *testing.T) {
 	}
 }
 
+func TestRecorderCounts(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	recorder.Incr("foo")
+	recorder.WithRate(0.5).Count("foo", 5)
+	recorder.Decr("foo")
+	recorder.Gauge("foo", 10)
+	recorder.Incr("bar")
+
+	ExpectEqual(t, []int64{1, 5, -1}, recorder.Counts("foo"))
+	ExpectEqual(t, []int64{1}, recorder.Counts("bar"))
+	ExpectEqual(t, []int64(nil), recorder.Counts("baz"))
+
+	types := []string{}
+	for _, call := range recorder.Expect("foo").GetCalls() {
+		types = append(types, call.(*metrics.MetricCall).Type)
+	}
+	ExpectEqual(t, []string{"count", "count", "count", "gauge"}, types)
+}
+
+func TestRecorderSet(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	recorder.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Set("users", "alice")
+	recorder.Set("users", "bob")
+
+	recorder.Expect("users").Value("alice").Tag("tag1", "value1")
+	recorder.Expect("users").Value("bob")
+	recorder.Expect("users").MinTimes(2)
+	recorder.ExpectContains("users:bob[]")
+	recorder.If("users").Value("carol").Reject()
+}
+
+func TestRecorderServiceCheck(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	recorder.WithTags(map[string]string{
+		"tag1": "value1",
+	}).ServiceCheck(&statsd.ServiceCheck{
+		Name:    "db",
+		Status:  statsd.Warn,
+		Message: "slow queries",
+	})
+
+	recorder.Expect("db").Text("slow queries").Tag("tag1", "value1")
+	recorder.ExpectContains("db:WARNING:slow queries[tag1:value1]")
+	recorder.If("db").Text("all good").Reject()
+}
+
 func TestRecorderAssertionNameFails(t *testing.T) {
 	ExpectFailure(t, "Expecting wrong name should fail test",
 		func(recorder *metrics.RecorderClient) {
@@ -298,3 +363,241 @@ func TestRecorderWithRate(t *testing.T) {
 	recorder.If("sampled").Rate(1.0).Reject()
 	recorder.Expect("sampled").Rate(0.1)
 }
+
+func TestRecorderWithPrefix(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	recorder.WithPrefix("a.").WithPrefix("b.").Incr("one")
+	recorder.WithPrefix("").Set("two", "value")
+	recorder.WithPrefix("a.").WithTags(map[string]string{
+		"tag1": "value1",
+	}).Gauge("three", 3)
+
+	recorder.Expect("a.b.one").Value(1)
+	recorder.Expect("two").Value("value")
+	recorder.Expect("a.three").Tag("tag1", "value1")
+	recorder.If("one").Reject()
+}
+
+func TestRecorderWithTag(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	recorder.WithTags(map[string]string{
+		"tag1": "value1",
+	}).WithTag("tag2", "value2").Incr("one")
+
+	recorder.Expect("one").Tag("tag1", "value1").Tag("tag2", "value2")
+}
+
+func TestRecorderWithRateClamp(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	recorder.WithRate(2.0).Incr("high")
+	recorder.WithRate(-1).Incr("negative")
+	recorder.WithRate(0).Set("zero", "value")
+
+	ExpectEqual(t, 1, recorder.Length())
+	recorder.Expect("high").Rate(1.0)
+	recorder.If("negative").Reject()
+	recorder.If("zero").Reject()
+}
+
+func TestRecorderTagIsolation(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	tags := map[string]string{"parent": "value"}
+	parent := recorder.WithTags(tags).WithRate(0.5)
+
+	// Modifying the input map after the fact must not affect the client.
+	tags["parent"] = "modified"
+	tags["extra"] = "value"
+
+	first := parent.WithTags(map[string]string{"child": "first"})
+	second := parent.WithTags(map[string]string{"child": "second"})
+	first.WithTag("parent", "override").Incr("first")
+	second.Incr("second")
+	parent.Incr("parent")
+	parent.Event(statsd.NewEvent("event", "desc"))
+
+	ExpectEqual(t, "first:1(0.5)[child:first parent:override]", recorder.GetCalls()[0].String())
+	ExpectEqual(t, "second:1(0.5)[child:second parent:value]", recorder.GetCalls()[1].String())
+	ExpectEqual(t, "parent:1(0.5)[parent:value]", recorder.GetCalls()[2].String())
+	ExpectEqual(t, "event:desc[parent:value]", recorder.GetCalls()[3].String())
+}
+
+func TestRecorderGaugeInt(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	recorder.GaugeInt("queue.depth", 42)
+
+	recorder.Expect("queue.depth").Value(42)
+	ExpectEqual(t, "gauge", recorder.GetCalls()[0].(*metrics.MetricCall).Type)
+}
+
+func TestRecorderWithoutTags(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	parent := recorder.WithTags(map[string]string{
+		"user_id": "123",
+		"tag1":    "value1",
+	})
+
+	stripped := parent.WithoutTags("user_id", "missing")
+	stripped.Incr("stripped")
+	stripped.WithTag("user_id", "456").Incr("readded")
+	parent.Incr("parent")
+
+	ExpectEqual(t, "stripped:1[tag1:value1]", recorder.GetCalls()[0].String())
+	ExpectEqual(t, "readded:1[tag1:value1 user_id:456]", recorder.GetCalls()[1].String())
+	ExpectEqual(t, "parent:1[tag1:value1 user_id:123]", recorder.GetCalls()[2].String())
+}
+
+func TestRecorderCountWithRate(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	client := recorder.WithRate(0.5)
+
+	client.CountWithRate("once", 1, 0.1)
+	client.Incr("default")
+
+	recorder.Expect("once").Rate(0.1)
+	recorder.Expect("default").Rate(0.5)
+}
+
+func TestRecorderTimingMs(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	recorder.TimingMs("latency", 1.5)
+
+	recorder.Expect("latency").Value(1500 * time.Microsecond)
+	ExpectEqual(t, "timing", recorder.GetCalls()[0].(*metrics.MetricCall).Type)
+}
+
+func TestRecorderClock(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := metrics.NewRecorderClient(metrics.WithClock(func() time.Time {
+		return now
+	})).WithTest(t)
+
+	timer := recorder.WithTag("tag1", "value1").NewTimer("latency")
+	now = now.Add(1500 * time.Millisecond)
+	timer.Stop()
+
+	start := now
+	now = now.Add(250 * time.Millisecond)
+	recorder.TimingSince("since", start)
+
+	// Wrappers use the clock of the client they wrap.
+	now = now.Add(time.Second)
+	metrics.NewFilterClient(recorder, nil, nil).TimingSince("filtered", start)
+	metrics.NewMultiClient(recorder, metrics.NewNullClient()).TimingSince("multi", start)
+
+	recorder.Expect("latency").Tag("tag1", "value1").Value(1500 * time.Millisecond)
+	recorder.Expect("since").Value(250 * time.Millisecond)
+	recorder.Expect("filtered").Value(1250 * time.Millisecond)
+	recorder.Expect("multi").Value(1250 * time.Millisecond)
+}
+
+func TestRecorderCountFloat(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	recorder.CountFloat("work", 0.25)
+
+	recorder.Expect("work").Value(0.25)
+	ExpectEqual(t, "count", recorder.GetCalls()[0].(*metrics.MetricCall).Type)
+}
+
+func TestRecorderAlways(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	sampled := recorder.WithTag("tag1", "value1").WithRate(0).WithPrefix("app.")
+
+	sampled.Incr("dropped")
+	sampled.Always().Incr("errors")
+
+	ExpectEqual(t, 0, recorder.CallCount("app.dropped"))
+	recorder.Expect("app.errors").Value(1).Rate(1.0).Tag("tag1", "value1")
+}
+
+func TestRecorderGaugeWithTimestamp(t *testing.T) {
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	recorder.GaugeWithTimestamp("backfill", 5, timestamp)
+	recorder.Gauge("current", 1)
+
+	recorder.Expect("backfill").Value(5)
+	ExpectEqual(t, timestamp, recorder.GetCalls()[0].(*metrics.MetricCall).Timestamp)
+	ExpectEqual(t, true, recorder.GetCalls()[1].(*metrics.MetricCall).Timestamp.IsZero())
+}
+
+func TestRecorderWithTimestamp(t *testing.T) {
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	stamped := recorder.WithTimestamp(timestamp).WithTag("tag1", "value1").WithPrefix("app.")
+	stamped.Incr("processed")
+	stamped.GaugeInt("pending", 2)
+	stamped.Histogram("size", 3)
+
+	recorder.Expect("app.processed").Value(1).Tag("tag1", "value1")
+	calls := recorder.GetCalls()
+	ExpectEqual(t, timestamp, calls[0].(*metrics.MetricCall).Timestamp)
+	ExpectEqual(t, timestamp, calls[1].(*metrics.MetricCall).Timestamp)
+	ExpectEqual(t, true, calls[2].(*metrics.MetricCall).Timestamp.IsZero())
+}
+
+func TestRecorderClone(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+	parent := recorder.WithTag("tag1", "value1").WithRate(0.5).WithPrefix("app.")
+
+	clone := parent.Clone()
+	ExpectEqual(t, parent.Tags(), clone.Tags())
+
+	clone.WithTag("tag1", "changed").WithTag("tag2", "value2").Incr("clone")
+	clone.Incr("same")
+	parent.Incr("parent")
+
+	recorder.Expect("app.clone").Tag("tag1", "changed").Tag("tag2", "value2").Rate(0.5)
+	ExpectEqual(t, "app.same:1(0.5)[tag1:value1]", recorder.GetCalls()[1].String())
+	ExpectEqual(t, "app.parent:1(0.5)[tag1:value1]", recorder.GetCalls()[2].String())
+	ExpectEqual(t, map[string]string{"tag1": "value1"}, parent.Tags())
+}
+
+func TestRecorderResetChildren(t *testing.T) {
+	recorder := metrics.NewRecorderClient()
+	child := recorder.WithTag("tag1", "value1")
+
+	child.Incr("before")
+	recorder.Reset()
+	ExpectEqual(t, 0, recorder.Length())
+
+	child.Incr("after")
+	ExpectEqual(t, "after:1[tag1:value1]", recorder.GetCalls()[0].String())
+}
+
+func TestRecorderAssertions(t *testing.T) {
+	recorder := metrics.NewRecorderClient()
+	tagged := recorder.WithTag("tag1", "value1").WithTags(map[string]string{
+		"tag2": "value2",
+	})
+
+	tagged.Incr("requests.count")
+	tagged.Count("requests.count", 5)
+	recorder.Decr("requests.count")
+	recorder.Gauge("memory", 1024)
+	recorder.Event(statsd.NewEvent("deploy", "desc"))
+
+	ExpectEqual(t, 3, recorder.CallCount("requests.count"))
+	ExpectEqual(t, 1, recorder.CallCount("memory"))
+	ExpectEqual(t, 1, recorder.CallCount("deploy"))
+	ExpectEqual(t, 0, recorder.CallCount("missing"))
+
+	recorder.AssertCount(t, "requests.count", 5)
+	recorder.AssertCount(t, "missing", 0)
+	recorder.AssertTagged(t, "requests.count", "tag1", "value1")
+	recorder.AssertTagged(t, "requests.count", "tag2", "value2")
+
+	ExpectFailure(t, "Asserting the wrong count should fail test",
+		func(recorder *metrics.RecorderClient) {
+			recorder.Incr("one")
+			recorder.AssertCount(&fakeTest{}, "one", 2)
+		})
+
+	ExpectFailure(t, "Asserting a missing tag should fail test",
+		func(recorder *metrics.RecorderClient) {
+			recorder.WithTag("tag1", "value1").Incr("one")
+			recorder.AssertTagged(&fakeTest{}, "one", "tag1", "other")
+		})
+}
@@ -0,0 +1,445 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// SlogClient emits each metric as a structured log record using the standard
+// `log/slog` package, which makes metric logs machine-parseable when used
+// with e.g. a JSON handler. Each record has the message `metric` and the
+// attributes `type`, `metric`, `value`, `rate` (only when sampled) and a
+// `tags` group with one attribute per tag, which is omitted when there are
+// no tags:
+//
+//   {"level":"INFO","msg":"metric","type":"count","metric":"requests.count","value":1,"tags":{"tag":"value"}}
+//
+// Counts and integer gauges have integer values, timings are floating point
+// milliseconds like in every other client, and all other metrics have
+// floating point values. Events and service checks are logged with the
+// messages `event` and `service_check` respectively.
+type SlogClient struct {
+	logger    *slog.Logger
+	rate      float64
+	tagMap    map[string]string
+	prefix    string
+	random    func() float64
+	rates     map[string]float64
+	minRates  map[string]float64
+	redact    func(key, value string) string
+	clashes   bool
+	names     nameMode
+	limiter   *cardinalityLimiter
+	reserved  reservedMode
+	negative  bool
+	warnings  *warnThrottle
+	typeTags  map[string]map[string]string
+	hashed    bool
+	now       func() time.Time
+	timestamp time.Time
+}
+
+// NewSlogClient creates a new structured logging client. If `logger` is `nil`
+// then `slog.Default()` is used.
+func NewSlogClient(logger *slog.Logger, options ...Option) *SlogClient {
+	o, err := resolveOptions(options)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	limiter := newCardinalityLimiter(o.TagLimit, o.TagOverflow)
+	warnings := newWarnThrottle(o.WarningInterval)
+	return &SlogClient{
+		logger:   logger,
+		rate:     o.Rate,
+		tagMap:   combine(nil, limiter.limitTags(o.Reserved.checkTags(o.Names.sanitizeTags(redactTags(o.TagRedactor, o.Tags)), warnings))),
+		prefix:   o.Prefix,
+		random:   o.Random,
+		rates:    o.MetricRates,
+		minRates: o.MinRates,
+		redact:   o.TagRedactor,
+		clashes:  o.TagCollisions,
+		names:    o.Names,
+		limiter:  limiter,
+		reserved: o.Reserved,
+		negative: o.NegativeChecks,
+		warnings: warnings,
+		typeTags: o.TypeTags,
+		now:      o.Clock,
+		hashed:   o.HashSampling,
+	}
+}
+
+// clone returns a shallow copy of this client. Tag maps are never modified
+// once a client has been created, so they are safe to share.
+func (c *SlogClient) clone() *SlogClient {
+	clone := *c
+	return &clone
+}
+
+// dropNegative logs and drops negative values when negative value checks
+// are enabled.
+func (c *SlogClient) dropNegative(kind string, name string, value float64) bool {
+	if err := checkNegative(c.negative, kind, c.prefix+name, value); err != nil {
+		c.warnings.warnf("%v", err)
+		return true
+	}
+	return false
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *SlogClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	clone := c.clone()
+	added := c.limiter.limitTags(c.reserved.checkTags(c.names.sanitizeTags(redactTags(c.redact, tags)), c.warnings))
+	warnCollisions(c.clashes, c.tagMap, added, c.warnings)
+	clone.tagMap = combine(c.tagMap, added)
+	return clone
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *SlogClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *SlogClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *SlogClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *SlogClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *SlogClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *SlogClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *SlogClient) WithoutTags(keys ...string) Client {
+	clone := c.clone()
+	clone.tagMap = without(c.tagMap, keys)
+	return clone
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *SlogClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions, which is logged as the `timestamp` attribute
+// just like `GaugeWithTimestamp`.
+func (c *SlogClient) WithTimestamp(timestamp time.Time) Client {
+	clone := c.clone()
+	clone.timestamp = timestamp
+	return clone
+}
+
+// stamp returns the `timestamp` attribute for calls made after
+// `WithTimestamp`, if any.
+func (c *SlogClient) stamp() []slog.Attr {
+	if c.timestamp.IsZero() {
+		return nil
+	}
+	return []slog.Attr{slog.Time("timestamp", c.timestamp)}
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *SlogClient) WithPrefix(prefix string) Client {
+	clone := c.clone()
+	clone.prefix = c.prefix + prefix
+	return clone
+}
+
+// Clone returns an independent copy of this client.
+func (c *SlogClient) Clone() Client {
+	clone := c.clone()
+	clone.tagMap = combine(nil, c.tagMap)
+	return clone
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *SlogClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// WithRate clones this client with a given sample rate. Subsequent calls
+// will be limited to logging metrics at this rate.
+func (c *SlogClient) WithRate(rate float64) Client {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	return clone
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *SlogClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0 and any
+// per-metric rates set via `WithMetricRate` removed, so that critical metrics
+// are always emitted. Tags and prefix are preserved.
+func (c *SlogClient) Always() Client {
+	clone := c.clone()
+	clone.rate = 1.0
+	clone.rates = nil
+	return clone
+}
+
+// sampledSeries returns whether a metric should be logged at the given rate,
+// which is decided by a hash of its name and tags with `WithHashSampling`.
+func (c *SlogClient) sampledSeries(rate float64, name string) bool {
+	if c.hashed {
+		return hashSampled(rate, c.prefix+name, c.tagMap)
+	}
+	return c.sampled(rate)
+}
+
+// sampled returns whether the next call should be logged at the given rate.
+func (c *SlogClient) sampled(rate float64) bool {
+	return rate >= 1.0 || c.random() < rate
+}
+
+// ShouldSample returns whether a call at this client's current rate would be
+// emitted, so that expensive tag values can be computed only when needed:
+//
+//   if client.ShouldSample() {
+//     client.Always().WithTag("plan", expensivePlanLookup()).Incr("requests")
+//   }
+//
+// It consumes a sample decision from the client's random source, e.g. one
+// value of a `WithRandSource` sequence. Since the guarded call would be
+// sampled again, emit it via `Always()` as above. Per-metric rates set via
+// `WithMetricRate` are not considered.
+func (c *SlogClient) ShouldSample() bool {
+	return c.sampled(c.rate)
+}
+
+// tagAttr returns a group attribute with one attribute per tag, sorted by
+// tag name.
+func (c *SlogClient) tagAttr(tagMap map[string]string) slog.Attr {
+	keys := make([]string, 0, len(tagMap))
+	for k := range tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, slog.String(k, tagMap[k]))
+	}
+	return slog.Group("tags", attrs...)
+}
+
+// log writes a single metric record, taking into account sample rate.
+func (c *SlogClient) log(t string, name string, value slog.Value, extra ...slog.Attr) {
+	if suppressed() {
+		return
+	}
+	rate := metricRate(c.rates, c.minRates, name, c.rate)
+	if t == "gaugedelta" && rate > 0 {
+		rate = 1.0
+	}
+	if !c.sampledSeries(rate, name) {
+		return
+	}
+
+	name, ok := c.names.check(c.prefix+name, c.Tags, c.warnings)
+	if !ok {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("type", t),
+		slog.String("metric", name),
+		{Key: "value", Value: value},
+	}
+	attrs = append(attrs, extra...)
+	if rate < 1.0 {
+		attrs = append(attrs, slog.Float64("rate", rate))
+	}
+	attrs = append(attrs, c.tagAttr(typeTagMap(c.typeTags, t, c.tagMap)))
+
+	c.logger.LogAttrs(context.Background(), slog.LevelInfo, "metric", attrs...)
+}
+
+// Flush on SlogClient is a no-op
+func (c *SlogClient) Flush() error {
+	return nil
+}
+
+// Close on SlogClient is a no-op
+func (c *SlogClient) Close() error {
+	return nil
+}
+
+// Count adds some value to a metric.
+func (c *SlogClient) Count(name string, value int64) {
+	c.log("count", name, slog.Int64Value(value), c.stamp()...)
+}
+
+// Incr adds one to a metric.
+func (c *SlogClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *SlogClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call. Per-metric rates set via `WithMetricRate` do not apply.
+func (c *SlogClient) CountWithRate(name string, value int64, rate float64) {
+	clone := c.clone()
+	clone.rate = clampRate(rate)
+	clone.rates = nil
+	clone.Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *SlogClient) CountFloat(name string, value float64) {
+	c.log("count", name, slog.Float64Value(value), c.stamp()...)
+}
+
+// Gauge sets a numeric value.
+func (c *SlogClient) Gauge(name string, value float64) {
+	c.log("gauge", name, slog.Float64Value(value), c.stamp()...)
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *SlogClient) GaugeInt(name string, value int64) {
+	c.log("gauge", name, slog.Int64Value(value), c.stamp()...)
+}
+
+// GaugeWithTimestamp sets a numeric value at a given time, which is logged
+// as the `timestamp` attribute.
+func (c *SlogClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	c.log("gauge", name, slog.Float64Value(value), slog.Time("timestamp", timestamp))
+}
+
+// GaugeDelta adjusts a gauge by a signed amount. Deltas are never sampled,
+// since a dropped delta would leave the gauge wrong, so the client's rate is
+// ignored unless it is zero.
+func (c *SlogClient) GaugeDelta(name string, delta float64) {
+	c.log("gaugedelta", name, slog.Float64Value(delta))
+}
+
+// Set counts the number of unique values for a metric.
+func (c *SlogClient) Set(name string, value string) {
+	c.log("set", name, slog.StringValue(value))
+}
+
+// Event tracks an event that may be relevant to other metrics. Events are
+// sampled at the client's rate just like metrics. The event's own tags are
+// merged with the client tags, overriding any with the same key.
+func (c *SlogClient) Event(e *statsd.Event) {
+	if suppressed() {
+		return
+	}
+	if !c.sampled(c.rate) {
+		return
+	}
+	c.logger.LogAttrs(context.Background(), slog.LevelInfo, "event",
+		slog.String("title", e.Title),
+		slog.String("text", e.Text),
+		c.tagAttr(combine(c.tagMap, stringsToMap(e.Tags))),
+	)
+}
+
+// ServiceCheck reports the status of a service. The check's own tags are
+// merged with the client tags, overriding any with the same key.
+func (c *SlogClient) ServiceCheck(sc *statsd.ServiceCheck) {
+	if suppressed() {
+		return
+	}
+	c.logger.LogAttrs(context.Background(), slog.LevelInfo, "service_check",
+		slog.String("name", sc.Name),
+		slog.String("status", serviceCheckStatus(sc.Status)),
+		slog.String("message", sc.Message),
+		c.tagAttr(combine(c.tagMap, stringsToMap(sc.Tags))),
+	)
+}
+
+// Timing tracks a duration.
+func (c *SlogClient) Timing(name string, value time.Duration) {
+	c.TimingMs(name, float64(value)/float64(time.Millisecond))
+}
+
+// TimingMs tracks a duration given in milliseconds. It is logged just like
+// a call to `Timing`.
+func (c *SlogClient) TimingMs(name string, ms float64) {
+	if c.dropNegative("timing", name, ms) {
+		return
+	}
+	c.log("timing", name, slog.Float64Value(ms))
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *SlogClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *SlogClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *SlogClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, c.clock()().Sub(start))
+}
+
+// clock returns the clock set via `WithClock`, or `time.Now`.
+func (c *SlogClient) clock() func() time.Time {
+	if c.now == nil {
+		return time.Now
+	}
+	return c.now
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *SlogClient) Histogram(name string, value float64) {
+	if c.dropNegative("histogram", name, value) {
+		return
+	}
+	c.log("histogram", name, slog.Float64Value(value))
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *SlogClient) Distribution(name string, value float64) {
+	if c.dropNegative("distribution", name, value) {
+		return
+	}
+	c.log("distribution", name, slog.Float64Value(value), c.stamp()...)
+}
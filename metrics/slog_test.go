@@ -0,0 +1,161 @@
+package metrics_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// slogRecords parses each line of JSON handler output into a map.
+func slogRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected valid JSON. Found '%v' for '%s'", err, line)
+		}
+		delete(record, "time")
+		records = append(records, record)
+	}
+	return records
+}
+
+func ExampleSlogClient() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	client := metrics.NewSlogClient(logger)
+	client.WithTags(map[string]string{
+		"tag1": "value1",
+	}).Incr("requests.count")
+}
+
+func TestSlogClient(t *testing.T) {
+	var buf bytes.Buffer
+	var client metrics.Client
+	client = metrics.NewSlogClient(slog.New(slog.NewJSONHandler(&buf, nil)),
+		metrics.WithRandSource(func() float64 { return 0.1 }),
+	)
+
+	client.WithTag("tag1", "value1").Incr("one")
+	client.Gauge("memory", 1.5)
+	client.GaugeInt("connections", 3)
+	client.Set("users", "alice")
+	client.WithRate(0.5).Timing("timing", time.Second)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.WithRate(0).Incr("never")
+	client.Flush()
+	client.Close()
+
+	ExpectEqual(t, []map[string]interface{}{
+		{"level": "INFO", "msg": "metric", "type": "count", "metric": "one", "value": 1.0, "tags": map[string]interface{}{"tag1": "value1"}},
+		{"level": "INFO", "msg": "metric", "type": "gauge", "metric": "memory", "value": 1.5},
+		{"level": "INFO", "msg": "metric", "type": "gauge", "metric": "connections", "value": 3.0},
+		{"level": "INFO", "msg": "metric", "type": "set", "metric": "users", "value": "alice"},
+		{"level": "INFO", "msg": "metric", "type": "timing", "metric": "timing", "value": 1000.0, "rate": 0.5},
+		{"level": "INFO", "msg": "event", "title": "title", "text": "desc"},
+		{"level": "INFO", "msg": "service_check", "name": "check", "status": "OK", "message": ""},
+	}, slogRecords(t, &buf))
+}
+
+func TestSlogClientEventTags(t *testing.T) {
+	var buf bytes.Buffer
+	client := metrics.NewSlogClient(slog.New(slog.NewJSONHandler(&buf, nil))).WithTag("tag1", "value1")
+
+	e := statsd.NewEvent("title", "desc")
+	e.Tags = []string{"tag1:override", "event:tag"}
+	client.Event(e)
+	sc := statsd.NewServiceCheck("check", statsd.Ok)
+	sc.Tags = []string{"check:tag"}
+	client.ServiceCheck(sc)
+
+	ExpectEqual(t, []map[string]interface{}{
+		{"level": "INFO", "msg": "event", "title": "title", "text": "desc", "tags": map[string]interface{}{"event": "tag", "tag1": "override"}},
+		{"level": "INFO", "msg": "service_check", "name": "check", "status": "OK", "message": "", "tags": map[string]interface{}{"check": "tag", "tag1": "value1"}},
+	}, slogRecords(t, &buf))
+}
+
+func TestSlogClientValueTypes(t *testing.T) {
+	kinds := []slog.Kind{}
+	handler := slog.NewJSONHandler(&bytes.Buffer{}, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "value" {
+				kinds = append(kinds, a.Value.Kind())
+			}
+			return a
+		},
+	})
+	client := metrics.NewSlogClient(slog.New(handler))
+
+	client.Count("count", 2)
+	client.GaugeInt("gauge.int", 2)
+	client.Gauge("gauge", 2)
+	client.Histogram("histo", 2)
+	client.Timing("timing", time.Second)
+
+	ExpectEqual(t, []slog.Kind{
+		slog.KindInt64,
+		slog.KindInt64,
+		slog.KindFloat64,
+		slog.KindFloat64,
+		slog.KindFloat64,
+	}, kinds)
+}
+
+func TestSlogClientMetricRate(t *testing.T) {
+	var buf bytes.Buffer
+	client := metrics.NewSlogClient(slog.New(slog.NewJSONHandler(&buf, nil)),
+		metrics.WithRandSource(func() float64 { return 0.5 }),
+		metrics.WithMetricRate("request.bytes", 0.1),
+	)
+
+	client.Count("request.bytes", 100)
+	client.Incr("other")
+
+	records := slogRecords(t, &buf)
+	ExpectEqual(t, 1, len(records))
+	ExpectEqual(t, "other", records[0]["metric"])
+}
+
+func TestSlogClientGaugeWithTimestamp(t *testing.T) {
+	var buf bytes.Buffer
+	client := metrics.NewSlogClient(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	client.GaugeWithTimestamp("backfill", 5, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	records := slogRecords(t, &buf)
+	ExpectEqual(t, 1, len(records))
+	ExpectEqual(t, 5.0, records[0]["value"])
+	ExpectEqual(t, "2020-01-02T03:04:05Z", records[0]["timestamp"])
+}
+
+func TestSlogClientWithTimestamp(t *testing.T) {
+	var buf bytes.Buffer
+	client := metrics.NewSlogClient(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	client.WithTimestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)).Count("backfill", 5)
+	client.Count("current", 1)
+
+	records := slogRecords(t, &buf)
+	ExpectEqual(t, 2, len(records))
+	ExpectEqual(t, "2020-01-02T03:04:05Z", records[0]["timestamp"])
+	ExpectEqual(t, nil, records[1]["timestamp"])
+}
+
+func TestSlogClientShouldSample(t *testing.T) {
+	client := metrics.NewSlogClient(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil)),
+		metrics.WithRandSource(sequence(0.05, 0.5)),
+		metrics.WithInitialRate(0.1),
+	)
+
+	ExpectEqual(t, true, client.ShouldSample())
+	ExpectEqual(t, false, client.ShouldSample())
+	ExpectEqual(t, false, client.WithRate(0).(*metrics.SlogClient).ShouldSample())
+}
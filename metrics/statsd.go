@@ -0,0 +1,434 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// statsdMaxPacketSize is the maximum number of bytes sent in a single UDP
+// packet, chosen to fit within a typical network MTU.
+const statsdMaxPacketSize = 1432
+
+// statsdConn buffers metric lines and writes them to the connection either
+// when the buffer is full or on the flush interval. It is shared by a statsd
+// client and all of its clones.
+type statsdConn struct {
+	mutex  sync.Mutex
+	conn   net.Conn
+	buffer bytes.Buffer
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// write adds a line to the buffer, flushing first if the line would not fit.
+func (s *statsdConn) write(line string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.buffer.Len() > 0 && s.buffer.Len()+len(line)+1 > statsdMaxPacketSize {
+		s.flush()
+	}
+	if s.buffer.Len() > 0 {
+		s.buffer.WriteByte('\n')
+	}
+	s.buffer.WriteString(line)
+}
+
+// flush writes the buffer to the connection. The mutex must be held by the
+// caller.
+func (s *statsdConn) flush() error {
+	if s.buffer.Len() == 0 {
+		return nil
+	}
+	_, err := s.conn.Write(s.buffer.Bytes())
+	s.buffer.Reset()
+	return err
+}
+
+// run periodically flushes the buffer until stopped.
+func (s *statsdConn) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(s.done)
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			s.flush()
+			s.mutex.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// StatsdClient writes metrics to a plain (non-DataDog) statsd server using
+// the classic statsd wire format. Since plain statsd has no concept of tags,
+// they are folded into the metric name in sorted key order. For example,
+// given a namespace of `myprefix` and tags `tag1:value1` and `tag2:value2`,
+// a call to `Incr("requests.count")` emits the following line:
+//
+//   myprefix.requests.count.tag1.value1.tag2.value2:1|c
+//
+// Histograms and distributions are sent as statsd timers, which compute
+// percentiles server-side. Events and service checks are not supported by
+// plain statsd and are ignored. Metrics are sampled client-side and the
+// sample rate is sent along so the server can extrapolate the full value.
+type StatsdClient struct {
+	conn      *statsdConn
+	namespace string
+	rate      float64
+	tagMap    map[string]string
+	timestamp time.Time
+}
+
+// NewStatsdClient creates a new statsd client sending UDP packets to
+// `address` with the metrics prefix of `namespace`. Buffered metrics are
+// sent at least every `flushInterval`.
+func NewStatsdClient(address string, namespace string, flushInterval time.Duration) *StatsdClient {
+	if flushInterval <= 0 {
+		log.Panic("flush interval must be positive")
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if namespace != "" {
+		namespace += "."
+	}
+
+	s := &statsdConn{
+		conn: conn,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run(flushInterval)
+
+	return &StatsdClient{
+		conn:      s,
+		namespace: namespace,
+		rate:      1.0,
+	}
+}
+
+// WithTags clones this client with additional tags. Duplicate tags overwrite
+// the existing value.
+func (c *StatsdClient) WithTags(tags map[string]string) Client {
+	if len(tags) == 0 {
+		return c
+	}
+	return &StatsdClient{
+		conn:      c.conn,
+		namespace: c.namespace,
+		rate:      c.rate,
+		tagMap:    combine(c.tagMap, tags),
+		timestamp: c.timestamp,
+	}
+}
+
+// WithTagsIf clones this client with additional tags when `cond` is true.
+// Otherwise it returns this client without allocating.
+func (c *StatsdClient) WithTagsIf(cond bool, tags map[string]string) Client {
+	return withTagsIf(c, cond, tags)
+}
+
+// WithTag clones this client with a single additional tag. A duplicate tag
+// overwrites the existing value.
+func (c *StatsdClient) WithTag(key, value string) Client {
+	return c.WithTags(map[string]string{key: value})
+}
+
+// WithTagValues clones this client with multiple values for a single tag,
+// replacing any existing values for the key.
+func (c *StatsdClient) WithTagValues(key string, values ...string) Client {
+	return withTagValues(c, key, values)
+}
+
+// WithTagsFromStruct clones this client with additional tags from the fields
+// of a struct tagged with `metric:"key"`, as returned by `TagsFromStruct`.
+func (c *StatsdClient) WithTagsFromStruct(v interface{}) Client {
+	return withStruct(c, v)
+}
+
+// Tags returns a copy of the tags currently attached to this client.
+func (c *StatsdClient) Tags() map[string]string {
+	return combine(nil, c.tagMap)
+}
+
+// Rate returns the sample rate of this client.
+func (c *StatsdClient) Rate() float64 {
+	return c.rate
+}
+
+// WithoutTags clones this client with the given tags removed.
+func (c *StatsdClient) WithoutTags(keys ...string) Client {
+	return &StatsdClient{
+		conn:      c.conn,
+		namespace: c.namespace,
+		rate:      c.rate,
+		tagMap:    without(c.tagMap, keys),
+		timestamp: c.timestamp,
+	}
+}
+
+// WithContext clones this client with the tags stored in the context.
+func (c *StatsdClient) WithContext(ctx context.Context) Client {
+	return withContext(c, ctx)
+}
+
+// WithTimestamp clones this client with a timestamp for subsequent counts,
+// gauges, and distributions. Like `GaugeWithTimestamp`, those calls are not
+// supported and are dropped while a timestamp is set, since the statsd
+// protocol has no timestamps. The first dropped call of each kind is logged.
+func (c *StatsdClient) WithTimestamp(timestamp time.Time) Client {
+	return &StatsdClient{
+		conn:      c.conn,
+		namespace: c.namespace,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		timestamp: timestamp,
+	}
+}
+
+// WithRate clones this client with a new sample rate.
+func (c *StatsdClient) WithRate(rate float64) Client {
+	return &StatsdClient{
+		conn:      c.conn,
+		namespace: c.namespace,
+		rate:      clampRate(rate),
+		tagMap:    c.tagMap,
+		timestamp: c.timestamp,
+	}
+}
+
+// WithAdditionalRate clones this client with its sample rate multiplied by
+// `factor`.
+func (c *StatsdClient) WithAdditionalRate(factor float64) Client {
+	return withAdditionalRate(c, factor)
+}
+
+// Always clones this client with the sample rate reset to 1.0, so that
+// critical metrics are always emitted. Tags and prefix are preserved.
+func (c *StatsdClient) Always() Client {
+	return c.WithRate(1.0)
+}
+
+// WithPrefix clones this client with an additional metric name prefix.
+func (c *StatsdClient) WithPrefix(prefix string) Client {
+	return &StatsdClient{
+		conn:      c.conn,
+		namespace: c.namespace + prefix,
+		rate:      c.rate,
+		tagMap:    c.tagMap,
+		timestamp: c.timestamp,
+	}
+}
+
+// Clone returns an independent copy of this client, which shares the
+// connection of the original.
+func (c *StatsdClient) Clone() Client {
+	return &StatsdClient{
+		conn:      c.conn,
+		namespace: c.namespace,
+		rate:      c.rate,
+		tagMap:    combine(nil, c.tagMap),
+		timestamp: c.timestamp,
+	}
+}
+
+// Batch returns a new batch which sends its calls to this client via `Send`.
+func (c *StatsdClient) Batch() *Batch {
+	return newBatch(c)
+}
+
+// send formats and buffers metric lines, taking into account the sample
+// rate. Multiple values result in multiple lines for the same metric, which
+// are either all sent or all skipped when sampling.
+func (c *StatsdClient) send(name string, t string, values ...string) {
+	c.sendRate(c.rate, name, t, values...)
+}
+
+// sendRate formats and buffers metric lines sampled at the given rate.
+func (c *StatsdClient) sendRate(rate float64, name string, t string, values ...string) {
+	if suppressed() {
+		return
+	}
+	if rate < 1.0 && rand.Float64() >= rate {
+		return
+	}
+
+	path := tagPath(c.namespace+name, c.tagMap)
+
+	suffix := ""
+	if rate < 1.0 {
+		suffix = "|@" + strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+
+	for _, value := range values {
+		c.conn.write(fmt.Sprintf("%s:%s|%s%s", path, value, t, suffix))
+	}
+}
+
+// Flush sends any buffered metrics to the server.
+func (c *StatsdClient) Flush() error {
+	c.conn.mutex.Lock()
+	defer c.conn.mutex.Unlock()
+	return c.conn.flush()
+}
+
+// Close flushes any buffered metrics and closes the connection. Calling it
+// more than once is a no-op.
+func (c *StatsdClient) Close() error {
+	var err error
+	c.conn.once.Do(func() {
+		close(c.conn.stop)
+		<-c.conn.done
+
+		err = c.Flush()
+		if closeErr := c.conn.conn.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// Count adds some integer value to a metric.
+func (c *StatsdClient) Count(name string, value int64) {
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the statsd client", "counts")
+		return
+	}
+	c.send(name, "c", strconv.FormatInt(value, 10))
+}
+
+// Incr adds one to a metric.
+func (c *StatsdClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Decr subtracts one from a metric.
+func (c *StatsdClient) Decr(name string) {
+	c.Count(name, -1)
+}
+
+// CountWithRate adds some value to a metric using the given sample rate for
+// just this call.
+func (c *StatsdClient) CountWithRate(name string, value int64, rate float64) {
+	c.WithRate(rate).Count(name, value)
+}
+
+// CountFloat adds a fractional value to a metric.
+func (c *StatsdClient) CountFloat(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the statsd client", "counts")
+		return
+	}
+	c.send(name, "c", strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// Gauge sets a numeric value. Plain statsd treats negative gauge values as
+// a decrement, so negative values are sent by first setting the gauge to
+// zero.
+func (c *StatsdClient) Gauge(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the statsd client", "gauges")
+		return
+	}
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if value < 0 {
+		c.send(name, "g", "0", formatted)
+		return
+	}
+	c.send(name, "g", formatted)
+}
+
+// GaugeInt sets a numeric integer value.
+func (c *StatsdClient) GaugeInt(name string, value int64) {
+	c.Gauge(name, float64(value))
+}
+
+// GaugeWithTimestamp on the StatsdClient is not supported and is dropped,
+// since the statsd protocol has no timestamps. The first dropped call of each
+// kind is logged.
+func (c *StatsdClient) GaugeWithTimestamp(name string, value float64, timestamp time.Time) {
+	warnTimestampDropped("the statsd client", "gauges")
+}
+
+// GaugeDelta adjusts a gauge by a signed amount. The delta is always sent
+// with a leading sign, including `+0`, so it is never mistaken for an
+// absolute value. Deltas are never sampled, since the server cannot
+// extrapolate them and a dropped delta would leave the gauge wrong, so the
+// client's rate is ignored unless it is zero.
+func (c *StatsdClient) GaugeDelta(name string, delta float64) {
+	if c.rate <= 0 {
+		return
+	}
+	formatted := strconv.FormatFloat(delta, 'f', -1, 64)
+	if delta >= 0 {
+		formatted = "+" + formatted
+	}
+	c.sendRate(1.0, name, "g", formatted)
+}
+
+// Set counts the number of unique values for a metric.
+func (c *StatsdClient) Set(name string, value string) {
+	c.send(name, "s", value)
+}
+
+// Event on the StatsdClient is a no-op
+func (c *StatsdClient) Event(e *statsd.Event) {
+}
+
+// ServiceCheck on the StatsdClient is a no-op
+func (c *StatsdClient) ServiceCheck(sc *statsd.ServiceCheck) {
+}
+
+// Timing tracks a duration in milliseconds.
+func (c *StatsdClient) Timing(name string, value time.Duration) {
+	c.send(name, "ms", strconv.FormatFloat(float64(value)/float64(time.Millisecond), 'f', -1, 64))
+}
+
+// TimingMs tracks a duration given in milliseconds.
+func (c *StatsdClient) TimingMs(name string, ms float64) {
+	c.send(name, "ms", strconv.FormatFloat(ms, 'f', -1, 64))
+}
+
+// NewTimer starts a timer which calls `Timing` on this client when stopped.
+func (c *StatsdClient) NewTimer(name string) *Timer {
+	return newTimer(c, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on this client.
+func (c *StatsdClient) TimeFunc(name string, fn func()) {
+	timeFunc(c, name, fn)
+}
+
+// TimingSince sends the duration since `start` via `Timing` on this client.
+func (c *StatsdClient) TimingSince(name string, start time.Time) {
+	c.Timing(name, time.Since(start))
+}
+
+// Histogram sets a numeric value while tracking min/max/avg/p95/etc.
+func (c *StatsdClient) Histogram(name string, value float64) {
+	c.send(name, "ms", strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// Distribution tracks the statistical distribution of a set of values.
+func (c *StatsdClient) Distribution(name string, value float64) {
+	if !c.timestamp.IsZero() {
+		warnTimestampDropped("the statsd client", "distributions")
+		return
+	}
+	c.send(name, "ms", strconv.FormatFloat(value, 'f', -1, 64))
+}
@@ -0,0 +1,240 @@
+package metrics_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+// listenStatsd starts a UDP listener on a random local port.
+func listenStatsd(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected UDP listener to start. Found '%v'", err)
+	}
+	return conn
+}
+
+// readStatsd reads a single packet and returns its lines.
+func readStatsd(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected to read a packet. Found '%v'", err)
+	}
+	// The dogstatsd client terminates every line, including the last one.
+	return strings.Split(strings.TrimSuffix(string(buf[:n]), "\n"), "\n")
+}
+
+func ExampleStatsdClient() {
+	client := metrics.NewStatsdClient("127.0.0.1:8125", "myprefix", time.Second)
+	defer client.Close()
+	client.WithTags(map[string]string{
+		"tag": "value",
+	}).Incr("requests.count")
+}
+
+func TestStatsdClient(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	var client metrics.Client
+	client = metrics.NewStatsdClient(server.LocalAddr().String(), "testing", time.Hour)
+
+	client.Incr("one")
+	client.Decr("one")
+	client.Count("two", 2)
+	client.Gauge("memory", 1024)
+	client.Gauge("negative", -5)
+	client.Set("users", "alice")
+	client.Timing("timing", 1500*time.Microsecond)
+	client.Histogram("histo", 123)
+	client.Distribution("distro", 999)
+	client.Event(statsd.NewEvent("title", "desc"))
+	client.ServiceCheck(statsd.NewServiceCheck("check", statsd.Ok))
+	client.WithTags(map[string]string{
+		"tag2": "value2",
+		"tag1": "value1",
+	}).Incr("tagged")
+	client.WithRate(0).Incr("never")
+
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed. Found '%v'", err)
+	}
+
+	ExpectEqual(t, []string{
+		"testing.one:1|c",
+		"testing.one:-1|c",
+		"testing.two:2|c",
+		"testing.memory:1024|g",
+		"testing.negative:0|g",
+		"testing.negative:-5|g",
+		"testing.users:alice|s",
+		"testing.timing:1.5|ms",
+		"testing.histo:123|ms",
+		"testing.distro:999|ms",
+		"testing.tagged.tag1.value1.tag2.value2:1|c",
+	}, readStatsd(t, server))
+
+	// Closing flushes anything left in the buffer.
+	client.WithRate(0.999999999).Incr("rated")
+	client.Close()
+	lines := readStatsd(t, server)
+	if len(lines) != 1 || !strings.HasSuffix(lines[0], "|c|@0.999999999") {
+		t.Fatalf("Expected sampled metric with rate. Found '%v'", lines)
+	}
+
+	// Closing twice must not panic.
+	client.Close()
+}
+
+func TestStatsdClientFlushInterval(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "", 10*time.Millisecond)
+	defer client.Close()
+
+	client.Incr("one")
+	ExpectEqual(t, []string{"one:1|c"}, readStatsd(t, server))
+}
+
+func TestStatsdClientWithPrefix(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "testing", time.Hour)
+	defer client.Close()
+
+	client.WithPrefix("a.").WithPrefix("b.").Incr("one")
+	client.WithPrefix("").Incr("two")
+	client.Flush()
+
+	ExpectEqual(t, []string{"testing.a.b.one:1|c", "testing.two:1|c"}, readStatsd(t, server))
+}
+
+func TestStatsdClientSanitizesTags(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "testing", time.Hour)
+	defer client.Close()
+
+	// A `:` or `|` would otherwise end the metric name or value early.
+	client.WithTags(map[string]string{"host": "db:5432", "path|x": "a b"}).Incr("one")
+	client.Flush()
+
+	ExpectEqual(t, []string{"testing.one.host.db_5432.path_x.a_b:1|c"}, readStatsd(t, server))
+}
+
+func TestStatsdClientGaugeDelta(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "", time.Hour)
+	defer client.Close()
+
+	client.GaugeDelta("connections", 1)
+	client.GaugeDelta("connections", -2.5)
+	client.GaugeDelta("connections", 0)
+
+	// Deltas are never sampled, unless the rate is zero.
+	client.WithRate(0.01).GaugeDelta("connections", 3)
+	client.WithRate(0).GaugeDelta("connections", 4)
+	client.Flush()
+
+	ExpectEqual(t, []string{
+		"connections:+1|g",
+		"connections:-2.5|g",
+		"connections:+0|g",
+		"connections:+3|g",
+	}, readStatsd(t, server))
+}
+
+func TestStatsdClientTimingMs(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "", time.Hour)
+	defer client.Close()
+
+	client.TimingMs("latency", 123.25)
+	client.Flush()
+
+	ExpectEqual(t, []string{"latency:123.25|ms"}, readStatsd(t, server))
+}
+
+func TestStatsdClientCountFloat(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "", time.Hour)
+	defer client.Close()
+
+	client.CountFloat("work", 0.25)
+	client.Flush()
+
+	ExpectEqual(t, []string{"work:0.25|c"}, readStatsd(t, server))
+}
+
+func TestStatsdClientWithTimestamp(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+	metrics.ResetTimestampWarnings()
+
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "", time.Hour)
+	defer client.Close()
+
+	// The statsd protocol has no timestamps, so stamped calls are dropped
+	// with a warning rather than sent at the ingestion time.
+	stamped := client.WithTimestamp(time.Unix(1500000000, 0))
+	stamped.Incr("stamped")
+	stamped.Incr("stamped")
+	client.GaugeWithTimestamp("backfill", 5, time.Unix(1500000000, 0))
+	client.Incr("unstamped")
+	client.Flush()
+
+	ExpectEqual(t, []string{"unstamped:1|c"}, readStatsd(t, server))
+	ExpectEqual(t, 1, strings.Count(warnings.String(), "statsd client does not support timestamped counts"))
+	ExpectEqual(t, 1, strings.Count(warnings.String(), "statsd client does not support timestamped gauges"))
+}
+
+func TestStatsdClientCountWithRate(t *testing.T) {
+	server := listenStatsd(t)
+	defer server.Close()
+
+	client := metrics.NewStatsdClient(server.LocalAddr().String(), "", time.Hour)
+	defer client.Close()
+
+	client.CountWithRate("sampled", 1, 0.999999999)
+	client.CountWithRate("never", 1, 0)
+	client.Incr("unsampled")
+	client.Flush()
+
+	ExpectEqual(t, []string{"sampled:1|c|@0.999999999", "unsampled:1|c"}, readStatsd(t, server))
+}
+
+func TestStatsdClientInvalidInterval(t *testing.T) {
+	// The interval is validated before dialling, so no connection is leaked.
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "flush interval") {
+			t.Fatalf("Expected a panic for the flush interval. Found '%v'", r)
+		}
+	}()
+	metrics.NewStatsdClient("invalid address", "", 0)
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// TagsFromStruct returns tags built from the fields of a struct, or a pointer
+// to one, which have a `metric:"key"` struct tag. Non-string values are
+// formatted via `fmt`, and zero values are skipped unless the struct tag has
+// the `keepempty` option:
+//
+//   type Config struct {
+//     Region  string `metric:"region"`
+//     Workers int    `metric:"workers"`
+//     Debug   bool   `metric:"debug,keepempty"`
+//     Secret  string
+//   }
+//
+// Nested and embedded structs without a struct tag are flattened into the
+// same tags, while a nested struct with a struct tag prefixes its keys, e.g.
+// `db.host`. Fields of the outer struct override duplicate keys from nested
+// structs, and a key of `-` skips the field. Values which implement
+// `fmt.Stringer`, like `time.Time`, are formatted rather than flattened.
+// It panics if `v` is not a struct or a pointer to one. A nil pointer
+// returns no tags. The result is never nil.
+func TagsFromStruct(v interface{}) map[string]string {
+	tags := map[string]string{}
+
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return tags
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		log.Panicf("metrics: expected a struct for tags, found %T", v)
+	}
+
+	structTags(tags, "", value)
+	return tags
+}
+
+// stringerType is used to detect values which format themselves.
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// structTags adds the tags from the fields of a struct value with the given
+// key prefix. Nested structs are added first, so that the fields of the
+// outer struct take precedence.
+func structTags(tags map[string]string, prefix string, value reflect.Value) {
+	t := value.Type()
+	direct := map[string]string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// Unexported fields, including embedded ones, cannot be read.
+			continue
+		}
+
+		key, options := parseMetricTag(field.Tag.Get("metric"))
+		if key == "-" {
+			continue
+		}
+
+		fv := value.Field(i)
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() && !fv.Type().Implements(stringerType) {
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct && !fv.Type().Implements(stringerType) {
+			nested := prefix
+			if key != "" {
+				nested = prefix + key + "."
+			}
+			structTags(tags, nested, fv)
+			continue
+		}
+
+		if key == "" || (fv.IsZero() && !strings.Contains(options, "keepempty")) {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			direct[prefix+key] = ""
+			continue
+		}
+		direct[prefix+key] = fmt.Sprint(fv.Interface())
+	}
+
+	for k, v := range direct {
+		tags[k] = v
+	}
+}
+
+// parseMetricTag splits a `metric` struct tag into its key and options.
+func parseMetricTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// withStruct returns a client with the struct tags added, or the client
+// itself if the struct has no tags.
+func withStruct(client Client, v interface{}) Client {
+	tags := TagsFromStruct(v)
+	if len(tags) == 0 {
+		return client
+	}
+	return client.WithTags(tags)
+}
@@ -0,0 +1,103 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+type TagDB struct {
+	Host string `metric:"host"`
+	Port int    `metric:"port"`
+}
+
+type TagBase struct {
+	Service string `metric:"service"`
+	Region  string `metric:"region"`
+}
+
+type TagConfig struct {
+	TagBase
+	Region   string        `metric:"region"`
+	Workers  int           `metric:"workers"`
+	Debug    bool          `metric:"debug,keepempty"`
+	Enabled  bool          `metric:"enabled"`
+	Timeout  time.Duration `metric:"timeout"`
+	Ratio    *float64      `metric:"ratio"`
+	Primary  TagDB         `metric:"db"`
+	Replica  *TagDB        `metric:"replica"`
+	Ignored  string        `metric:"-"`
+	Untagged string
+	secret   string
+}
+
+func ExampleTagsFromStruct() {
+	type Config struct {
+		Region  string `metric:"region"`
+		Workers int    `metric:"workers"`
+	}
+
+	client := metrics.NewLoggerClient(nil)
+	client.WithTagsFromStruct(Config{Region: "us-west-2", Workers: 4}).Incr("requests.count")
+	// Output: Count requests.count:1 [region=us-west-2 workers=4]
+}
+
+func TestTagsFromStruct(t *testing.T) {
+	ratio := 0.5
+	config := &TagConfig{
+		TagBase:  TagBase{Service: "api", Region: "embedded"},
+		Region:   "us-west-2",
+		Workers:  4,
+		Timeout:  2 * time.Second,
+		Ratio:    &ratio,
+		Primary:  TagDB{Host: "db1", Port: 5432},
+		Ignored:  "ignored",
+		Untagged: "untagged",
+		secret:   "secret",
+	}
+
+	ExpectEqual(t, map[string]string{
+		"service": "api",
+		"region":  "us-west-2",
+		"workers": "4",
+		"debug":   "false",
+		"timeout": "2s",
+		"ratio":   "0.5",
+		"db.host": "db1",
+		"db.port": "5432",
+	}, metrics.TagsFromStruct(config))
+
+	// Embedded fields are used when the outer struct has no value.
+	config.Region = ""
+	config.Replica = &TagDB{Host: "db2"}
+	tags := metrics.TagsFromStruct(*config)
+	ExpectEqual(t, "embedded", tags["region"])
+	ExpectEqual(t, "db2", tags["replica.host"])
+
+	var empty *TagConfig
+	ExpectEqual(t, map[string]string{}, metrics.TagsFromStruct(empty))
+}
+
+func TestTagsFromStructPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for a non-struct value")
+		}
+	}()
+	metrics.TagsFromStruct("not a struct")
+}
+
+func TestWithTagsFromStruct(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	// Struct tags override existing tags, just like `WithTags`.
+	recorder.WithTag("region", "default").WithTag("tag1", "value1").
+		WithTagsFromStruct(TagBase{Service: "api", Region: "us-west-2"}).
+		Incr("requests.count")
+
+	recorder.Expect("requests.count").
+		Tag("region", "us-west-2").
+		Tag("service", "api").
+		Tag("tag1", "value1")
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import "time"
+
+// Timer measures the duration of an operation and reports it as a timing
+// metric through the client which created it, using that client's tags and
+// sample rate at the time the timer was created. It pairs nicely with
+// `defer`:
+//
+//   func handler() {
+//     defer client.NewTimer("handler.latency").Stop()
+//     ...
+//   }
+type Timer struct {
+	client Client
+	name   string
+	now    func() time.Time
+	start  time.Time
+}
+
+// clocked is implemented by clients which have a clock set via `WithClock`.
+type clocked interface {
+	clock() func() time.Time
+}
+
+// clockFor returns the clock of the given client, or `time.Now`.
+func clockFor(client Client) func() time.Time {
+	if c, ok := client.(clocked); ok {
+		return c.clock()
+	}
+	return time.Now
+}
+
+// ClockFor returns the clock set via `WithClock` of the given client, or
+// `time.Now` if it has none. Like `NewTimer`, `TimeFunc`, `NewBatch` and
+// `ReplaceTagValues`, it is meant for implementing `Client` outside of this
+// package, e.g. in the Prometheus and OpenTelemetry subpackages.
+func ClockFor(client Client) func() time.Time {
+	return clockFor(client)
+}
+
+// NewTimer starts a timer for the given client and metric name, which is how
+// clients implement their `NewTimer` method.
+func NewTimer(client Client, name string) *Timer {
+	return newTimer(client, name)
+}
+
+// TimeFunc runs `fn` and sends its duration via `Timing` on the given
+// client, which is how clients implement their `TimeFunc` method.
+func TimeFunc(client Client, name string, fn func()) {
+	timeFunc(client, name, fn)
+}
+
+// newTimer starts a new timer for the given client and metric name.
+func newTimer(client Client, name string) *Timer {
+	now := clockFor(client)
+	return &Timer{
+		client: client,
+		name:   name,
+		now:    now,
+		start:  now(),
+	}
+}
+
+// Stop computes the elapsed duration since the timer was created, sends it
+// via `Timing` and returns it.
+func (t *Timer) Stop() time.Duration {
+	elapsed := t.now().Sub(t.start)
+	t.client.Timing(t.name, elapsed)
+	return elapsed
+}
+
+// timeFunc runs `fn` and sends its duration via `Timing` on the given client.
+// The timing is sent even if `fn` panics, after which the panic continues.
+func timeFunc(client Client, name string, fn func()) {
+	defer newTimer(client, name).Stop()
+	fn()
+}
@@ -0,0 +1,111 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func ExampleTimer() {
+	client := metrics.NewLoggerClient(nil)
+
+	func() {
+		defer client.NewTimer("handler.latency").Stop()
+		// Do some work here...
+	}()
+}
+
+func TestTimer(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	timer := recorder.WithTag("tag1", "value1").WithRate(0.5).NewTimer("latency")
+	time.Sleep(time.Millisecond)
+	elapsed := timer.Stop()
+
+	if elapsed < time.Millisecond {
+		t.Fatalf("Expected elapsed time of at least 1ms. Found '%v'", elapsed)
+	}
+
+	recorder.Expect("latency").Value(elapsed).Tag("tag1", "value1").Rate(0.5)
+	ExpectEqual(t, 1, recorder.Length())
+}
+
+func TestTimerMultiClient(t *testing.T) {
+	first := metrics.NewRecorderClient().WithTest(t)
+	second := metrics.NewRecorderClient().WithTest(t)
+
+	elapsed := metrics.NewMultiClient(first, second).WithTag("tag1", "value1").NewTimer("latency").Stop()
+
+	first.Expect("latency").Value(elapsed).Tag("tag1", "value1")
+	second.Expect("latency").Value(elapsed).Tag("tag1", "value1")
+}
+
+func TestTimeFunc(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	called := false
+	recorder.WithTag("tag1", "value1").TimeFunc("latency", func() {
+		called = true
+	})
+
+	ExpectEqual(t, true, called)
+	recorder.Expect("latency").Tag("tag1", "value1")
+}
+
+func TestTimeFuncPanic(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	defer func() {
+		if err := recover(); err != "oops" {
+			t.Fatalf("Expected panic to propagate. Found '%v'", err)
+		}
+		recorder.Expect("latency").Tag("tag1", "value1")
+	}()
+
+	recorder.WithTag("tag1", "value1").TimeFunc("latency", func() {
+		panic("oops")
+	})
+}
+
+func TestTimingSince(t *testing.T) {
+	recorder := metrics.NewRecorderClient().WithTest(t)
+
+	start := time.Now().Add(-time.Hour)
+	recorder.WithTag("tag1", "value1").WithRate(0.5).TimingSince("latency", start)
+
+	recorder.Expect("latency").Tag("tag1", "value1").Rate(0.5)
+	ExpectEqual(t, 1, recorder.Length())
+
+	call := recorder.GetCalls()[0].(*metrics.MetricCall)
+	elapsed := time.Duration(call.Value)
+	if elapsed < time.Hour || elapsed > time.Hour+time.Minute {
+		t.Fatalf("Expected elapsed time of about 1h. Found '%v'", elapsed)
+	}
+}
+
+func TestTimerClock(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	recorder := &LogRecorder{}
+	client := metrics.NewLoggerClient(recorder, metrics.WithClock(func() time.Time {
+		return now
+	})).WithTag("tag1", "value1")
+
+	timer := client.NewTimer("latency")
+	now = now.Add(1500 * time.Millisecond)
+	ExpectEqual(t, 1500*time.Millisecond, timer.Stop())
+
+	start := now
+	now = now.Add(250 * time.Millisecond)
+	client.TimingSince("since", start)
+
+	client.TimeFunc("func", func() {
+		now = now.Add(time.Second)
+	})
+
+	ExpectEqual(t, []string{
+		"Timing latency:1.5s [tag1=value1]",
+		"Timing since:250ms [tag1=value1]",
+		"Timing func:1s [tag1=value1]",
+	}, recorder.messages)
+}
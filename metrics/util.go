@@ -3,17 +3,63 @@ package metrics
 import (
 	"bufio"
 	"fmt"
+	"hash/fnv"
+	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
-// Combine two maps, with the second one overriding duplicate values.
+// disabled is set while all metrics are suppressed via `SetEnabled`.
+var disabled atomic.Bool
+
+// SetEnabled turns emission on or off for every client in the process, for
+// example to silence metrics during a maintenance window or a noisy test:
+//
+//   metrics.SetEnabled(false)
+//   defer metrics.SetEnabled(true)
+//
+// While disabled, counts, gauges, sets, timings, histograms, distributions,
+// events and service checks are dropped before being sampled, tagged or
+// buffered. Values are not queued for later, so nothing is emitted for the
+// suppressed period once enabled again. `Flush` and `Close` are unaffected.
+//
+// Checking the toggle costs a single atomic load per call, so leaving
+// metrics enabled adds no measurable overhead.
+func SetEnabled(enabled bool) {
+	disabled.Store(!enabled)
+}
+
+// Enabled reports whether metrics are currently being emitted, i.e. whether
+// they have not been suppressed via `SetEnabled(false)`.
+func Enabled() bool {
+	return !disabled.Load()
+}
+
+// suppressed reports whether emission methods should drop their values.
+func suppressed() bool {
+	return disabled.Load()
+}
+
+// Combine two maps, with the second one overriding duplicate values. A new
+// map is always returned so that it never shares state with either input,
+// which means clients can safely share a combined tag map as long as it is
+// never modified after creation. Empty results are not shared either, since
+// callers like `Tags()` hand the result out to be modified freely.
+//
+// Multiple values for a key set via `WithTagValues` are a single joined
+// value here, so an override replaces all of them rather than merging.
 func combine(original, override map[string]string) map[string]string {
-	// We know the size must be at least the length of the existing tag map, but
-	// since values can be overridden we cannot assume the length is the sum of
-	// both inputs.
-	combined := make(map[string]string, len(original))
+	// Values can be overridden so the sum of both lengths is an upper bound,
+	// but sizing for it up front avoids growing the map while copying.
+	combined := make(map[string]string, len(original)+len(override))
 
 	for k, v := range original {
 		combined[k] = v
@@ -25,18 +71,498 @@ func combine(original, override map[string]string) map[string]string {
 	return combined
 }
 
-// cloneTagsWithMap clones the original string slice and appends the new tags in the map
-func cloneTagsWithMap(original []string, newTags map[string]string) []string {
-	combined := make([]string, len(original)+len(newTags))
-	copy(combined, original)
+// without returns a copy of the tag map with the given keys removed. Keys
+// which are not present are ignored.
+func without(tagMap map[string]string, keys []string) map[string]string {
+	removed := combine(nil, tagMap)
+	for _, key := range keys {
+		delete(removed, key)
+	}
+	return removed
+}
 
-	i := len(original)
-	for k, v := range newTags {
-		combined[i] = fmt.Sprintf("%s:%s", k, v)
-		i++
+// sortedTags converts a map to an array of strings like `key:value`, sorted
+// by key and then by value. Tags with multiple values set via `WithTagValues`
+// become one string per value, e.g. `team:a` and `team:b`, while commas in
+// any other value are replaced with underscores.
+//
+// The same tags always produce the same slice regardless of the order they
+// were added in, so DogStatsD client-side aggregation, which keys series by
+// the tag slice, never splits one series into several. Keys are compared
+// rather than whole strings so that e.g. `env:prod` sorts before
+// `env-region:us` even though `-` sorts before `:`.
+func sortedTags(tagMap map[string]string, multi tagValueMap) []string {
+	keys := make([]string, 0, len(tagMap))
+	for k := range tagMap {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return combined
+	tags := make([]string, 0, len(tagMap))
+	for _, k := range keys {
+		values, ok := multi[k]
+		if !ok {
+			// A comma would split a single value into separate tags.
+			tags = append(tags, k+":"+strings.ReplaceAll(tagMap[k], tagValueSeparator, "_"))
+			continue
+		}
+		values = append([]string(nil), values...)
+		sort.Strings(values)
+		for _, value := range values {
+			tags = append(tags, k+":"+value)
+		}
+	}
+	return tags
+}
+
+// hashSampled returns whether a series is sampled at the given rate based on
+// a hash of its name and sorted tags, so that the same series always makes
+// the same decision.
+func hashSampled(rate float64, name string, tagMap map[string]string) bool {
+	if rate >= 1.0 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	for _, tag := range sortedTags(tagMap, nil) {
+		h.Write([]byte{0})
+		h.Write([]byte(tag))
+	}
+	// FNV mixes the last bytes poorly into the high bits, so finalize the
+	// hash as in MurmurHash3 before using the top 53 bits for a uniform
+	// float in [0, 1).
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return float64(x>>11)/(1<<53) < rate
+}
+
+// typeTagMap returns the tags for a metric of the given type: the client's
+// tags on top of any default tags for the type set via `WithTypeTags`.
+func typeTagMap(typeTags map[string]map[string]string, metricType string, tagMap map[string]string) map[string]string {
+	defaults, ok := typeTags[metricType]
+	if !ok {
+		return tagMap
+	}
+	return combine(defaults, tagMap)
+}
+
+// tagValueSeparator joins the values of a tag key set via `WithTagValues`.
+// Commas separate tags in the dogstatsd protocol, so they cannot be part of
+// a single tag value anyway.
+const tagValueSeparator = ","
+
+// tagValueMap holds the individual values of tag keys set via
+// `WithTagValues`, for clients which send each one separately. It is kept
+// apart from the joined values in the tag map so that a single value which
+// happens to contain a comma is never split. It is never modified in place.
+type tagValueMap map[string][]string
+
+// with returns a copy of the map with the given values for the key.
+func (m tagValueMap) with(key string, values []string) tagValueMap {
+	clone := make(tagValueMap, len(m)+1)
+	for k, v := range m {
+		clone[k] = v
+	}
+	clone[key] = values
+	return clone
+}
+
+// without returns the map without the given keys, copying it only if any of
+// them are present.
+func (m tagValueMap) without(keys []string) tagValueMap {
+	for _, key := range keys {
+		if _, ok := m[key]; ok {
+			clone := make(tagValueMap, len(m))
+			for k, v := range m {
+				clone[k] = v
+			}
+			for _, key := range keys {
+				delete(clone, key)
+			}
+			return clone
+		}
+	}
+	return m
+}
+
+// ReplaceTagValues returns a client with all of the given values for a tag
+// key, or with the key removed if there are no values, which is how clients
+// implement their `WithTagValues` method.
+func ReplaceTagValues(client Client, key string, values ...string) Client {
+	return withTagValues(client, key, values)
+}
+
+// CombineTags returns a new map with the tags of `override` added to those of
+// `original`, overwriting duplicate keys, which is how clients implement
+// `WithTags`. Neither input is modified.
+func CombineTags(original, override map[string]string) map[string]string {
+	return combine(original, override)
+}
+
+// RemoveTags returns a copy of the tags with the given keys removed, which is
+// how clients implement `WithoutTags`.
+func RemoveTags(tagMap map[string]string, keys ...string) map[string]string {
+	return without(tagMap, keys)
+}
+
+// ClampRate limits a sample rate to the range [0.0, 1.0], which is how
+// clients implement `WithRate`.
+func ClampRate(rate float64) float64 {
+	return clampRate(rate)
+}
+
+// WarnTimestampDropped logs that a client drops calls made with a timestamp,
+// e.g. via `WithTimestamp`, which is how clients without timestamps report
+// them. Each client and kind of call is only logged once per process.
+func WarnTimestampDropped(client, kind string) {
+	warnTimestampDropped(client, kind)
+}
+
+// timestampWarnings holds the client and kind of call pairs which have been
+// logged by `warnTimestampDropped`.
+var timestampWarnings sync.Map
+
+// warnTimestampDropped logs that a client drops timestamped calls of a kind,
+// once per process.
+func warnTimestampDropped(client, kind string) {
+	if _, warned := timestampWarnings.LoadOrStore(client+" "+kind, true); !warned {
+		log.Printf("metrics: %s does not support timestamped %s, dropping them", client, kind)
+	}
+}
+
+// withTagValues returns a client with all of the given values for a tag key,
+// or with the key removed if there are no values.
+func withTagValues(client Client, key string, values []string) Client {
+	if len(values) == 0 {
+		return client.WithoutTags(key)
+	}
+	return client.WithTag(key, strings.Join(values, tagValueSeparator))
+}
+
+// withTagsIf returns the client with additional tags when the condition is
+// true, and otherwise returns the client itself.
+func withTagsIf(client Client, cond bool, tags map[string]string) Client {
+	if !cond {
+		return client
+	}
+	return client.WithTags(tags)
+}
+
+// withAdditionalRate returns a client whose sample rate is its current rate
+// multiplied by the clamped factor.
+func withAdditionalRate(client Client, factor float64) Client {
+	return client.WithRate(client.Rate() * clampRate(factor))
+}
+
+// clampRate limits a sample rate to the range [0.0, 1.0]. A rate of zero
+// means no metrics are emitted.
+func clampRate(rate float64) float64 {
+	if rate < 0.0 {
+		return 0.0
+	}
+	if rate > 1.0 {
+		return 1.0
+	}
+	return rate
+}
+
+// metricRate returns the sample rate for a metric name, falling back to the
+// given client rate when no per-metric rate is set. The result is raised to
+// the metric's minimum rate, if any.
+func metricRate(rates, floors map[string]float64, name string, rate float64) float64 {
+	if r, ok := rates[name]; ok {
+		rate = r
+	}
+	if floor, ok := floors[name]; ok && floor > rate {
+		return floor
+	}
+	return rate
+}
+
+// nameMode controls how metric names and tags with characters which are
+// invalid for statsd are handled.
+type nameMode int
+
+const (
+	nameUnchecked nameMode = iota
+	nameSanitize
+	nameStrict
+)
+
+// invalidNameRune returns whether a rune is not allowed in statsd metric
+// names, tag keys, or tag values.
+func invalidNameRune(r rune) bool {
+	return r == ':' || r == '|' || r == '@' || unicode.IsSpace(r)
+}
+
+// sanitizeName replaces any invalid characters with an underscore.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if invalidNameRune(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// sanitizePathSegment sanitizes a name and replaces any dots with an
+// underscore, so that it is a single segment of a dotted path.
+func sanitizePathSegment(segment string) string {
+	return strings.ReplaceAll(sanitizeName(segment), ".", "_")
+}
+
+// warnCollisions logs a warning for each tag which overwrites an inherited
+// tag with a different value when enabled, in key order.
+func warnCollisions(enabled bool, inherited, tags map[string]string, w *warnThrottle) {
+	if !enabled || len(inherited) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if old, ok := inherited[k]; ok && old != tags[k] {
+			w.warnf("metrics: tag %q overwritten from %q to %q", k, old, tags[k])
+		}
+	}
+}
+
+// redactTags returns a copy of the tags with each value replaced by the
+// result of the redactor, or the input when there is no redactor.
+func redactTags(redact func(key, value string) string, tags map[string]string) map[string]string {
+	if redact == nil || len(tags) == 0 {
+		return tags
+	}
+	redacted := make(map[string]string, len(tags))
+	for k, v := range tags {
+		redacted[k] = redact(k, v)
+	}
+	return redacted
+}
+
+// sanitizeTags returns sanitized tags when sanitizing, otherwise the input.
+func (m nameMode) sanitizeTags(tags map[string]string) map[string]string {
+	if m != nameSanitize {
+		return tags
+	}
+	sanitized := make(map[string]string, len(tags))
+	for k, v := range tags {
+		sanitized[sanitizeName(k)] = sanitizeName(v)
+	}
+	return sanitized
+}
+
+// checkNegative returns an error describing the dropped call when checks are
+// enabled and a histogram-like value is negative, which is almost always a
+// bug, e.g. a clock going backwards, and would distort percentiles.
+func checkNegative(enabled bool, kind string, name string, value float64) error {
+	if !enabled || value >= 0 {
+		return nil
+	}
+	return fmt.Errorf("metrics: dropping negative %s value %v for %q", kind, value, name)
+}
+
+// ReservedTagKeys are tag keys which have a special meaning to DataDog and
+// are checked by the `WithReservedTagWarnings` and `WithStrictReservedTags`
+// options. It can be extended before creating clients.
+var ReservedTagKeys = []string{"host", "device", "source"}
+
+// reservedMode controls how tags using one of the `ReservedTagKeys` are
+// handled.
+type reservedMode int
+
+const (
+	reservedUnchecked reservedMode = iota
+	reservedWarn
+	reservedStrict
+)
+
+// checkTags logs a warning for each reserved tag key. In strict mode, the
+// reserved tags are also removed.
+func (m reservedMode) checkTags(tags map[string]string, w *warnThrottle) map[string]string {
+	if m == reservedUnchecked || len(tags) == 0 {
+		return tags
+	}
+
+	var reserved []string
+	for _, key := range ReservedTagKeys {
+		if _, ok := tags[key]; !ok {
+			continue
+		}
+		reserved = append(reserved, key)
+		if m == reservedStrict {
+			w.warnf("metrics: dropping reserved tag %q", key)
+		} else {
+			w.warnf("metrics: tag %q is reserved and may override agent tags", key)
+		}
+	}
+
+	if m != reservedStrict || len(reserved) == 0 {
+		return tags
+	}
+	return without(tags, reserved)
+}
+
+// defaultWarningInterval is how often each distinct warning is logged unless
+// overridden via `WithWarningInterval`.
+const defaultWarningInterval = time.Minute
+
+// maxThrottledWarnings is the number of distinct warnings tracked before
+// expired ones are pruned.
+const maxThrottledWarnings = 1024
+
+// warnThrottle logs each distinct warning message at most once per interval,
+// so that a misbehaving call site cannot flood the logs with validation
+// warnings. It is shared by a client and all of its clones. A nil throttle
+// logs every warning.
+type warnThrottle struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+// newWarnThrottle returns a throttle for the given interval, or nil if the
+// interval is zero.
+func newWarnThrottle(interval time.Duration) *warnThrottle {
+	if interval <= 0 {
+		return nil
+	}
+	return &warnThrottle{
+		interval: interval,
+		last:     map[string]time.Time{},
+	}
+}
+
+// warnf logs a warning unless the same message was logged within the
+// interval.
+func (w *warnThrottle) warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if w != nil && !w.allow(message, time.Now()) {
+		return
+	}
+	log.Print(message)
+}
+
+// allow returns whether a message may be logged at the given time and, if
+// so, records it.
+func (w *warnThrottle) allow(message string, now time.Time) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if last, ok := w.last[message]; ok && now.Sub(last) < w.interval {
+		return false
+	}
+	w.last[message] = now
+
+	if len(w.last) > maxThrottledWarnings {
+		for m, last := range w.last {
+			if now.Sub(last) >= w.interval {
+				delete(w.last, m)
+			}
+		}
+	}
+	return true
+}
+
+// defaultTagOverflowValue replaces tag values once a tag key has exceeded its
+// cardinality limit.
+const defaultTagOverflowValue = "__overflow__"
+
+// cardinalityLimiter tracks the distinct values seen for each tag key and is
+// shared by a client and all of its clones. A nil limiter allows everything.
+type cardinalityLimiter struct {
+	mutex    sync.Mutex
+	limit    int
+	overflow string
+	values   map[string]map[string]struct{}
+	warned   map[string]bool
+}
+
+// newCardinalityLimiter returns a limiter allowing `limit` distinct values per
+// tag key, or nil if there is no limit.
+func newCardinalityLimiter(limit int, overflow string) *cardinalityLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	if overflow == "" {
+		overflow = defaultTagOverflowValue
+	}
+	return &cardinalityLimiter{
+		limit:    limit,
+		overflow: overflow,
+		values:   map[string]map[string]struct{}{},
+		warned:   map[string]bool{},
+	}
+}
+
+// limitTags returns the tags with any values beyond the limit for their key
+// replaced by the overflow value. A warning is logged the first time a key
+// overflows.
+func (l *cardinalityLimiter) limitTags(tags map[string]string) map[string]string {
+	if l == nil || len(tags) == 0 {
+		return tags
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var limited map[string]string
+	for k, v := range tags {
+		seen := l.values[k]
+		if seen == nil {
+			seen = map[string]struct{}{}
+			l.values[k] = seen
+		}
+		if _, ok := seen[v]; ok || v == l.overflow {
+			continue
+		}
+		if len(seen) < l.limit {
+			seen[v] = struct{}{}
+			continue
+		}
+
+		if !l.warned[k] {
+			l.warned[k] = true
+			log.Printf("metrics: tag %q exceeded %d distinct values, replacing new values with %q", k, l.limit, l.overflow)
+		}
+		if limited == nil {
+			limited = combine(nil, tags)
+		}
+		limited[k] = l.overflow
+	}
+
+	if limited == nil {
+		return tags
+	}
+	return limited
+}
+
+// check returns the metric name to send and whether it should be sent. In
+// strict mode, metrics with an invalid name or tags are dropped with a
+// warning. The tags are only requested when needed.
+func (m nameMode) check(name string, tags func() map[string]string, w *warnThrottle) (string, bool) {
+	switch m {
+	case nameSanitize:
+		return sanitizeName(name), true
+	case nameStrict:
+		if strings.IndexFunc(name, invalidNameRune) != -1 {
+			w.warnf("metrics: dropping metric with invalid name %q", name)
+			return name, false
+		}
+		for k, v := range tags() {
+			if strings.IndexFunc(k, invalidNameRune) != -1 || strings.IndexFunc(v, invalidNameRune) != -1 {
+				w.warnf("metrics: dropping metric %q with invalid tag %q=%q", name, k, v)
+				return name, false
+			}
+		}
+	}
+	return name, true
 }
 
 // Converts a map to an array of strings like `key:value`.
@@ -50,6 +576,81 @@ func mapToStrings(tagMap map[string]string) []string {
 	return tags
 }
 
+// tagPath folds tags into a dotted metric path in sorted key order, e.g.
+// `name.tag1.value1.tag2.value2`, for backends which have no concept of tags.
+// Tag keys and values are sanitized like names so that they cannot break the
+// line protocol, e.g. a `:` in a value ending the statsd metric name early,
+// and dots are replaced too so that each key and value is one path segment.
+func tagPath(name string, tagMap map[string]string) string {
+	keys := make([]string, 0, len(tagMap))
+	for k := range tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	path := name
+	for _, k := range keys {
+		path += "." + sanitizePathSegment(k) + "." + sanitizePathSegment(tagMap[k])
+	}
+	return path
+}
+
+// serviceCheckStatus returns a human-readable name for a service check status.
+func serviceCheckStatus(status statsd.ServiceCheckStatus) string {
+	switch status {
+	case statsd.Ok:
+		return "OK"
+	case statsd.Warn:
+		return "WARNING"
+	case statsd.Critical:
+		return "CRITICAL"
+	case statsd.Unknown:
+		return "UNKNOWN"
+	}
+	return fmt.Sprintf("%d", status)
+}
+
+// stringsToMap converts DataDog-style `key:value` tags into a map. Tags
+// without a colon are given an empty value.
+func stringsToMap(tags []string) map[string]string {
+	tagMap := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		tagMap[key] = value
+	}
+	return tagMap
+}
+
+// eventPriority returns the event priority, defaulting to `normal` like the
+// DataDog agent does.
+func eventPriority(e *statsd.Event) string {
+	if e.Priority == "" {
+		return string(statsd.Normal)
+	}
+	return string(e.Priority)
+}
+
+// eventAlertType returns the event alert type, defaulting to `info` like the
+// DataDog agent does.
+func eventAlertType(e *statsd.Event) string {
+	if e.AlertType == "" {
+		return string(statsd.Info)
+	}
+	return string(e.AlertType)
+}
+
+// escapeNewlines replaces line breaks with a literal `\n` so that multi-line
+// text stays on a single log line.
+func escapeNewlines(text string) string {
+	return strings.NewReplacer("\r\n", "\\n", "\n", "\\n", "\r", "\\n").Replace(text)
+}
+
+// fromMilliseconds converts a floating point number of milliseconds into a
+// duration.
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
 // convertType converts a value into an specific type if possible, otherwise
 // panics. The returned interface is guaranteed to cast properly.
 func convertType(value interface{}, toType reflect.Type) interface{} {
@@ -0,0 +1,123 @@
+package metrics_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/istreamlabs/go-metrics/metrics"
+)
+
+func TestCombine(t *testing.T) {
+	original := map[string]string{"tag1": "value1", "tag2": "value2"}
+	override := map[string]string{"tag2": "override", "tag3": "value3"}
+
+	combined := metrics.Combine(original, override)
+	ExpectEqual(t, map[string]string{
+		"tag1": "value1",
+		"tag2": "override",
+		"tag3": "value3",
+	}, combined)
+
+	// The result never shares state with the inputs.
+	combined["tag1"] = "modified"
+	ExpectEqual(t, "value1", original["tag1"])
+	ExpectEqual(t, map[string]string{}, metrics.Combine(nil, nil))
+}
+
+func BenchmarkCombine(b *testing.B) {
+	for _, size := range []int{1, 5, 20} {
+		original := map[string]string{}
+		override := map[string]string{}
+		for i := 0; i < size; i++ {
+			original[fmt.Sprintf("tag%d", i)] = "value"
+			override[fmt.Sprintf("other%d", i)] = "value"
+		}
+
+		b.Run(fmt.Sprintf("%dTags", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				metrics.Combine(original, override)
+			}
+		})
+	}
+}
+
+func TestWithTagsEmpty(t *testing.T) {
+	logger := metrics.NewLoggerClient(&LogRecorder{}).WithTag("tag1", "value1")
+	clients := map[string]metrics.Client{
+		"logger":   logger,
+		"datadog":  metrics.NewDataDogClientWithStatsd(&fakeStatsd{}).WithTag("tag1", "value1"),
+		"recorder": metrics.NewRecorderClient().WithTag("tag1", "value1"),
+		"memory":   metrics.NewMemoryClient().WithTag("tag1", "value1"),
+		"multi":    metrics.NewMultiClient(logger),
+		"filter":   metrics.NewFilterClient(logger, nil, nil),
+	}
+
+	empty := map[string]string{}
+	for name, parent := range clients {
+		t.Run(name, func(t *testing.T) {
+			allocs := testing.AllocsPerRun(100, func() {
+				parent.WithTags(nil)
+				parent.WithTags(empty)
+			})
+			ExpectEqual(t, 0.0, allocs)
+
+			// The child is unaffected by later changes to the parent or to the
+			// returned tags, since neither modifies the shared tag map.
+			child := parent.WithTags(nil)
+			parent.WithTag("tag1", "modified")
+			child.Tags()["tag1"] = "modified"
+			ExpectEqual(t, map[string]string{"tag1": "value1"}, child.Tags())
+		})
+	}
+}
+
+func BenchmarkWithTagsNil(b *testing.B) {
+	client := metrics.NewLoggerClient(&LogRecorder{}).WithTag("tag1", "value1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		client.WithTags(nil)
+	}
+}
+
+func TestSetEnabled(t *testing.T) {
+	defer metrics.SetEnabled(true)
+
+	recorder := &LogRecorder{}
+	fake := &fakeStatsd{}
+	calls := metrics.NewRecorderClient()
+	clients := []metrics.Client{
+		metrics.NewLoggerClient(recorder).WithTag("tag1", "value1"),
+		metrics.NewDataDogClientWithStatsd(fake).WithTag("tag1", "value1"),
+		calls.WithTag("tag1", "value1"),
+	}
+	emit := func() {
+		for _, client := range clients {
+			client.Incr("requests")
+			client.Gauge("queue.depth", 3)
+			client.Set("users", "abc")
+			client.Timing("latency", time.Second)
+			client.Histogram("size", 10)
+			client.Event(statsd.NewEvent("deploy", "v1"))
+			client.ServiceCheck(statsd.NewServiceCheck("db", statsd.Ok))
+		}
+	}
+	counts := func() []int {
+		return []int{len(recorder.messages), len(fake.calls), calls.Length()}
+	}
+
+	ExpectEqual(t, true, metrics.Enabled())
+	emit()
+	ExpectEqual(t, []int{7, 7, 7}, counts())
+
+	metrics.SetEnabled(false)
+	ExpectEqual(t, false, metrics.Enabled())
+	emit()
+	ExpectEqual(t, []int{7, 7, 7}, counts())
+
+	metrics.SetEnabled(true)
+	emit()
+	ExpectEqual(t, []int{14, 14, 14}, counts())
+}